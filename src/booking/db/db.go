@@ -29,7 +29,7 @@ func Connect(connect string) error {
 		return errors.New("failed to connect database")
 	}
 	log.Info("Starting automatic migration")
-	if err := DB.Debug().AutoMigrate(&model.Booking{}); err != nil {
+	if err := DB.Debug().AutoMigrate(&model.BookingGroup{}, &model.BookingSeries{}, &model.Booking{}, &model.BookingTransition{}, &model.IdempotencyRecord{}, &model.OutboxMessage{}); err != nil {
 		return err
 	}
 	log.Info("Finished automatic migration")
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/service"
@@ -9,23 +10,66 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"strings"
 )
 
 type BookingHandler struct {
 	proto.BookingExternalServer
+	proto.BookingInternalServer
+}
+
+// idempotentMethods lists the methods that change bookings, their requests may carry an Idempotency-Key
+var idempotentMethods = map[string]bool{
+	proto.BookingExternal_CreateBooking_FullMethodName:          true,
+	proto.BookingExternal_UpdateBooking_FullMethodName:          true,
+	proto.BookingExternal_DeleteBooking_FullMethodName:          true,
+	proto.BookingExternal_CancelBooking_FullMethodName:          true,
+	proto.BookingExternal_ConfirmBooking_FullMethodName:         true,
+	proto.BookingExternal_RejectBooking_FullMethodName:          true,
+	proto.BookingExternal_CheckInBooking_FullMethodName:         true,
+	proto.BookingExternal_CompleteBooking_FullMethodName:        true,
+	proto.BookingExternal_ExpireBooking_FullMethodName:          true,
+	proto.BookingExternal_CreateGroupBooking_FullMethodName:     true,
+	proto.BookingExternal_CancelGroupBooking_FullMethodName:     true,
+	proto.BookingExternal_CreateBookingSeries_FullMethodName:    true,
+	proto.BookingExternal_CancelBookingSeries_FullMethodName:    true,
+	proto.BookingExternal_CancelSeriesOccurrence_FullMethodName: true,
+	proto.BookingExternal_JoinWaitlist_FullMethodName:           true,
+	proto.BookingExternal_LeaveWaitlist_FullMethodName:          true,
 }
 
 func (h *BookingHandler) CreateBooking(_ context.Context, req *proto.CreateBookingReq) (*proto.BookingResp, error) {
+	if req.CheckIn == nil || req.CheckOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
 	booking := model.Booking{
-		Comment:      req.Comment,
-		CustomerName: req.CustomerName,
-		PropertyId:   uint(req.PropertyId),
+		Comment:    req.Comment,
+		CustomerId: uint(req.CustomerId),
+		PropertyId: uint(req.PropertyId),
+		CheckIn:    req.CheckIn.AsTime(),
+		CheckOut:   req.CheckOut.AsTime(),
+		HoldToken:  req.HoldToken,
+		Guests: model.Guests{
+			Adults:   req.Adults,
+			Children: req.Children,
+			Pets:     req.Pets,
+		},
 	}
 
 	err := service.CreateBooking(&booking)
 	if err != nil {
 		log.Errorf("Error calling service CreateBooking: %v", err)
+
+		var bookingError *model.BookingError
+		if errors.As(err, &bookingError) {
+			return nil, status.Errorf(codes.InvalidArgument, bookingError.Error())
+		}
+		// structured errors of the property service are passed on with their details
+		if propertyStatus, ok := status.FromError(err); ok && len(propertyStatus.Details()) > 0 {
+			return nil, propertyStatus.Err()
+		}
 		if strings.Contains(err.Error(), "code = NotFound") {
 			return nil, status.Errorf(codes.NotFound, err.Error())
 		}
@@ -37,17 +81,48 @@ func (h *BookingHandler) CreateBooking(_ context.Context, req *proto.CreateBooki
 	return mapToProtoBookingResp(&booking), nil
 }
 
-func (h *BookingHandler) UpdateBooking(_ context.Context, req *proto.UpdateBookingReq) (*proto.BookingResp, error) {
+func (h *BookingHandler) QuoteBooking(_ context.Context, req *proto.QuoteBookingReq) (*proto.BookingPriceResp, error) {
+	if req.CheckIn == nil || req.CheckOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
+	price, err := service.QuoteBooking(uint(req.PropertyId), req.CheckIn.AsTime(), req.CheckOut.AsTime())
+	if err != nil {
+		log.Errorf("Error calling service QuoteBooking: %v", err)
+
+		var bookingError *model.BookingError
+		if errors.As(err, &bookingError) {
+			return nil, status.Errorf(codes.InvalidArgument, bookingError.Error())
+		}
+		return nil, mapPropertyServiceError(err)
+	}
+	return mapToProtoBookingPriceResp(price), nil
+}
+
+func (h *BookingHandler) UpdateBooking(ctx context.Context, req *proto.UpdateBookingReq) (*proto.BookingResp, error) {
+	expectedVersion, err := getExpectedVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
 	booking := model.Booking{
-		Comment:      req.Comment,
-		CustomerName: req.CustomerName,
-		PropertyId:   uint(req.PropertyId),
+		Comment:    req.Comment,
+		CustomerId: uint(req.CustomerId),
+		PropertyId: uint(req.PropertyId),
 	}
 
-	updatedBooking, err := service.UpdateBooking(uint(req.Id), &booking)
+	updatedBooking, err := service.UpdateBooking(uint(req.Id), &booking, expectedVersion)
 	if err != nil {
 		log.Errorf("Error calling service UpdateBooking with ID %v: %v", req.Id, err)
-		return nil, status.Errorf(codes.Internal, err.Error())
+
+		var bookingError *model.BookingError
+		if errors.As(err, &bookingError) {
+			return nil, status.Errorf(codes.InvalidArgument, bookingError.Error())
+		}
+		var conflictError *model.VersionConflictError
+		if errors.As(err, &conflictError) {
+			return nil, status.Errorf(codes.Aborted, conflictError.Error())
+		}
+		return nil, mapPropertyServiceError(err)
 	}
 	if updatedBooking == nil {
 		return nil, status.Errorf(codes.NotFound, "Booking not found")
@@ -67,10 +142,35 @@ func (h *BookingHandler) GetBooking(_ context.Context, req *proto.BookingIdReq)
 	return mapToProtoBookingResp(booking), nil
 }
 
-func (h *BookingHandler) GetBookings(_ context.Context, _ *emptypb.Empty) (*proto.ListBookingsResp, error) {
-	bookings, err := service.GetBookings()
+func (h *BookingHandler) GetBookings(_ context.Context, req *proto.ListBookingsReq) (*proto.ListBookingsResp, error) {
+	filter := model.BookingFilter{
+		IncludeCancelled: req.IncludeCancelled,
+		PropertyId:       uint(req.PropertyId),
+		CustomerId:       uint(req.CustomerId),
+	}
+	for _, name := range req.Status {
+		bookingStatus, err := model.ParseStatus(name)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		filter.Statuses = append(filter.Statuses, bookingStatus)
+	}
+	if req.CreatedAfter != nil {
+		filter.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+	if req.CreatedBefore != nil {
+		filter.CreatedBefore = req.CreatedBefore.AsTime()
+	}
+	page := model.PageRequest{PageSize: req.PageSize, PageToken: req.PageToken, OrderBy: req.OrderBy}
+
+	bookings, nextPageToken, err := service.GetBookings(filter, page)
 	if err != nil {
 		log.Errorf("Error calling service GetBookings: %v", err)
+
+		var bookingError *model.BookingError
+		if errors.As(err, &bookingError) {
+			return nil, status.Errorf(codes.InvalidArgument, bookingError.Error())
+		}
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 
@@ -78,13 +178,18 @@ func (h *BookingHandler) GetBookings(_ context.Context, _ *emptypb.Empty) (*prot
 	for _, booking := range bookings {
 		protoBookings = append(protoBookings, mapToProtoBookingResp(&booking))
 	}
-	return &proto.ListBookingsResp{Bookings: protoBookings}, nil
+	return &proto.ListBookingsResp{Bookings: protoBookings, NextPageToken: nextPageToken}, nil
 }
 
 func (h *BookingHandler) DeleteBooking(_ context.Context, req *proto.BookingIdReq) (*emptypb.Empty, error) {
 	booking, err := service.DeleteBooking(uint(req.Id))
 	if err != nil {
 		log.Errorf("Error calling service DeleteBooking with ID %v: %v", req.Id, err)
+
+		var transitionError *model.TransitionError
+		if errors.As(err, &transitionError) {
+			return nil, status.Errorf(codes.FailedPrecondition, transitionError.Error())
+		}
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 	if booking == nil {
@@ -92,3 +197,113 @@ func (h *BookingHandler) DeleteBooking(_ context.Context, req *proto.BookingIdRe
 	}
 	return new(emptypb.Empty), nil
 }
+
+func (h *BookingHandler) ConfirmBooking(_ context.Context, req *proto.BookingTransitionReq) (*proto.BookingResp, error) {
+	return changeBookingStatus(req, "ConfirmBooking", service.ConfirmBooking)
+}
+
+func (h *BookingHandler) CancelBooking(_ context.Context, req *proto.CancelBookingReq) (*proto.BookingResp, error) {
+	if err := checkReason(req.Reason); err != nil {
+		return nil, err
+	}
+	transitionReq := &proto.BookingTransitionReq{Id: req.Id, Actor: req.Actor}
+	return changeBookingStatus(transitionReq, "CancelBooking", func(id uint, actor string) (*model.Booking, error) {
+		return service.CancelBooking(id, actor, req.Reason)
+	})
+}
+
+func (h *BookingHandler) RejectBooking(_ context.Context, req *proto.BookingTransitionReq) (*proto.BookingResp, error) {
+	return changeBookingStatus(req, "RejectBooking", service.RejectBooking)
+}
+
+func (h *BookingHandler) CheckInBooking(_ context.Context, req *proto.BookingTransitionReq) (*proto.BookingResp, error) {
+	return changeBookingStatus(req, "CheckInBooking", service.CheckInBooking)
+}
+
+func (h *BookingHandler) CompleteBooking(_ context.Context, req *proto.BookingTransitionReq) (*proto.BookingResp, error) {
+	return changeBookingStatus(req, "CompleteBooking", service.CompleteBooking)
+}
+
+func (h *BookingHandler) ExpireBooking(_ context.Context, req *proto.BookingTransitionReq) (*proto.BookingResp, error) {
+	return changeBookingStatus(req, "ExpireBooking", service.ExpireBooking)
+}
+
+func (h *BookingHandler) ApproveBooking(_ context.Context, req *proto.BookingDecisionReq) (*emptypb.Empty, error) {
+	log.Infof("Received approval: %v", req)
+
+	transitionReq := &proto.BookingTransitionReq{Id: req.BookingId, Actor: req.Actor}
+	_, err := changeBookingStatus(transitionReq, "ApproveBooking", service.ApproveBooking)
+	if err != nil {
+		return nil, err
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (h *BookingHandler) DeclineBooking(_ context.Context, req *proto.BookingDecisionReq) (*emptypb.Empty, error) {
+	log.Infof("Received decline: %v", req)
+	if err := checkReason(req.Reason); err != nil {
+		return nil, err
+	}
+
+	transitionReq := &proto.BookingTransitionReq{Id: req.BookingId, Actor: req.Actor}
+	_, err := changeBookingStatus(transitionReq, "DeclineBooking", func(id uint, actor string) (*model.Booking, error) {
+		return service.DeclineBooking(id, actor, req.Reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (h *BookingHandler) GetStay(_ context.Context, req *proto.StayReq) (*proto.StayResp, error) {
+	booking, err := service.GetBooking(uint(req.BookingId))
+	if err != nil {
+		log.Errorf("Error calling service GetBooking with ID %v: %v", req.BookingId, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if booking == nil {
+		return nil, status.Errorf(codes.NotFound, "Booking not found")
+	}
+	return &proto.StayResp{
+		BookingId:    uint32(booking.ID),
+		PropertyId:   uint32(booking.PropertyId),
+		CustomerName: booking.CustomerName,
+		CustomerId:   uint32(booking.CustomerId),
+		Status:       string(booking.Status),
+		CheckIn:      timestamppb.New(booking.CheckIn),
+		CheckOut:     timestamppb.New(booking.CheckOut),
+	}, nil
+}
+
+// changeBookingStatus calls the given service function to move a booking along its lifecycle
+// and maps illegal transitions to FailedPrecondition
+func changeBookingStatus(req *proto.BookingTransitionReq, serviceName string, change func(uint, string) (*model.Booking, error)) (*proto.BookingResp, error) {
+	if req.Actor == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Actor is required")
+	}
+
+	booking, err := change(uint(req.Id), req.Actor)
+	if err != nil {
+		log.Errorf("Error calling service %s with ID %v: %v", serviceName, req.Id, err)
+
+		var transitionError *model.TransitionError
+		if errors.As(err, &transitionError) {
+			return nil, status.Errorf(codes.FailedPrecondition, transitionError.Error())
+		}
+		var bookingError *model.BookingError
+		if errors.As(err, &bookingError) {
+			return nil, status.Errorf(codes.InvalidArgument, bookingError.Error())
+		}
+		if strings.Contains(err.Error(), "code = NotFound") {
+			return nil, status.Errorf(codes.NotFound, err.Error())
+		}
+		if strings.Contains(err.Error(), "code = InvalidArgument") {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if booking == nil {
+		return nil, status.Errorf(codes.NotFound, "Booking not found")
+	}
+	return mapToProtoBookingResp(booking), nil
+}
@@ -5,14 +5,25 @@ import (
 	"errors"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/db"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/handler/integration_test"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/service"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/suite"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	googleproto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 const propertyInternalServerPort = "9111"
+const userInternalServerPort = "9113"
 
 type BookingTestSuite struct {
 	suite.Suite
@@ -20,6 +31,8 @@ type BookingTestSuite struct {
 	client                     proto.BookingExternalClient
 	closeBookingExternalServer func()
 	mockPropertyInternalServer *integration_test.MockPropertyInternalServer
+	mockUserInternalServer     *integration_test.MockUserInternalServer
+	closeMockUserServer        func()
 	cleanUpDB                  func()
 }
 
@@ -29,6 +42,8 @@ func (suite *BookingTestSuite) SetupSuite() {
 	suite.ctx = context.Background()
 	suite.client, suite.closeBookingExternalServer = startBookingExternalServer(suite.ctx)
 	suite.mockPropertyInternalServer = new(integration_test.MockPropertyInternalServer)
+	suite.mockUserInternalServer = &integration_test.MockUserInternalServer{Accounts: getMockAccounts()}
+	suite.closeMockUserServer = suite.mockUserInternalServer.Start(userInternalServerPort)
 }
 
 // beforeEach
@@ -41,6 +56,7 @@ func (suite *BookingTestSuite) SetupTest() {
 func (suite *BookingTestSuite) TearDownSuite() {
 	log.Info(">>> From TearDownSuite")
 	suite.closeBookingExternalServer()
+	suite.closeMockUserServer()
 }
 
 // afterEach
@@ -56,13 +72,13 @@ func (suite *BookingTestSuite) TestBookingHandler_GetBookings() {
 	}
 
 	tests := map[string]struct {
-		in           *emptypb.Empty
+		in           *proto.ListBookingsReq
 		setupFunc    func()
 		tearDownFunc func()
 		expected     expectation
 	}{
 		"GivenNoBooking_WhenGetBookings_ThenReturnEmpty": {
-			in:           new(emptypb.Empty),
+			in:           &proto.ListBookingsReq{},
 			setupFunc:    nil,
 			tearDownFunc: nil,
 			expected: expectation{
@@ -71,7 +87,7 @@ func (suite *BookingTestSuite) TestBookingHandler_GetBookings() {
 			},
 		},
 		"GivenOneBooking_WhenGetBookings_ThenReturnBooking": {
-			in: new(emptypb.Empty),
+			in: &proto.ListBookingsReq{},
 			setupFunc: func() {
 				createBookingInDB()
 			},
@@ -83,6 +99,66 @@ func (suite *BookingTestSuite) TestBookingHandler_GetBookings() {
 				err: nil,
 			},
 		},
+		"GivenCancelledBooking_WhenGetBookings_ThenReturnEmpty": {
+			in: &proto.ListBookingsReq{},
+			setupFunc: func() {
+				createBookingWithStatusInDB(model.CANCELLED)
+			},
+			tearDownFunc: func() {
+				deleteBookingInDB()
+			},
+			expected: expectation{
+				out: getMockListBookingsResp(nil),
+				err: nil,
+			},
+		},
+		"GivenCancelledBookingAndIncludeCancelled_WhenGetBookings_ThenReturnBooking": {
+			in: &proto.ListBookingsReq{IncludeCancelled: true},
+			setupFunc: func() {
+				createBookingWithStatusInDB(model.CANCELLED)
+			},
+			tearDownFunc: func() {
+				deleteBookingInDB()
+			},
+			expected: expectation{
+				out: getMockListBookingsResp(getMockBookingRespWithDefaultCustomerName()),
+				err: nil,
+			},
+		},
+		"GivenCancelledBookingAndStatusFilter_WhenGetBookings_ThenReturnBooking": {
+			in: &proto.ListBookingsReq{Status: []string{string(model.CANCELLED)}},
+			setupFunc: func() {
+				createBookingWithStatusInDB(model.CANCELLED)
+			},
+			tearDownFunc: func() {
+				deleteBookingInDB()
+			},
+			expected: expectation{
+				out: getMockListBookingsResp(getMockBookingRespWithDefaultCustomerName()),
+				err: nil,
+			},
+		},
+		"GivenBookingOfOtherProperty_WhenGetBookingsOfProperty_ThenReturnEmpty": {
+			in: &proto.ListBookingsReq{PropertyId: 999},
+			setupFunc: func() {
+				createBookingInDB()
+			},
+			tearDownFunc: func() {
+				deleteBookingInDB()
+			},
+			expected: expectation{
+				out: getMockListBookingsResp(nil),
+				err: nil,
+			},
+		},
+		"GivenUnknownStatus_WhenGetBookings_ThenReturnError": {
+			in: &proto.ListBookingsReq{Status: []string{"BOOKED"}},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Unknown status BOOKED, " +
+					"expected PENDING, CONFIRMED, REJECTED, CANCELLED, CHECKED_IN, COMPLETED or EXPIRED"),
+			},
+		},
 	}
 
 	for scenario, testData := range tests {
@@ -109,6 +185,323 @@ func (suite *BookingTestSuite) TestBookingHandler_GetBookings() {
 	}
 }
 
+func (suite *BookingTestSuite) TestBookingHandler_MoveBooking() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	mock := suite.mockPropertyInternalServer
+	defer func() {
+		mock.DecliningPropertyId, mock.FailingCancelPropertyId, mock.Cancelled = 0, 0, nil
+	}()
+
+	// given
+	createBookingWithStatusInDB(model.CONFIRMED)
+	defer deleteBookingInDB()
+
+	// when the new property declines the booking
+	mock.DecliningPropertyId = 2
+	_, err := suite.client.UpdateBooking(suite.ctx, &proto.UpdateBookingReq{Id: 1, CustomerId: 1, PropertyId: 2})
+
+	// then the booking stays at the old property
+	expected := "rpc error: code = InvalidArgument desc = Property 2 is already booked"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+	out, _ := suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: 1})
+	if out == nil || out.PropertyId != 1 || out.Status != "CONFIRMED" || len(mock.Cancelled) != 0 {
+		suite.T().Errorf("Unexpected: %v, cancelled: %v", out, mock.Cancelled)
+	}
+
+	// when the old property cannot be freed
+	mock.DecliningPropertyId, mock.FailingCancelPropertyId = 0, 1
+	out, err = suite.client.UpdateBooking(suite.ctx, &proto.UpdateBookingReq{Id: 1, CustomerId: 1, PropertyId: 2})
+
+	// then the booking moves anyway and the old property is freed once it is available again
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.PropertyId != 2 || out.Status != "CONFIRMED" || len(mock.Cancelled) != 0 {
+		suite.T().Errorf("Unexpected: %v, cancelled: %v", out, mock.Cancelled)
+	}
+	mock.FailingCancelPropertyId = 0
+	makeOutboxDueInDB()
+	if _, err := service.DispatchOutbox(); err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	}
+	if len(mock.Cancelled) != 1 || mock.Cancelled[0].PropertyId != 1 {
+		suite.T().Errorf("Unexpected cancellations: %v", mock.Cancelled)
+	}
+
+	// when both properties accept the move
+	mock.Cancelled = nil
+	out, err = suite.client.UpdateBooking(suite.ctx, &proto.UpdateBookingReq{Id: 1, CustomerId: 1, PropertyId: 1})
+
+	// then the booking points at the new property and the old one is freed
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.PropertyId != 1 || out.Status != "CONFIRMED" || len(mock.Cancelled) != 1 || mock.Cancelled[0].PropertyId != 2 {
+		suite.T().Errorf("Unexpected: %v, cancelled: %v", out, mock.Cancelled)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_MovePendingBooking() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	mock := suite.mockPropertyInternalServer
+	defer func() {
+		mock.DecliningPropertyId, mock.UnavailablePropertyId, mock.Cancelled = 0, 0, nil
+	}()
+
+	// given
+	createBookingWithStatusInDB(model.PENDING)
+	defer deleteBookingInDB()
+
+	for _, failure := range []string{"declined", "unavailable"} {
+		// when the new property declines the booking or cannot be reached
+		mock.DecliningPropertyId, mock.UnavailablePropertyId = 0, 0
+		if failure == "declined" {
+			mock.DecliningPropertyId = 2
+		} else {
+			mock.UnavailablePropertyId = 2
+		}
+		_, err := suite.client.UpdateBooking(suite.ctx, &proto.UpdateBookingReq{Id: 1, PropertyId: 2})
+
+		// then the booking keeps its status and property
+		if err == nil {
+			suite.T().Errorf("Expected err for %s property", failure)
+		}
+		out, _ := suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: 1})
+		if out == nil || out.PropertyId != 1 || out.Status != "PENDING" {
+			suite.T().Errorf("Unexpected for %s property: %v", failure, out)
+		}
+		// and the unavailable property is freed, as it might have reserved itself anyway
+		if failure == "unavailable" && (len(mock.Cancelled) != 1 || mock.Cancelled[0].PropertyId != 2) {
+			suite.T().Errorf("Unexpected cancellations for %s property: %v", failure, mock.Cancelled)
+		}
+	}
+
+	// when the new property accepts the booking
+	mock.DecliningPropertyId, mock.UnavailablePropertyId, mock.Cancelled = 0, 0, nil
+	out, err := suite.client.UpdateBooking(suite.ctx, &proto.UpdateBookingReq{Id: 1, PropertyId: 2})
+
+	// then the booking is confirmed at the new property without freeing the old one
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.PropertyId != 2 || out.Status != "CONFIRMED" || len(mock.Cancelled) != 0 {
+		suite.T().Errorf("Unexpected: %v, cancelled: %v", out, mock.Cancelled)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_GroupBooking() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	mock := suite.mockPropertyInternalServer
+	defer func() {
+		mock.DecliningPropertyId, mock.UnavailablePropertyId, mock.Cancelled = 0, 0, nil
+	}()
+	defer deleteGroupBookingsInDB()
+
+	in := &proto.CreateGroupBookingReq{
+		CustomerId:  4,
+		PropertyIds: []uint32{1, 2, 3},
+		CheckIn:     timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:    timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+	}
+
+	// when one property declines
+	mock.DecliningPropertyId = 3
+	_, err := suite.client.CreateGroupBooking(suite.ctx, in)
+
+	// then the confirmed properties are cancelled again and all bookings are rejected
+	expected := "rpc error: code = InvalidArgument desc = Property 3 is already booked"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+	if len(mock.Cancelled) != 2 || mock.Cancelled[0].PropertyId != 1 || mock.Cancelled[1].PropertyId != 2 {
+		suite.T().Errorf("Unexpected cancellations: %v", mock.Cancelled)
+	}
+	group, err := suite.client.GetGroupBooking(suite.ctx, &proto.GroupBookingIdReq{Id: 1})
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else {
+		for _, booking := range group.Bookings {
+			if booking.Status != "REJECTED" || booking.GroupId != 1 {
+				suite.T().Errorf("Unexpected: %v", booking)
+			}
+		}
+	}
+
+	// when all properties confirm
+	mock.DecliningPropertyId, mock.Cancelled = 0, nil
+	group, err = suite.client.CreateGroupBooking(suite.ctx, in)
+
+	// then all bookings are confirmed
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if len(group.Bookings) != 3 || len(mock.Cancelled) != 0 {
+		suite.T().Errorf("Unexpected: %v", group)
+	} else {
+		for _, booking := range group.Bookings {
+			if booking.Status != "CONFIRMED" {
+				suite.T().Errorf("Unexpected: %v", booking)
+			}
+		}
+	}
+
+	// when the group is cancelled
+	group, err = suite.client.CancelGroupBooking(suite.ctx, &proto.CancelGroupBookingReq{Id: 2, Actor: "team", Reason: "retreat postponed"})
+
+	// then all of its properties are freed
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if len(mock.Cancelled) != 3 {
+		suite.T().Errorf("Unexpected cancellations: %v", mock.Cancelled)
+	} else {
+		for _, booking := range group.Bookings {
+			if booking.Status != "CANCELLED" {
+				suite.T().Errorf("Unexpected: %v", booking)
+			}
+		}
+	}
+
+	// when one property cannot be reached
+	mock.UnavailablePropertyId, mock.Cancelled = 3, nil
+	group, err = suite.client.CreateGroupBooking(suite.ctx, in)
+
+	// then the group stays pending and keeps the reserved properties
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else {
+		for _, booking := range group.Bookings {
+			if booking.Status != "PENDING" {
+				suite.T().Errorf("Unexpected: %v", booking)
+			}
+		}
+	}
+	if len(mock.Cancelled) != 0 {
+		suite.T().Errorf("Unexpected cancellations: %v", mock.Cancelled)
+	}
+
+	// when the property is back and the confirmation is due again
+	mock.UnavailablePropertyId = 0
+	makeOutboxDueInDB()
+	if _, err := service.DispatchOutbox(); err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	}
+
+	// then all bookings are confirmed together
+	group, err = suite.client.GetGroupBooking(suite.ctx, &proto.GroupBookingIdReq{Id: 3})
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else {
+		for _, booking := range group.Bookings {
+			if booking.Status != "CONFIRMED" {
+				suite.T().Errorf("Unexpected: %v", booking)
+			}
+		}
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_BookingSeries() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	mock := suite.mockPropertyInternalServer
+	defer func() {
+		mock.DecliningCheckIn, mock.UnavailablePropertyId, mock.Cancelled = time.Time{}, 0, nil
+	}()
+	defer deleteBookingSeriesInDB()
+
+	// given
+	mock.DecliningCheckIn = time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)
+	in := &proto.CreateBookingSeriesReq{
+		CustomerId: 1,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 12, 0, 0, 0, 0, time.UTC)),
+		Frequency:  "WEEKLY",
+		Count:      3,
+	}
+
+	// when
+	series, err := suite.client.CreateBookingSeries(suite.ctx, in)
+
+	// then the declined occurrence is reported as conflict
+	if err != nil {
+		suite.T().Fatalf("Unexpected err: %v", err)
+	}
+	if len(series.Bookings) != 3 || series.Bookings[0].Status != "CONFIRMED" ||
+		series.Bookings[1].Status != "REJECTED" || series.Bookings[2].Status != "CONFIRMED" ||
+		!series.Bookings[2].CheckOut.AsTime().Equal(time.Date(2023, 7, 26, 0, 0, 0, 0, time.UTC)) {
+		suite.T().Errorf("Unexpected: %v", series)
+	}
+	if len(series.Conflicts) != 1 || series.Conflicts[0].BookingId != series.Bookings[1].Id ||
+		series.Conflicts[0].Reason != "rpc error: code = InvalidArgument desc = Property 1 is already booked on 2023-07-17" {
+		suite.T().Errorf("Unexpected conflicts: %v", series.Conflicts)
+	}
+
+	// when cancelling a single occurrence
+	lastId := series.Bookings[2].Id
+	series, err = suite.client.CancelSeriesOccurrence(suite.ctx, &proto.CancelSeriesOccurrenceReq{Id: series.Id, BookingId: lastId, Actor: "customer"})
+
+	// then only that occurrence is cancelled
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if series.Bookings[0].Status != "CONFIRMED" || series.Bookings[2].Status != "CANCELLED" {
+		suite.T().Errorf("Unexpected: %v", series)
+	}
+
+	// when cancelling the whole series
+	series, err = suite.client.CancelBookingSeries(suite.ctx, &proto.CancelBookingSeriesReq{Id: series.Id, Actor: "customer"})
+
+	// then the remaining occurrences are cancelled as well
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if series.Bookings[0].Status != "CANCELLED" || series.Bookings[1].Status != "REJECTED" || len(mock.Cancelled) != 2 {
+		suite.T().Errorf("Unexpected: %v, cancelled: %v", series, mock.Cancelled)
+	}
+
+	// when the property cannot be reached
+	mock.UnavailablePropertyId = 1
+	series, err = suite.client.CreateBookingSeries(suite.ctx, in)
+	mock.UnavailablePropertyId = 0
+
+	// then the occurrences stay pending until the dispatcher confirms them
+	if err != nil {
+		suite.T().Fatalf("Unexpected err: %v", err)
+	}
+	if len(series.Bookings) != 3 || series.Bookings[0].Status != "PENDING" || len(series.Conflicts) != 0 {
+		suite.T().Errorf("Unexpected: %v", series)
+	}
+	makeOutboxDueInDB()
+	if _, err := service.DispatchOutbox(); err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	}
+	series, err = suite.client.GetBookingSeries(suite.ctx, &proto.BookingSeriesIdReq{Id: series.Id})
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if series.Bookings[0].Status != "CONFIRMED" || series.Bookings[1].Status != "REJECTED" || series.Bookings[2].Status != "CONFIRMED" {
+		suite.T().Errorf("Unexpected: %v", series)
+	}
+
+	// when the rule has no end
+	in.Count = 0
+	_, err = suite.client.CreateBookingSeries(suite.ctx, in)
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = Either count or until is required to end the series"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+
+	// when the rule ends before the first check-in
+	in.Until = timestamppb.New(time.Date(2023, 7, 9, 0, 0, 0, 0, time.UTC))
+	_, err = suite.client.CreateBookingSeries(suite.ctx, in)
+
+	// then
+	expected = "rpc error: code = InvalidArgument desc = Until must not be before the first check-in"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
 func (suite *BookingTestSuite) TestBookingHandler_GetBooking() {
 	type expectation struct {
 		out *proto.BookingResp
@@ -199,7 +592,7 @@ func (suite *BookingTestSuite) TestBookingHandler_UpdateBooking() {
 			},
 		},
 		"GivenNoBooking_WhenUpdateBooking_ThenReturnNotFound": {
-			in:           &proto.UpdateBookingReq{Id: 1, CustomerName: "other"},
+			in:           &proto.UpdateBookingReq{Id: 1, CustomerId: 2},
 			setupFunc:    nil,
 			tearDownFunc: nil,
 			expected: expectation{
@@ -208,7 +601,7 @@ func (suite *BookingTestSuite) TestBookingHandler_UpdateBooking() {
 			},
 		},
 		"GivenOneBooking_WhenUpdateBooking_ThenReturnUpdatedBooking": {
-			in: &proto.UpdateBookingReq{Id: 1, CustomerName: "other"},
+			in: &proto.UpdateBookingReq{Id: 1, CustomerId: 2},
 			setupFunc: func() {
 				createBookingInDB()
 			},
@@ -246,6 +639,73 @@ func (suite *BookingTestSuite) TestBookingHandler_UpdateBooking() {
 	}
 }
 
+func (suite *BookingTestSuite) TestBookingHandler_UpdateBookingWithIfMatch() {
+	// given
+	createBookingInDB()
+	defer deleteBookingInDB()
+
+	// when updating with a stale version
+	ctx := metadata.AppendToOutgoingContext(suite.ctx, "if-match", "2")
+	_, err := suite.client.UpdateBooking(ctx, &proto.UpdateBookingReq{Id: 1, CustomerId: 2})
+
+	// then
+	expected := "rpc error: code = Aborted desc = Booking 1 was modified, it no longer has version 2"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+
+	// when updating the current version
+	ctx = metadata.AppendToOutgoingContext(suite.ctx, "if-match", "1")
+	out, err := suite.client.UpdateBooking(ctx, &proto.UpdateBookingReq{Id: 1, CustomerId: 2})
+
+	// then
+	suite.Require().NoError(err)
+	suite.Equal("other", out.CustomerName)
+	suite.Equal("2", out.Etag)
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_UpdateBookingAfterConcurrentCancel() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	mock := suite.mockPropertyInternalServer
+	defer func() { mock.Confirmed, mock.Cancelled = nil, nil }()
+
+	// given a booking read in version 1 and cancelled afterwards
+	createBookingWithStatusInDB(model.CONFIRMED)
+	defer deleteBookingInDB()
+	_, err := suite.client.CancelBooking(suite.ctx, &proto.CancelBookingReq{Id: 1, Actor: "customer"})
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	}
+
+	// when updating and moving it based on version 1
+	ctx := metadata.AppendToOutgoingContext(suite.ctx, "if-match", "1")
+	_, err = suite.client.UpdateBooking(ctx, &proto.UpdateBookingReq{Id: 1, CustomerId: 2, PropertyId: 2})
+
+	// then the update is rejected before the new property is reserved
+	expected := "rpc error: code = Aborted desc = Booking 1 was modified, it no longer has version 1"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+	if len(mock.Confirmed) != 0 {
+		suite.T().Errorf("Unexpected confirmations: %v", mock.Confirmed)
+	}
+
+	// when updating without If-Match
+	out, err := suite.client.UpdateBooking(suite.ctx, &proto.UpdateBookingReq{Id: 1, CustomerId: 2, Comment: "changed"})
+
+	// then the cancellation is not reverted
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.Status != "CANCELLED" || out.CustomerName != "other" || out.Comment != "changed" {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+	out, err = suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: 1})
+	if err != nil || out.Status != "CANCELLED" || out.PropertyId != 1 {
+		suite.T().Errorf("Unexpected: %v, err: %v", out, err)
+	}
+}
+
 func (suite *BookingTestSuite) TestBookingHandler_CreateBooking() {
 	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
 	defer cancel()
@@ -253,9 +713,11 @@ func (suite *BookingTestSuite) TestBookingHandler_CreateBooking() {
 	// given
 	defer deleteBookingInDB()
 	in := &proto.CreateBookingReq{
-		Comment:      "test",
-		CustomerName: "cust",
-		PropertyId:   1,
+		Comment:    "test",
+		CustomerId: 3,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 14, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 17, 10, 0, 0, 0, time.UTC)),
 	}
 
 	// when
@@ -264,29 +726,763 @@ func (suite *BookingTestSuite) TestBookingHandler_CreateBooking() {
 	// then
 	if err != nil {
 		suite.T().Errorf("Unexpected err: %v", err)
-	} else if out == nil || out.CustomerName != "cust" || out.Status != "CONFIRMED" {
+	} else if out == nil || out.CustomerName != "cust" || out.Status != "CONFIRMED" || len(out.Transitions) != 2 ||
+		!out.CheckIn.AsTime().Equal(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)) || out.Adults != 1 {
 		suite.T().Errorf("Unexpected: %v", out)
 	}
 }
 
-func (suite *BookingTestSuite) TestBookingHandler_DeleteBooking() {
-	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
-	defer cancel()
+func (suite *BookingTestSuite) TestBookingHandler_CreateBookingWithInvalidCustomer() {
+	tests := map[string]struct {
+		customerId uint32
+		expected   string
+	}{
+		"GivenNoCustomer_WhenCreateBooking_ThenReturnInvalidArgument": {
+			customerId: 0,
+			expected:   "rpc error: code = InvalidArgument desc = A booking requires the id of its customer",
+		},
+		"GivenUnknownUser_WhenCreateBooking_ThenReturnInvalidArgument": {
+			customerId: 99,
+			expected:   "rpc error: code = InvalidArgument desc = User 99 does not exist",
+		},
+		"GivenOwnerAccount_WhenCreateBooking_ThenReturnInvalidArgument": {
+			customerId: 5,
+			expected:   "rpc error: code = InvalidArgument desc = User owner (ID: 5) is no customer",
+		},
+	}
 
-	// given
+	for scenario, testData := range tests {
+		log.Infof("Scenario: %s", scenario)
+
+		_, err := suite.client.CreateBooking(suite.ctx, &proto.CreateBookingReq{
+			CustomerId: testData.customerId,
+			PropertyId: 1,
+			CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+			CheckOut:   timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+		})
+		if err == nil || err.Error() != testData.expected {
+			suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", testData.expected, err)
+		}
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_MigrateUsers() {
+	defer func() { suite.mockUserInternalServer.Accounts = getMockAccounts() }()
+
+	// given a migrated booking and bookings of earlier versions only storing the name of their customer
 	createBookingInDB()
 	defer deleteBookingInDB()
-
-	in := &proto.BookingIdReq{
-		Id: 1,
+	for i, customerName := range []string{"Donald Duck", "donald duck", "\t"} {
+		suite.Require().NoError(db.DB.Create(&model.Booking{
+			Model:        gorm.Model{ID: uint(i + 2)},
+			CustomerName: customerName,
+			Status:       model.CONFIRMED,
+			PropertyId:   1,
+		}).Error)
 	}
+	defer db.DB.Unscoped().Delete(new(model.Booking), []uint{2, 3, 4})
 
 	// when
-	_, err := suite.client.DeleteBooking(suite.ctx, in)
+	count, err := service.MigrateUsers()
+
+	// then names differing in case are linked to one account and the blank name is skipped
+	suite.Require().NoError(err)
+	suite.Equal(int64(2), count)
+	list, err := suite.client.GetBookings(suite.ctx, &proto.ListBookingsReq{CustomerId: 6})
+	suite.Require().NoError(err)
+	suite.Require().Len(list.Bookings, 2)
+	suite.Equal(list.Bookings[0].CustomerName, list.Bookings[1].CustomerName)
+	suite.Equal([]string{"CUSTOMER"}, suite.mockUserInternalServer.Accounts[6].Roles)
+
+	// when migrating again
+	count, err = service.MigrateUsers()
 
 	// then
-	if err != nil {
-		suite.T().Errorf("Unexpected err: %v", err)
+	suite.Require().NoError(err)
+	suite.Equal(int64(0), count)
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CreateBookingRetriesConfirmation() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given
+	mock := suite.mockPropertyInternalServer
+	mock.UnavailablePropertyId = 1
+	defer func() { mock.UnavailablePropertyId = 0 }()
+	defer deleteBookingInDB()
+	in := &proto.CreateBookingReq{
+		CustomerId: 3,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+	}
+
+	// when the property service is unavailable
+	out, err := suite.client.CreateBooking(suite.ctx, in)
+
+	// then the booking stays pending
+	suite.Require().NoError(err)
+	suite.Equal("PENDING", out.Status)
+
+	// when the property service is back and the confirmation is due again
+	mock.UnavailablePropertyId = 0
+	makeOutboxDueInDB()
+	processed, err := service.DispatchOutbox()
+
+	// then the saga confirms the booking
+	suite.Require().NoError(err)
+	suite.Equal(1, processed)
+	out, err = suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: out.Id})
+	suite.Require().NoError(err)
+	suite.Equal("CONFIRMED", out.Status)
+
+	// when dispatching again
+	processed, err = service.DispatchOutbox()
+
+	// then nothing is left to do
+	suite.Require().NoError(err)
+	suite.Equal(0, processed)
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CreateBookingWithIdempotencyKey() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given
+	defer deleteBookingInDB()
+	ctx := metadata.AppendToOutgoingContext(suite.ctx, "idempotency-key", "retry-1")
+	in := &proto.CreateBookingReq{
+		CustomerId: 3,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+	}
+	first, err := suite.client.CreateBooking(ctx, in)
+	suite.Require().NoError(err)
+
+	// when the request is retried
+	retried, err := suite.client.CreateBooking(ctx, in)
+
+	// then the original booking is returned and no second one is created
+	suite.Require().NoError(err)
+	suite.True(googleproto.Equal(first, retried), "Unexpected: %v", retried)
+	list, err := suite.client.GetBookings(suite.ctx, &proto.ListBookingsReq{})
+	suite.Require().NoError(err)
+	suite.Len(list.Bookings, 1)
+
+	// when the key is reused for a different request
+	in.CustomerId = 2
+	_, err = suite.client.CreateBooking(ctx, in)
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = Idempotency-Key retry-1 was already used for a different request"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+
+	// when the key is sent along with a read
+	list, err = suite.client.GetBookings(ctx, &proto.ListBookingsReq{})
+
+	// then it is ignored
+	suite.Require().NoError(err)
+	suite.Len(list.Bookings, 1)
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CreateBookingForPropertyInRequestMode() {
+	suite.mockPropertyInternalServer.ApprovalRequired = true
+	defer func() { suite.mockPropertyInternalServer.ApprovalRequired = false }()
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given
+	defer deleteBookingInDB()
+	in := &proto.CreateBookingReq{
+		CustomerId: 3,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+	}
+
+	// when
+	out, err := suite.client.CreateBooking(suite.ctx, in)
+
+	// then
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out == nil || out.Status != "PENDING" || !out.ApprovalRequired {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CreateBookingFreezesPrice() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given
+	suite.mockPropertyInternalServer.Quote = &proto.StayQuote{
+		Nights: 7, NightlyRate: 10000, Subtotal: 70000, Tax: 4900, Total: 74900, Currency: "EUR",
+	}
+	defer func() { suite.mockPropertyInternalServer.Quote = nil }()
+	defer deleteBookingInDB()
+	in := &proto.CreateBookingReq{
+		CustomerId: 3,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+	}
+
+	// when
+	out, err := suite.client.CreateBooking(suite.ctx, in)
+
+	// then
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.Price == nil || out.Price.Total != 74900 || out.Price.Currency != "EUR" {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+
+	// when the property changes its prices
+	suite.mockPropertyInternalServer.Quote = &proto.StayQuote{
+		Nights: 7, NightlyRate: 20000, Subtotal: 140000, Tax: 9800, Total: 149800, Currency: "EUR",
+	}
+	quote, err := suite.client.QuoteBooking(suite.ctx, &proto.QuoteBookingReq{PropertyId: 1, CheckIn: in.CheckIn, CheckOut: in.CheckOut})
+	if err != nil || quote.Total != 149800 {
+		suite.T().Errorf("Unexpected quote: %v, err: %v", quote, err)
+	}
+
+	// then the existing booking keeps its price
+	out, err = suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: 1})
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.Price == nil || out.Price.Total != 74900 {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+	confirmed := suite.mockPropertyInternalServer.Confirmed
+	if len(confirmed) == 0 || confirmed[len(confirmed)-1].Quote.GetTotal() != 74900 {
+		suite.T().Errorf("Unexpected confirmations: %v", confirmed)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CreateBookingDeclinesChangedPrice() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given
+	mock := suite.mockPropertyInternalServer
+	mock.Quote = &proto.StayQuote{
+		Nights: 7, NightlyRate: 10000, Subtotal: 70000, Tax: 4900, Total: 74900, Currency: "EUR",
+	}
+	mock.UnavailablePropertyId = 1
+	defer func() { mock.Quote, mock.UnavailablePropertyId = nil, 0 }()
+	defer deleteBookingInDB()
+	in := &proto.CreateBookingReq{
+		CustomerId: 3,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+	}
+
+	// when the booking is created while the property service cannot confirm it
+	out, err := suite.client.CreateBooking(suite.ctx, in)
+
+	// then the booking is pending with the quoted price
+	if err != nil {
+		suite.T().Fatalf("Unexpected err: %v", err)
+	}
+	if out.Status != "PENDING" || out.Price.GetTotal() != 74900 {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+
+	// when the property changes its prices before the confirmation is retried
+	mock.UnavailablePropertyId = 0
+	mock.Quote = &proto.StayQuote{
+		Nights: 7, NightlyRate: 20000, Subtotal: 140000, Tax: 9800, Total: 149800, Currency: "EUR",
+	}
+	makeOutboxDueInDB()
+	if _, err := service.DispatchOutbox(); err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	}
+
+	// then the confirmation is declined instead of charging the new price
+	out, err = suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: out.Id})
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.Status != "REJECTED" || out.Price.GetTotal() != 74900 {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CreateBookingWithInvalidStay() {
+	// given
+	in := &proto.CreateBookingReq{
+		CustomerId: 3,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+	}
+
+	// when
+	_, err := suite.client.CreateBooking(suite.ctx, in)
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = Check-out must be at least one day after check-in"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_DeleteBooking() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given
+	createBookingInDB()
+	defer deleteBookingInDB()
+
+	in := &proto.BookingIdReq{
+		Id: 1,
+	}
+
+	// when
+	_, err := suite.client.DeleteBooking(suite.ctx, in)
+
+	// then
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	}
+	out, err := suite.client.GetBooking(suite.ctx, in)
+	if err != nil || out.Status != "CANCELLED" {
+		suite.T().Errorf("Unexpected: %v, err: %v", out, err)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CancelBooking() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given
+	createBookingWithStatusInDB(model.CONFIRMED)
+	defer deleteBookingInDB()
+
+	in := &proto.CancelBookingReq{
+		Id:     1,
+		Actor:  "customer",
+		Reason: "change of plans",
+	}
+
+	// when
+	out, err := suite.client.CancelBooking(suite.ctx, in)
+
+	// then
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out == nil || out.Status != "CANCELLED" ||
+		len(out.Transitions) != 1 || out.Transitions[0].Reason != "change of plans" {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+
+	// when cancelling again
+	_, err = suite.client.CancelBooking(suite.ctx, in)
+
+	// then
+	expected := "rpc error: code = FailedPrecondition desc = Booking 1 cannot change from CANCELLED to CANCELLED"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CancelBookingWithTooLongReason() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	defer func() { suite.mockPropertyInternalServer.Cancelled = nil }()
+
+	// given
+	createBookingWithStatusInDB(model.CONFIRMED)
+	defer deleteBookingInDB()
+
+	// when
+	_, err := suite.client.CancelBooking(suite.ctx, &proto.CancelBookingReq{Id: 1, Actor: "customer", Reason: strings.Repeat("ä", 256)})
+
+	// then the booking keeps its reservation
+	expected := "rpc error: code = InvalidArgument desc = Reason must not be longer than 255 characters"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+	out, err := suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: 1})
+	if err != nil || out.Status != "CONFIRMED" || len(suite.mockPropertyInternalServer.Cancelled) != 0 {
+		suite.T().Errorf("Unexpected: %v, err: %v, cancelled: %v", out, err, suite.mockPropertyInternalServer.Cancelled)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CancelBookingRetriesRelease() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	mock := suite.mockPropertyInternalServer
+	defer func() { mock.FailingCancelPropertyId, mock.Cancelled = 0, nil }()
+
+	// given
+	createBookingWithStatusInDB(model.CONFIRMED)
+	defer deleteBookingInDB()
+
+	// when the property cannot be freed
+	mock.FailingCancelPropertyId = 1
+	out, err := suite.client.CancelBooking(suite.ctx, &proto.CancelBookingReq{Id: 1, Actor: "customer"})
+
+	// then the booking is cancelled anyway
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.Status != "CANCELLED" || len(mock.Cancelled) != 0 {
+		suite.T().Errorf("Unexpected: %v, cancelled: %v", out, mock.Cancelled)
+	}
+
+	// when the property service is back and the release is due again
+	mock.FailingCancelPropertyId = 0
+	makeOutboxDueInDB()
+	processed, err := service.DispatchOutbox()
+
+	// then the property is freed
+	if err != nil || processed != 1 || len(mock.Cancelled) != 1 || mock.Cancelled[0].BookingId != 1 {
+		suite.T().Errorf("Unexpected processed: %d, err: %v, cancelled: %v", processed, err, mock.Cancelled)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CreateBookingWithLongDeclineReason() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	mock := suite.mockPropertyInternalServer
+	defer func() { mock.DecliningPropertyId, mock.DeclineMessage = 0, "" }()
+
+	// given
+	mock.DecliningPropertyId, mock.DeclineMessage = 1, strings.Repeat("ä", 300)
+	defer deleteBookingInDB()
+
+	// when
+	_, err := suite.client.CreateBooking(suite.ctx, &proto.CreateBookingReq{
+		CustomerId: 3,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:   timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+	})
+
+	// then the booking is rejected with the shortened reason
+	if status.Code(err) != codes.InvalidArgument {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", codes.InvalidArgument, err)
+	}
+	out, err := suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: 1})
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.Status != "REJECTED" || len(out.Transitions) != 2 ||
+		utf8.RuneCountInString(out.Transitions[1].Reason) != 255 || !utf8.ValidString(out.Transitions[1].Reason) {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CancelBookingAppliesCancellationPolicy() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given a strict policy and a confirmed booking ten days ahead
+	suite.mockPropertyInternalServer.Policy = &proto.CancellationPolicyResp{
+		Policy: "STRICT",
+		Tiers:  []*proto.PolicyTier{{DaysBefore: 14, RefundPercent: 100}, {DaysBefore: 7, RefundPercent: 50}},
+	}
+	defer func() { suite.mockPropertyInternalServer.Policy = nil }()
+	checkIn := model.TruncateToDay(time.Now()).AddDate(0, 0, 10)
+	db.DB.Create(&model.Booking{
+		Model:        gorm.Model{ID: 1},
+		CustomerId:   1,
+		CustomerName: "customer",
+		Status:       model.CONFIRMED,
+		PropertyId:   1,
+		CheckIn:      checkIn,
+		CheckOut:     checkIn.AddDate(0, 0, 7),
+		Price:        model.Price{Nights: 7, NightlyRate: 10000, Subtotal: 70000, Tax: 4901, Total: 74901, Currency: "EUR"},
+	})
+	defer deleteBookingInDB()
+
+	// when
+	out, err := suite.client.CancelBooking(suite.ctx, &proto.CancelBookingReq{Id: 1, Actor: "customer"})
+
+	// then half of the price is refunded, rounded down
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out.Cancellation == nil || out.Cancellation.RefundPercent != 50 ||
+		out.Cancellation.Refund != 37450 || out.Cancellation.Fee != 37451 {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+
+	// and the outcome is persisted
+	out, err = suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: 1})
+	if err != nil || out.Cancellation == nil || out.Cancellation.Fee != 37451 {
+		suite.T().Errorf("Unexpected: %v, err: %v", out, err)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_JoinWaitlist() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given
+	in := &proto.JoinBookingWaitlistReq{
+		PropertyId:   1,
+		CustomerName: "customer",
+		CheckIn:      timestamppb.New(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)),
+		CheckOut:     timestamppb.New(time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)),
+	}
+
+	// when
+	out, err := suite.client.JoinWaitlist(suite.ctx, in)
+
+	// then
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if out == nil || out.Status != "WAITING" || out.PropertyId != 1 || out.CustomerName != "customer" {
+		suite.T().Errorf("Unexpected: %v", out)
+	}
+
+	// when the stay is missing
+	_, err = suite.client.JoinWaitlist(suite.ctx, &proto.JoinBookingWaitlistReq{PropertyId: 1, CustomerName: "customer"})
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = Check-in and check-out are required"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_Reconcile() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given a confirmed booking unknown to its property and a reservation for a booking that does not exist
+	mock := suite.mockPropertyInternalServer
+	checkIn := model.TruncateToDay(time.Now()).AddDate(0, 0, 3)
+	db.DB.Create(&model.Booking{
+		Model:        gorm.Model{ID: 1, UpdatedAt: time.Now().Add(-time.Hour)},
+		CustomerId:   1,
+		CustomerName: "customer",
+		Status:       model.CONFIRMED,
+		PropertyId:   1,
+		CheckIn:      checkIn,
+		CheckOut:     checkIn.AddDate(0, 0, 2),
+	})
+	defer deleteBookingInDB()
+	mock.Reservations = []*proto.ReservationEntry{{
+		BookingId:  99,
+		PropertyId: 2,
+		CheckIn:    timestamppb.New(checkIn),
+		CheckOut:   timestamppb.New(checkIn.AddDate(0, 0, 1)),
+		Status:     "CONFIRMED",
+	}}
+	mock.Cancelled = nil
+	defer func() { mock.Reservations, mock.Cancelled = nil, nil }()
+
+	// when running a dry run
+	report, err := service.Reconcile(true)
+
+	// then both discrepancies are reported but not repaired
+	suite.Require().NoError(err)
+	suite.Require().Len(report.Discrepancies, 2)
+	suite.Equal(model.ORPHANED_RESERVATION, report.Discrepancies[0].Kind)
+	suite.Equal(uint(99), report.Discrepancies[0].BookingId)
+	suite.Equal(model.MISSING_RESERVATION, report.Discrepancies[1].Kind)
+	suite.Equal(uint(1), report.Discrepancies[1].BookingId)
+	suite.Equal(2, report.Unrepaired())
+	suite.Empty(mock.Cancelled)
+
+	// when repairing
+	report, err = service.Reconcile(false)
+
+	// then the orphaned reservation is freed and the missing one is reserved again
+	suite.Require().NoError(err)
+	suite.Equal(0, report.Unrepaired())
+	suite.Require().Len(mock.Cancelled, 1)
+	suite.Equal(uint32(2), mock.Cancelled[0].PropertyId)
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_ReconcileSkipsChangedBookings() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given a confirmed booking unknown to its property, which is cancelled while it is reconciled
+	mock := suite.mockPropertyInternalServer
+	checkIn := model.TruncateToDay(time.Now()).AddDate(0, 0, 3)
+	db.DB.Create(&model.Booking{
+		Model:        gorm.Model{ID: 1, UpdatedAt: time.Now().Add(-time.Hour)},
+		CustomerId:   1,
+		CustomerName: "customer",
+		Status:       model.CONFIRMED,
+		PropertyId:   1,
+		CheckIn:      checkIn,
+		CheckOut:     checkIn.AddDate(0, 0, 2),
+	})
+	defer deleteBookingInDB()
+	listed := 0
+	mock.OnListReservations = func() {
+		listed++
+		if listed == 2 {
+			db.DB.Model(new(model.Booking)).Where("id = ?", 1).Update("status", model.CANCELLED)
+		}
+	}
+	mock.Confirmed = nil
+	defer func() { mock.OnListReservations, mock.Confirmed = nil, nil }()
+
+	// when repairing
+	report, err := service.Reconcile(false)
+
+	// then the missing reservation is reported but not reserved for the cancelled booking
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if len(report.Discrepancies) != 1 || report.Discrepancies[0].Kind != model.MISSING_RESERVATION ||
+		report.Discrepancies[0].Repaired || report.Discrepancies[0].RepairError != "Skipped, the booking is changing" {
+		suite.T().Errorf("Unexpected report: %v", report)
+	}
+	if len(mock.Confirmed) != 0 {
+		suite.T().Errorf("Unexpected confirmations: %v", mock.Confirmed)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_ReconcileSkipsRecentlyChangedBookings() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+
+	// given a confirmed booking unknown to its property, which has just been changed
+	mock := suite.mockPropertyInternalServer
+	checkIn := model.TruncateToDay(time.Now()).AddDate(0, 0, 3)
+	db.DB.Create(&model.Booking{
+		Model:        gorm.Model{ID: 1},
+		CustomerId:   1,
+		CustomerName: "customer",
+		Status:       model.CONFIRMED,
+		PropertyId:   1,
+		CheckIn:      checkIn,
+		CheckOut:     checkIn.AddDate(0, 0, 2),
+	})
+	defer deleteBookingInDB()
+	mock.Confirmed = nil
+	defer func() { mock.Confirmed = nil }()
+
+	// when repairing
+	report, err := service.Reconcile(false)
+
+	// then the booking is left to the operation that changed it
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	} else if len(report.Discrepancies) != 0 || len(mock.Confirmed) != 0 {
+		suite.T().Errorf("Unexpected report: %v, confirmations: %v", report, mock.Confirmed)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_ConfirmBookingAfterConcurrentCancel() {
+	cancel := suite.mockPropertyInternalServer.Start(propertyInternalServerPort)
+	defer cancel()
+	mock := suite.mockPropertyInternalServer
+	defer func() { mock.OnConfirmBooking, mock.Confirmed, mock.Cancelled = nil, nil, nil }()
+
+	// given a pending booking that is cancelled while the property confirms it
+	createBookingWithStatusInDB(model.PENDING)
+	defer deleteBookingInDB()
+	mock.OnConfirmBooking = func() {
+		mock.OnConfirmBooking = nil
+		if _, err := service.CancelBooking(1, "customer", ""); err != nil {
+			suite.T().Errorf("Unexpected err: %v", err)
+		}
+	}
+
+	// when
+	_, err := suite.client.ConfirmBooking(suite.ctx, &proto.BookingTransitionReq{Id: 1, Actor: "owner"})
+
+	// then the cancellation is kept and the reservation is released again
+	expected := "rpc error: code = FailedPrecondition desc = Booking 1 cannot change from CANCELLED to CONFIRMED"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+	out, err := suite.client.GetBooking(suite.ctx, &proto.BookingIdReq{Id: 1})
+	if err != nil || out.Status != "CANCELLED" || len(mock.Cancelled) != 1 || mock.Cancelled[0].PropertyId != 1 {
+		suite.T().Errorf("Unexpected: %v, err: %v, cancelled: %v", out, err, mock.Cancelled)
+	}
+}
+
+func (suite *BookingTestSuite) TestBookingHandler_CheckInBooking() {
+	type expectation struct {
+		out *proto.BookingResp
+		err error
+	}
+
+	tests := map[string]struct {
+		in           *proto.BookingTransitionReq
+		setupFunc    func()
+		tearDownFunc func()
+		expected     expectation
+	}{
+		"GivenNoActor_WhenCheckInBooking_ThenReturnInvalidArgument": {
+			in:           &proto.BookingTransitionReq{Id: 1},
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Actor is required"),
+			},
+		},
+		"GivenNoBooking_WhenCheckInBooking_ThenReturnNotFound": {
+			in:           &proto.BookingTransitionReq{Id: 1, Actor: "owner"},
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = NotFound desc = Booking not found"),
+			},
+		},
+		"GivenPendingBooking_WhenCheckInBooking_ThenReturnFailedPrecondition": {
+			in: &proto.BookingTransitionReq{Id: 1, Actor: "owner"},
+			setupFunc: func() {
+				createBookingWithStatusInDB(model.PENDING)
+			},
+			tearDownFunc: func() {
+				deleteBookingInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = FailedPrecondition desc = Booking 1 cannot change from PENDING to CHECKED_IN"),
+			},
+		},
+		"GivenConfirmedBooking_WhenCheckInBooking_ThenReturnCheckedInBooking": {
+			in: &proto.BookingTransitionReq{Id: 1, Actor: "owner"},
+			setupFunc: func() {
+				createBookingWithStatusInDB(model.CONFIRMED)
+			},
+			tearDownFunc: func() {
+				deleteBookingInDB()
+			},
+			expected: expectation{
+				out: &proto.BookingResp{Status: "CHECKED_IN"},
+				err: nil,
+			},
+		},
+	}
+
+	for scenario, testData := range tests {
+		log.Infof("Scenario: %s", scenario)
+
+		if testData.setupFunc != nil {
+			testData.setupFunc()
+		}
+
+		out, err := suite.client.CheckInBooking(suite.ctx, testData.in)
+		if err != nil {
+			if testData.expected.err == nil || testData.expected.err.Error() != err.Error() {
+				suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", testData.expected.err, err)
+			}
+		} else if out == nil ||
+			out.Status != testData.expected.out.Status ||
+			len(out.Transitions) != 1 || out.Transitions[0].Actor != "owner" {
+			suite.T().Errorf("Out:\n Expected: %v\n Actual: %v", testData.expected.out, out)
+		}
+
+		if testData.tearDownFunc != nil {
+			testData.tearDownFunc()
+		}
 	}
 }
 
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/service"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *BookingHandler) CreateGroupBooking(_ context.Context, req *proto.CreateGroupBookingReq) (*proto.GroupBookingResp, error) {
+	if req.CheckIn == nil || req.CheckOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
+	group := model.BookingGroup{
+		Comment:    req.Comment,
+		CustomerId: uint(req.CustomerId),
+	}
+	propertyIds := make([]uint, len(req.PropertyIds))
+	for i, propertyId := range req.PropertyIds {
+		propertyIds[i] = uint(propertyId)
+	}
+
+	err := service.CreateGroupBooking(&group, propertyIds, req.CheckIn.AsTime(), req.CheckOut.AsTime())
+	if err != nil {
+		log.Errorf("Error calling service CreateGroupBooking: %v", err)
+		return nil, mapServiceError(err)
+	}
+	return mapToProtoGroupBookingResp(&group), nil
+}
+
+func (h *BookingHandler) GetGroupBooking(_ context.Context, req *proto.GroupBookingIdReq) (*proto.GroupBookingResp, error) {
+	group, err := service.GetGroupBooking(uint(req.Id))
+	if err != nil {
+		log.Errorf("Error calling service GetGroupBooking with ID %v: %v", req.Id, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "Group booking not found")
+	}
+	return mapToProtoGroupBookingResp(group), nil
+}
+
+func (h *BookingHandler) CancelGroupBooking(_ context.Context, req *proto.CancelGroupBookingReq) (*proto.GroupBookingResp, error) {
+	if req.Actor == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Actor is required")
+	}
+	if err := checkReason(req.Reason); err != nil {
+		return nil, err
+	}
+
+	group, err := service.CancelGroupBooking(uint(req.Id), req.Actor, req.Reason)
+	if err != nil {
+		log.Errorf("Error calling service CancelGroupBooking with ID %v: %v", req.Id, err)
+		return nil, mapServiceError(err)
+	}
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "Group booking not found")
+	}
+	return mapToProtoGroupBookingResp(group), nil
+}
+
+func mapServiceError(err error) error {
+	var bookingError *model.BookingError
+	if errors.As(err, &bookingError) {
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	var transitionError *model.TransitionError
+	if errors.As(err, &transitionError) {
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	}
+	return mapPropertyServiceError(err)
+}
@@ -6,12 +6,41 @@ import (
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"net"
+	"time"
 )
 
 type MockPropertyInternalServer struct {
 	proto.PropertyInternalServer
+	// simulates a property in request mode
+	ApprovalRequired bool
+	// returned as price of every stay
+	Quote *proto.StayQuote
+	// simulates a property that declines bookings
+	DecliningPropertyId uint32
+	// replaces the message of the declines of DecliningPropertyId if set
+	DeclineMessage string
+	// simulates a property that is already booked for the stay starting at that day
+	DecliningCheckIn time.Time
+	// simulates a property that cannot be reached for confirmations
+	UnavailablePropertyId uint32
+	// simulates a property whose reservations cannot be cancelled
+	FailingCancelPropertyId uint32
+	// returned as cancellation policy of every property, defaults to a full refund up to check-in
+	Policy *proto.CancellationPolicyResp
+	// returned as reservations of all properties
+	Reservations []*proto.ReservationEntry
+	// called before the reservations are listed, e.g. to change bookings while they are reconciled
+	OnListReservations func()
+	// called before a booking is confirmed, e.g. to change the booking while it is confirmed
+	OnConfirmBooking func()
+	// records the successful confirmations
+	Confirmed []*proto.BookingReq
+	// records the successful cancellations
+	Cancelled []*proto.BookingReq
 }
 
 // Start creates and starts a mock PropertyInternalServer that listens on the given port
@@ -37,10 +66,68 @@ func (h *MockPropertyInternalServer) Start(port string) func() {
 	return closer
 }
 
-func (h *MockPropertyInternalServer) ConfirmBooking(_ context.Context, _ *proto.BookingReq) (*emptypb.Empty, error) {
-	return new(emptypb.Empty), nil
+func (h *MockPropertyInternalServer) ConfirmBooking(_ context.Context, req *proto.BookingReq) (*proto.BookingConfirmationResp, error) {
+	if h.OnConfirmBooking != nil {
+		h.OnConfirmBooking()
+	}
+	if h.UnavailablePropertyId != 0 && req.PropertyId == h.UnavailablePropertyId {
+		return nil, status.Errorf(codes.Unavailable, "Property %d is unavailable", req.PropertyId)
+	}
+	if h.DecliningPropertyId != 0 && req.PropertyId == h.DecliningPropertyId {
+		if h.DeclineMessage != "" {
+			return nil, status.Error(codes.InvalidArgument, h.DeclineMessage)
+		}
+		return nil, status.Errorf(codes.InvalidArgument, "Property %d is already booked", req.PropertyId)
+	}
+	if req.CheckIn.AsTime().Equal(h.DecliningCheckIn) {
+		return nil, status.Errorf(codes.InvalidArgument, "Property %d is already booked on %s", req.PropertyId, h.DecliningCheckIn.Format(time.DateOnly))
+	}
+	if req.Quote != nil && h.Quote != nil && req.Quote.Total != h.Quote.Total {
+		return nil, status.Errorf(codes.FailedPrecondition, "The price of the stay changed from %d to %d", req.Quote.Total, h.Quote.Total)
+	}
+	h.Confirmed = append(h.Confirmed, req)
+	return &proto.BookingConfirmationResp{ApprovalRequired: h.ApprovalRequired, Quote: h.Quote}, nil
+}
+
+func (h *MockPropertyInternalServer) QuoteStay(_ context.Context, _ *proto.BookingReq) (*proto.StayQuote, error) {
+	if h.Quote == nil {
+		return new(proto.StayQuote), nil
+	}
+	return h.Quote, nil
 }
 
-func (h *MockPropertyInternalServer) CancelBooking(_ context.Context, _ *proto.BookingReq) (*emptypb.Empty, error) {
+func (h *MockPropertyInternalServer) CancelBooking(_ context.Context, req *proto.BookingReq) (*emptypb.Empty, error) {
+	if h.FailingCancelPropertyId != 0 && req.PropertyId == h.FailingCancelPropertyId {
+		return nil, status.Errorf(codes.Unavailable, "Property %d is unavailable", req.PropertyId)
+	}
+	h.Cancelled = append(h.Cancelled, req)
 	return new(emptypb.Empty), nil
 }
+
+func (h *MockPropertyInternalServer) AddToWaitlist(_ context.Context, req *proto.WaitlistReq) (*proto.WaitlistEntry, error) {
+	return &proto.WaitlistEntry{
+		Id:           1,
+		PropertyId:   req.PropertyId,
+		CustomerName: req.CustomerName,
+		CheckIn:      req.CheckIn,
+		CheckOut:     req.CheckOut,
+		Status:       "WAITING",
+	}, nil
+}
+
+func (h *MockPropertyInternalServer) GetCancellationPolicy(_ context.Context, _ *proto.BookingReq) (*proto.CancellationPolicyResp, error) {
+	if h.Policy != nil {
+		return h.Policy, nil
+	}
+	return &proto.CancellationPolicyResp{
+		Policy: "CUSTOM",
+		Tiers:  []*proto.PolicyTier{{DaysBefore: 0, RefundPercent: 100}},
+	}, nil
+}
+
+func (h *MockPropertyInternalServer) ListReservations(_ context.Context, _ *proto.ListReservationsReq) (*proto.ReservationList, error) {
+	if h.OnListReservations != nil {
+		h.OnListReservations()
+	}
+	return &proto.ReservationList{Reservations: h.Reservations}, nil
+}
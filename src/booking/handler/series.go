@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/service"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *BookingHandler) CreateBookingSeries(_ context.Context, req *proto.CreateBookingSeriesReq) (*proto.BookingSeriesResp, error) {
+	if req.CheckIn == nil || req.CheckOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
+	series := model.BookingSeries{
+		Comment:    req.Comment,
+		CustomerId: uint(req.CustomerId),
+		PropertyId: uint(req.PropertyId),
+		Count:      uint(req.Count),
+	}
+	if req.Until != nil {
+		until := req.Until.AsTime()
+		series.Until = &until
+	}
+	if err := series.SetFrequency(req.Frequency); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	guests := model.Guests{Adults: req.Adults, Children: req.Children, Pets: req.Pets}
+
+	err := service.CreateBookingSeries(&series, req.CheckIn.AsTime(), req.CheckOut.AsTime(), guests)
+	if err != nil {
+		log.Errorf("Error calling service CreateBookingSeries: %v", err)
+		return nil, mapServiceError(err)
+	}
+	return mapToProtoBookingSeriesResp(&series), nil
+}
+
+func (h *BookingHandler) GetBookingSeries(_ context.Context, req *proto.BookingSeriesIdReq) (*proto.BookingSeriesResp, error) {
+	series, err := service.GetBookingSeries(uint(req.Id))
+	if err != nil {
+		log.Errorf("Error calling service GetBookingSeries with ID %v: %v", req.Id, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if series == nil {
+		return nil, status.Errorf(codes.NotFound, "Booking series not found")
+	}
+	return mapToProtoBookingSeriesResp(series), nil
+}
+
+func (h *BookingHandler) CancelBookingSeries(_ context.Context, req *proto.CancelBookingSeriesReq) (*proto.BookingSeriesResp, error) {
+	if err := checkReason(req.Reason); err != nil {
+		return nil, err
+	}
+	return cancelSeries(req.Id, req.Actor, "CancelBookingSeries", func() (*model.BookingSeries, error) {
+		return service.CancelBookingSeries(uint(req.Id), req.Actor, req.Reason)
+	})
+}
+
+func (h *BookingHandler) CancelSeriesOccurrence(_ context.Context, req *proto.CancelSeriesOccurrenceReq) (*proto.BookingSeriesResp, error) {
+	if err := checkReason(req.Reason); err != nil {
+		return nil, err
+	}
+	return cancelSeries(req.Id, req.Actor, "CancelSeriesOccurrence", func() (*model.BookingSeries, error) {
+		return service.CancelSeriesOccurrence(uint(req.Id), uint(req.BookingId), req.Actor, req.Reason)
+	})
+}
+
+// cancelSeries calls the given service function on behalf of the given actor and returns the updated series
+func cancelSeries(id uint32, actor string, serviceName string, cancel func() (*model.BookingSeries, error)) (*proto.BookingSeriesResp, error) {
+	if actor == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Actor is required")
+	}
+
+	series, err := cancel()
+	if err != nil {
+		log.Errorf("Error calling service %s with ID %v: %v", serviceName, id, err)
+		return nil, mapServiceError(err)
+	}
+	if series == nil {
+		return nil, status.Errorf(codes.NotFound, "Booking series not found")
+	}
+	return mapToProtoBookingSeriesResp(series), nil
+}
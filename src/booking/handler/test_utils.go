@@ -9,7 +9,9 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/gorm"
 	"net"
+	"time"
 )
 
 // creates and starts a BookingExternalServer and returns a client that is connected to it and can be used for tests
@@ -17,7 +19,7 @@ func startBookingExternalServer(ctx context.Context) (proto.BookingExternalClien
 	buffer := 1024 * 1024
 	lis := bufconn.Listen(buffer)
 
-	baseServer := grpc.NewServer()
+	baseServer := grpc.NewServer(grpc.UnaryInterceptor(IdempotencyInterceptor))
 	proto.RegisterBookingExternalServer(baseServer, new(BookingHandler))
 	go func() {
 		if err := baseServer.Serve(lis); err != nil {
@@ -66,16 +68,56 @@ func getMockBookingResp(customerName string) *proto.BookingResp {
 	}
 }
 
+// getMockAccounts returns the accounts of the mock user service, the customer of the bookings has ID 1
+func getMockAccounts() map[uint32]*proto.Account {
+	return map[uint32]*proto.Account{
+		1: {Id: 1, Name: "customer", Roles: []string{"CUSTOMER"}},
+		2: {Id: 2, Name: "other", Roles: []string{"CUSTOMER", "OWNER"}},
+		3: {Id: 3, Name: "cust", Roles: []string{"CUSTOMER"}},
+		4: {Id: 4, Name: "team", Roles: []string{"CUSTOMER"}},
+		5: {Id: 5, Name: "owner", Roles: []string{"OWNER"}},
+	}
+}
+
 func createBookingInDB() {
+	createBookingWithStatusInDB(model.PENDING)
+}
+
+func createBookingWithStatusInDB(status model.Status) {
 	booking := model.Booking{
+		Model:        gorm.Model{ID: 1},
 		Comment:      "comment",
+		CustomerId:   1,
 		CustomerName: "customer",
-		Status:       "PENDING",
+		Status:       status,
 		PropertyId:   1,
+		CheckIn:      time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC),
+		CheckOut:     time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC),
 	}
 	db.DB.Create(&booking)
 }
 
 func deleteBookingInDB() {
-	db.DB.Delete(new(model.Booking), 1)
+	db.DB.Unscoped().Where("booking_id = ?", 1).Delete(new(model.BookingTransition))
+	db.DB.Unscoped().Delete(new(model.Booking), 1)
+}
+
+// makeOutboxDueInDB lets the dispatcher process all pending outbox messages right away
+func makeOutboxDueInDB() {
+	db.DB.Model(new(model.OutboxMessage)).Where("processed_at IS NULL").
+		Update("next_attempt_at", time.Now().Add(-time.Second))
+}
+
+func deleteGroupBookingsInDB() {
+	db.DB.Unscoped().Where("booking_id IN (?)", db.DB.Model(new(model.Booking)).Select("id").Where("group_id IS NOT NULL")).
+		Delete(new(model.BookingTransition))
+	db.DB.Unscoped().Where("group_id IS NOT NULL").Delete(new(model.Booking))
+	db.DB.Unscoped().Where("1 = 1").Delete(new(model.BookingGroup))
+}
+
+func deleteBookingSeriesInDB() {
+	db.DB.Unscoped().Where("booking_id IN (?)", db.DB.Model(new(model.Booking)).Select("id").Where("series_id IS NOT NULL")).
+		Delete(new(model.BookingTransition))
+	db.DB.Unscoped().Where("series_id IS NOT NULL").Delete(new(model.Booking))
+	db.DB.Unscoped().Where("1 = 1").Delete(new(model.BookingSeries))
 }
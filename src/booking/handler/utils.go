@@ -1,19 +1,173 @@
 package handler
 
 import (
+	"context"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 func mapToProtoBookingResp(booking *model.Booking) *proto.BookingResp {
+	var transitions []*proto.BookingTransitionResp
+	for _, transition := range booking.Transitions {
+		transitions = append(transitions, &proto.BookingTransitionResp{
+			FromStatus: string(transition.FromStatus),
+			ToStatus:   string(transition.ToStatus),
+			Actor:      transition.Actor,
+			CreatedAt:  timestamppb.New(transition.CreatedAt),
+			Reason:     transition.Reason,
+		})
+	}
+
+	var groupId, seriesId uint32
+	if booking.GroupId != nil {
+		groupId = uint32(*booking.GroupId)
+	}
+	if booking.SeriesId != nil {
+		seriesId = uint32(*booking.SeriesId)
+	}
+	var cancellation *proto.BookingCancellationResp
+	if booking.Status == model.CANCELLED {
+		cancellation = &proto.BookingCancellationResp{
+			RefundPercent: booking.Cancellation.RefundPercent,
+			Refund:        booking.Cancellation.Refund,
+			Fee:           booking.Cancellation.Fee,
+		}
+	}
+
 	return &proto.BookingResp{
-		Id:           uint32(booking.ID),
-		Comment:      booking.Comment,
-		CustomerName: booking.CustomerName,
-		Status:       string(booking.Status),
-		PropertyId:   uint32(booking.PropertyId),
-		CreatedAt:    timestamppb.New(booking.CreatedAt),
-		UpdatedAt:    timestamppb.New(booking.UpdatedAt),
+		Id:               uint32(booking.ID),
+		Comment:          booking.Comment,
+		CustomerName:     booking.CustomerName,
+		CustomerId:       uint32(booking.CustomerId),
+		Status:           string(booking.Status),
+		PropertyId:       uint32(booking.PropertyId),
+		CreatedAt:        timestamppb.New(booking.CreatedAt),
+		UpdatedAt:        timestamppb.New(booking.UpdatedAt),
+		CheckIn:          timestamppb.New(booking.CheckIn),
+		CheckOut:         timestamppb.New(booking.CheckOut),
+		Transitions:      transitions,
+		ApprovalRequired: booking.ApprovalRequired,
+		Price:            mapToProtoBookingPriceResp(&booking.Price),
+		Adults:           booking.Guests.Adults,
+		Children:         booking.Guests.Children,
+		Pets:             booking.Guests.Pets,
+		GroupId:          groupId,
+		SeriesId:         seriesId,
+		Cancellation:     cancellation,
+		Etag:             strconv.FormatUint(uint64(booking.Version), 10),
+	}
+}
+
+func mapToProtoGroupBookingResp(group *model.BookingGroup) *proto.GroupBookingResp {
+	var bookings []*proto.BookingResp
+	for _, booking := range group.Bookings {
+		bookings = append(bookings, mapToProtoBookingResp(&booking))
+	}
+
+	return &proto.GroupBookingResp{
+		Id:           uint32(group.ID),
+		Comment:      group.Comment,
+		CustomerName: group.CustomerName,
+		CustomerId:   uint32(group.CustomerId),
+		Bookings:     bookings,
+		CreatedAt:    timestamppb.New(group.CreatedAt),
+	}
+}
+
+func mapToProtoBookingPriceResp(price *model.Price) *proto.BookingPriceResp {
+	if !price.IsQuoted() {
+		return nil
+	}
+	return &proto.BookingPriceResp{
+		Nights:      price.Nights,
+		NightlyRate: price.NightlyRate,
+		CleaningFee: price.CleaningFee,
+		Subtotal:    price.Subtotal,
+		Tax:         price.Tax,
+		Total:       price.Total,
+		Currency:    price.Currency,
+	}
+}
+
+func mapToProtoBookingWaitlistEntryResp(waitlistEntry *proto.WaitlistEntry) *proto.BookingWaitlistEntryResp {
+	return &proto.BookingWaitlistEntryResp{
+		Id:             waitlistEntry.Id,
+		PropertyId:     waitlistEntry.PropertyId,
+		CustomerName:   waitlistEntry.CustomerName,
+		CheckIn:        waitlistEntry.CheckIn,
+		CheckOut:       waitlistEntry.CheckOut,
+		Status:         waitlistEntry.Status,
+		HoldToken:      waitlistEntry.HoldToken,
+		OfferExpiresAt: waitlistEntry.OfferExpiresAt,
+		CreatedAt:      waitlistEntry.CreatedAt,
+	}
+}
+
+func mapToProtoBookingSeriesResp(series *model.BookingSeries) *proto.BookingSeriesResp {
+	var bookings []*proto.BookingResp
+	var conflicts []*proto.SeriesConflictResp
+	for _, booking := range series.Bookings {
+		bookings = append(bookings, mapToProtoBookingResp(&booking))
+		if booking.Status == model.REJECTED {
+			conflicts = append(conflicts, &proto.SeriesConflictResp{
+				BookingId: uint32(booking.ID),
+				CheckIn:   timestamppb.New(booking.CheckIn),
+				CheckOut:  timestamppb.New(booking.CheckOut),
+				Reason:    booking.RejectionReason(),
+			})
+		}
+	}
+
+	resp := &proto.BookingSeriesResp{
+		Id:           uint32(series.ID),
+		Comment:      series.Comment,
+		CustomerName: series.CustomerName,
+		CustomerId:   uint32(series.CustomerId),
+		PropertyId:   uint32(series.PropertyId),
+		Frequency:    string(series.Frequency),
+		Count:        uint32(series.Count),
+		Bookings:     bookings,
+		Conflicts:    conflicts,
+		CreatedAt:    timestamppb.New(series.CreatedAt),
+	}
+	if series.Until != nil {
+		resp.Until = timestamppb.New(*series.Until)
+	}
+	return resp
+}
+
+// ifMatchHeader is the gRPC metadata key to which the proxy forwards the If-Match HTTP header
+const ifMatchHeader = "if-match"
+
+// getExpectedVersion parses the ETag sent via If-Match, 0 means that the client did not expect a version
+// NOTE: Quotes are optional, so that gRPC clients can send the etag of the response as is
+func getExpectedVersion(ctx context.Context) (uint, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(ifMatchHeader)) == 0 {
+		return 0, nil
+	}
+	etag := strings.TrimSpace(md.Get(ifMatchHeader)[0])
+	if etag == "*" {
+		return 0, nil
+	}
+	version, err := strconv.ParseUint(strings.Trim(etag, `"`), 10, 32)
+	if err != nil || version == 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "Invalid If-Match %s, expected the etag of the booking", etag)
+	}
+	return uint(version), nil
+}
+
+// checkReason rejects reasons that do not fit into the history of a booking
+func checkReason(reason string) error {
+	if utf8.RuneCountInString(reason) > model.MaxReasonLength {
+		return status.Errorf(codes.InvalidArgument, "Reason must not be longer than %d characters", model.MaxReasonLength)
 	}
+	return nil
 }
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/service"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func (h *BookingHandler) JoinWaitlist(_ context.Context, req *proto.JoinBookingWaitlistReq) (*proto.BookingWaitlistEntryResp, error) {
+	if req.CheckIn == nil || req.CheckOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
+	waitlistEntry, err := service.JoinWaitlist(&proto.WaitlistReq{
+		PropertyId:   req.PropertyId,
+		CustomerName: req.CustomerName,
+		CheckIn:      req.CheckIn,
+		CheckOut:     req.CheckOut,
+	})
+	if err != nil {
+		log.Errorf("Error calling service JoinWaitlist: %v", err)
+		return nil, mapPropertyServiceError(err)
+	}
+	return mapToProtoBookingWaitlistEntryResp(waitlistEntry), nil
+}
+
+func (h *BookingHandler) LeaveWaitlist(_ context.Context, req *proto.LeaveBookingWaitlistReq) (*emptypb.Empty, error) {
+	err := service.LeaveWaitlist(&proto.WaitlistReq{
+		Id:           req.Id,
+		PropertyId:   req.PropertyId,
+		CustomerName: req.CustomerName,
+	})
+	if err != nil {
+		log.Errorf("Error calling service LeaveWaitlist: %v", err)
+		return nil, mapPropertyServiceError(err)
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (h *BookingHandler) ListWaitlist(_ context.Context, req *proto.ListBookingWaitlistReq) (*proto.ListBookingWaitlistResp, error) {
+	if req.CustomerName == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Customer name is required")
+	}
+
+	waitlist, err := service.GetWaitlist(&proto.WaitlistReq{
+		PropertyId:   req.PropertyId,
+		CustomerName: req.CustomerName,
+	})
+	if err != nil {
+		log.Errorf("Error calling service GetWaitlist: %v", err)
+		return nil, mapPropertyServiceError(err)
+	}
+
+	var entries []*proto.BookingWaitlistEntryResp
+	for _, waitlistEntry := range waitlist {
+		entries = append(entries, mapToProtoBookingWaitlistEntryResp(waitlistEntry))
+	}
+	return &proto.ListBookingWaitlistResp{Entries: entries}, nil
+}
+
+// mapPropertyServiceError passes on errors of the property service with their original code
+func mapPropertyServiceError(err error) error {
+	if propertyStatus, ok := status.FromError(err); ok {
+		return propertyStatus.Err()
+	}
+	return status.Errorf(codes.Internal, err.Error())
+}
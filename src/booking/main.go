@@ -5,6 +5,7 @@ import (
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/db"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/handler"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/service"
 	"google.golang.org/grpc"
 	"net"
 	"os"
@@ -30,15 +31,30 @@ func init() {
 var port = os.Getenv("PORT")
 
 // main creates a gRPC server for all requests related to bookings
+// NOTE: `booking reconcile [-dry-run]` reconciles the bookings with the property service once instead,
+// `booking migrate-users` links the bookings of earlier versions to user accounts
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-users" {
+		os.Exit(runMigrateUsers())
+	}
+
 	log.Info("Starting goBooking booking gRPC server")
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
 		log.Fatalf("Failed to listen on gRPC port %s: %v", port, err)
 	}
-	grpcServer := grpc.NewServer()
+	stopOutboxDispatcher := service.StartOutboxDispatcher()
+	defer stopOutboxDispatcher()
+	stopReconciler := service.StartReconciler()
+	defer stopReconciler()
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(handler.IdempotencyInterceptor))
 	bookingHandler := new(handler.BookingHandler)
 	proto.RegisterBookingExternalServer(grpcServer, bookingHandler)
+	proto.RegisterBookingInternalServer(grpcServer, bookingHandler)
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
@@ -1,26 +1,88 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
 
 type Status string
 
 const (
-	PENDING   Status = "PENDING"
-	CONFIRMED Status = "CONFIRMED"
+	PENDING    Status = "PENDING"
+	CONFIRMED  Status = "CONFIRMED"
+	REJECTED   Status = "REJECTED"
+	CANCELLED  Status = "CANCELLED"
+	CHECKED_IN Status = "CHECKED_IN"
+	COMPLETED  Status = "COMPLETED"
+	EXPIRED    Status = "EXPIRED"
 )
 
+// ParseStatus returns the status with the given name
+func ParseStatus(name string) (Status, error) {
+	switch status := Status(name); status {
+	case PENDING, CONFIRMED, REJECTED, CANCELLED, CHECKED_IN, COMPLETED, EXPIRED:
+		return status, nil
+	}
+	return "", &BookingError{Message: fmt.Sprintf("Unknown status %s, expected PENDING, CONFIRMED, REJECTED, CANCELLED, CHECKED_IN, COMPLETED or EXPIRED", name)}
+}
+
 type Booking struct {
 	gorm.Model
-	Comment      string `gorm:"notNull;size:100"`
+	Comment string `gorm:"notNull;size:100"`
+	// account of the customer in the user service, 0 until bookings of earlier versions are migrated
+	CustomerId uint `gorm:"notNull;default:0;index"`
+	// name of the account of the customer
 	CustomerName string `gorm:"notNull;size:60"`
-	Status       `gorm:"notNull;type:ENUM('PENDING', 'CONFIRMED')"`
-	PropertyId   uint `gorm:"notNull"`
+	Status       `gorm:"notNull;type:ENUM('PENDING', 'CONFIRMED', 'REJECTED', 'CANCELLED', 'CHECKED_IN', 'COMPLETED', 'EXPIRED')"`
+	PropertyId   uint      `gorm:"notNull"`
+	CheckIn      time.Time `gorm:"notNull"`
+	CheckOut     time.Time `gorm:"notNull"`
+	// token of a hold on the property that is consumed when the booking is confirmed
+	HoldToken string `gorm:"size:32"`
+	// set while the owner of a property in request mode has not decided about the booking yet
+	ApprovalRequired bool `gorm:"notNull;default:false"`
+	Transitions      []BookingTransition
+	Price            Price  `gorm:"embedded;embeddedPrefix:price_"`
+	Guests           Guests `gorm:"embedded;embeddedPrefix:guests_"`
+	// set if the booking is part of a group booking
+	GroupId *uint `gorm:"index"`
+	// set if the booking is an occurrence of a booking series
+	SeriesId *uint `gorm:"index"`
+	// set when a confirmed booking is cancelled
+	Cancellation Cancellation `gorm:"embedded;embeddedPrefix:cancellation_"`
+	// incremented by every update, exposed as ETag
+	Version uint `gorm:"notNull;default:1"`
 }
 
 func (booking *Booking) SetStatusPending() {
 	booking.Status = PENDING
 }
 
-func (booking *Booking) SetStatusConfirmed() {
-	booking.Status = CONFIRMED
+// HoldsReservation checks whether the property service keeps a reservation for the booking in its current status
+// NOTE: Pending bookings only hold a tentative reservation while they await the approval of the owner
+func (booking *Booking) HoldsReservation() bool {
+	return booking.Status == CONFIRMED || booking.Status == CHECKED_IN ||
+		(booking.Status == PENDING && booking.ApprovalRequired)
+}
+
+// RejectionReason returns the reason recorded when the booking was rejected
+func (booking *Booking) RejectionReason() string {
+	for _, transition := range booking.Transitions {
+		if transition.ToStatus == REJECTED {
+			return transition.Reason
+		}
+	}
+	return ""
+}
+
+// Nights returns the number of nights between check-in and check-out
+func (booking *Booking) Nights() int {
+	return int(booking.CheckOut.Sub(booking.CheckIn).Hours() / 24)
+}
+
+// TruncateToDay returns midnight UTC of the day the given time falls on
+func TruncateToDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
 }
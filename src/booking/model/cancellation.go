@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Cancellation records the outcome of the cancellation policy of the property when a confirmed booking is cancelled
+// NOTE: Amounts are in minor units of the currency of the price, the fee is what remains of the price after the refund
+type Cancellation struct {
+	RefundPercent uint32 `gorm:"notNull;default:0"`
+	Refund        int64  `gorm:"notNull;default:0"`
+	Fee           int64  `gorm:"notNull;default:0"`
+}
+
+// RefundTier refunds RefundPercent of the price if a booking is cancelled at least DaysBefore days before check-in
+type RefundTier struct {
+	DaysBefore    uint32
+	RefundPercent uint32
+}
+
+// ApplyCancellationPolicy computes the refund of the booking if it is cancelled at the given point in time
+// according to the given tiers, which have to be ordered from the earliest cancellation to the latest
+// NOTE: Refunds are rounded down to whole minor units, cancellations after check-in are not refunded
+func (booking *Booking) ApplyCancellationPolicy(tiers []RefundTier, now time.Time) {
+	daysBefore := int(booking.CheckIn.Sub(TruncateToDay(now)).Hours() / 24)
+
+	var refundPercent uint32
+	for _, tier := range tiers {
+		if daysBefore >= int(tier.DaysBefore) {
+			refundPercent = tier.RefundPercent
+			break
+		}
+	}
+
+	refund := booking.Price.Total * int64(refundPercent) / 100
+	booking.Cancellation = Cancellation{
+		RefundPercent: refundPercent,
+		Refund:        refund,
+		Fee:           booking.Price.Total - refund,
+	}
+}
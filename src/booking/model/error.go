@@ -0,0 +1,31 @@
+package model
+
+import "fmt"
+
+type BookingError struct {
+	Message string
+}
+
+func (e *BookingError) Error() string {
+	return fmt.Sprintf("%s", e.Message)
+}
+
+type TransitionError struct {
+	BookingId uint
+	From      Status
+	To        Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Booking %d cannot change from %s to %s", e.BookingId, e.From, e.To)
+}
+
+// VersionConflictError signals that a booking was modified since the client retrieved the expected version
+type VersionConflictError struct {
+	Id              uint
+	ExpectedVersion uint
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("Booking %d was modified, it no longer has version %d", e.Id, e.ExpectedVersion)
+}
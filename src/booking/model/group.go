@@ -0,0 +1,12 @@
+package model
+
+import "gorm.io/gorm"
+
+// BookingGroup bundles the bookings of several properties for the same stay that are confirmed all-or-nothing
+type BookingGroup struct {
+	gorm.Model
+	Comment      string    `gorm:"notNull;size:100"`
+	CustomerId   uint      `gorm:"notNull;default:0;index"`
+	CustomerName string    `gorm:"notNull;size:60"`
+	Bookings     []Booking `gorm:"foreignKey:GroupId"`
+}
@@ -0,0 +1,9 @@
+package model
+
+// Guests counts the people and pets coming for a booking
+// NOTE: Bookings without guest count are assumed to be for one adult
+type Guests struct {
+	Adults   uint32 `gorm:"notNull;default:1"`
+	Children uint32 `gorm:"notNull;default:0"`
+	Pets     uint32 `gorm:"notNull;default:0"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type OutboxAction string
+
+const (
+	// CONFIRM_BOOKING reserves the property for a pending booking
+	CONFIRM_BOOKING OutboxAction = "CONFIRM_BOOKING"
+	// RELEASE_PROPERTY frees the property again if a booking could not be confirmed
+	RELEASE_PROPERTY OutboxAction = "RELEASE_PROPERTY"
+)
+
+// OutboxMessage records a step of the booking saga which still has to be carried out at the property service
+// NOTE: Messages are written in the same transaction as the change of the booking that requires them,
+// so that no step is lost if the booking service stops. Processed messages are kept with ProcessedAt.
+type OutboxMessage struct {
+	gorm.Model
+	BookingId     uint         `gorm:"notNull;index"`
+	PropertyId    uint         `gorm:"notNull"`
+	Action        OutboxAction `gorm:"notNull;size:20"`
+	Attempts      uint         `gorm:"notNull;default:0"`
+	NextAttemptAt time.Time    `gorm:"notNull;index"`
+	LastError     string       `gorm:"notNull;size:255"`
+	ProcessedAt   *time.Time   `gorm:"index"`
+}
+
+func (message *OutboxMessage) IsProcessed() bool {
+	return message.ProcessedAt != nil
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// PageRequest selects a page of a list in the given order
+// NOTE: PageToken is empty for the first page and the token returned with the previous page otherwise,
+// OrderBy lists fields separated by commas, each optionally followed by "desc", e.g. "check_in desc,id"
+type PageRequest struct {
+	PageSize  uint32
+	PageToken string
+	OrderBy   string
+}
+
+// BookingFilter restricts a list of bookings, zero values do not restrict it
+// NOTE: Cancelled bookings are only included if IncludeCancelled is set or Statuses contains CANCELLED.
+// CreatedAfter is inclusive, CreatedBefore is exclusive.
+type BookingFilter struct {
+	IncludeCancelled bool
+	Statuses         []Status
+	PropertyId       uint
+	CustomerId       uint
+	CreatedAfter     time.Time
+	CreatedBefore    time.Time
+}
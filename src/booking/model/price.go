@@ -0,0 +1,19 @@
+package model
+
+// Price is the quoted price of a booking, all amounts are in minor units of the currency, e.g. cents
+// NOTE: The price is quoted when the booking is created and verified by the property service on confirmation,
+// so later price changes of the property do not change existing bookings
+type Price struct {
+	Nights      int64  `gorm:"notNull;default:0"`
+	NightlyRate int64  `gorm:"notNull;default:0"`
+	CleaningFee int64  `gorm:"notNull;default:0"`
+	Subtotal    int64  `gorm:"notNull;default:0"`
+	Tax         int64  `gorm:"notNull;default:0"`
+	Total       int64  `gorm:"notNull;default:0"`
+	Currency    string `gorm:"notNull;size:3;default:''"`
+}
+
+// IsQuoted checks whether a price has been set
+func (price *Price) IsQuoted() bool {
+	return price.Currency != ""
+}
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+type DiscrepancyKind string
+
+const (
+	// ORPHANED_RESERVATION is a reservation whose booking does not exist or does not hold a reservation at that property
+	ORPHANED_RESERVATION DiscrepancyKind = "ORPHANED_RESERVATION"
+	// MISSING_RESERVATION is a booking that holds a reservation which its property does not know about
+	MISSING_RESERVATION DiscrepancyKind = "MISSING_RESERVATION"
+	// RESERVATION_MISMATCH is a reservation whose stay or status differs from its booking
+	RESERVATION_MISMATCH DiscrepancyKind = "RESERVATION_MISMATCH"
+)
+
+type RepairAction string
+
+const (
+	FREE_PROPERTY    RepairAction = "FREE_PROPERTY"
+	RESERVE_PROPERTY RepairAction = "RESERVE_PROPERTY"
+	// MANUAL discrepancies are only reported, because there is no safe automatic repair
+	MANUAL RepairAction = "MANUAL"
+)
+
+// ReconciliationReport lists the discrepancies between the bookings and the reservations of the property service
+// NOTE: The report is meant to be processed by machines, hence the JSON tags
+type ReconciliationReport struct {
+	StartedAt     time.Time     `json:"startedAt"`
+	FinishedAt    time.Time     `json:"finishedAt"`
+	DryRun        bool          `json:"dryRun"`
+	Bookings      int           `json:"bookings"`
+	Reservations  int           `json:"reservations"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+type Discrepancy struct {
+	Kind       DiscrepancyKind `json:"kind"`
+	BookingId  uint            `json:"bookingId"`
+	PropertyId uint            `json:"propertyId"`
+	// empty if the booking does not exist
+	BookingStatus Status       `json:"bookingStatus,omitempty"`
+	Description   string       `json:"description"`
+	Repair        RepairAction `json:"repair"`
+	Repaired      bool         `json:"repaired"`
+	RepairError   string       `json:"repairError,omitempty"`
+}
+
+// Unrepaired counts the discrepancies that are still present after the reconciliation
+func (report *ReconciliationReport) Unrepaired() int {
+	count := 0
+	for _, discrepancy := range report.Discrepancies {
+		if !discrepancy.Repaired {
+			count++
+		}
+	}
+	return count
+}
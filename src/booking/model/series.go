@@ -0,0 +1,86 @@
+package model
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+type Frequency string
+
+const (
+	WEEKLY  Frequency = "WEEKLY"
+	MONTHLY Frequency = "MONTHLY"
+)
+
+// maxOccurrences limits how many bookings a single series may expand into
+const maxOccurrences = 52
+
+// BookingSeries repeats a stay at a property with a recurrence rule, each occurrence is a booking of its own
+// NOTE: The rule ends either after Count occurrences or with the last occurrence starting on or before Until
+type BookingSeries struct {
+	gorm.Model
+	Comment      string `gorm:"notNull;size:100"`
+	CustomerId   uint   `gorm:"notNull;default:0;index"`
+	CustomerName string `gorm:"notNull;size:60"`
+	PropertyId   uint   `gorm:"notNull"`
+	Frequency    `gorm:"notNull;type:ENUM('WEEKLY', 'MONTHLY')"`
+	Count        uint
+	Until        *time.Time
+	Bookings     []Booking `gorm:"foreignKey:SeriesId"`
+}
+
+// Occurrence is a single stay of a booking series
+type Occurrence struct {
+	CheckIn  time.Time
+	CheckOut time.Time
+}
+
+// SetFrequency sets the given frequency if it is known
+func (series *BookingSeries) SetFrequency(frequency string) error {
+	switch Frequency(frequency) {
+	case WEEKLY, MONTHLY:
+		series.Frequency = Frequency(frequency)
+	default:
+		return &BookingError{Message: fmt.Sprintf("Unknown frequency %s, expected WEEKLY or MONTHLY", frequency)}
+	}
+	return nil
+}
+
+// Occurrences expands the recurrence rule of the series starting with the stay from checkIn to checkOut
+// NOTE: Monthly occurrences keep the day of the month, days that do not exist in a month roll over into the next one
+func (series *BookingSeries) Occurrences(checkIn time.Time, checkOut time.Time) ([]Occurrence, error) {
+	checkIn, checkOut = TruncateToDay(checkIn), TruncateToDay(checkOut)
+	nights := int(checkOut.Sub(checkIn).Hours() / 24)
+	if nights < 1 {
+		return nil, &BookingError{Message: "Check-out must be at least one day after check-in"}
+	}
+	if (series.Count == 0) == (series.Until == nil) {
+		return nil, &BookingError{Message: "Either count or until is required to end the series"}
+	}
+	if series.Count > maxOccurrences {
+		return nil, &BookingError{Message: fmt.Sprintf("A series cannot have more than %d occurrences", maxOccurrences)}
+	}
+	if (series.Frequency == WEEKLY && nights > 7) || (series.Frequency == MONTHLY && nights > 28) {
+		return nil, &BookingError{Message: fmt.Sprintf("A stay of %d nights overlaps its next %s occurrence", nights, series.Frequency)}
+	}
+
+	var occurrences []Occurrence
+	for i := 0; series.Count == 0 || i < int(series.Count); i++ {
+		start := checkIn.AddDate(0, 0, 7*i)
+		if series.Frequency == MONTHLY {
+			start = checkIn.AddDate(0, i, 0)
+		}
+		if series.Until != nil && start.After(TruncateToDay(*series.Until)) {
+			break
+		}
+		if len(occurrences) == maxOccurrences {
+			return nil, &BookingError{Message: fmt.Sprintf("A series cannot have more than %d occurrences", maxOccurrences)}
+		}
+		occurrences = append(occurrences, Occurrence{CheckIn: start, CheckOut: start.AddDate(0, 0, nights)})
+	}
+	if len(occurrences) == 0 {
+		return nil, &BookingError{Message: "Until must not be before the first check-in"}
+	}
+	return occurrences, nil
+}
@@ -0,0 +1,17 @@
+package model
+
+import "gorm.io/gorm"
+
+// MaxReasonLength is the maximum number of characters of the reason of a transition
+const MaxReasonLength = 255
+
+// BookingTransition records a status change of a booking and who triggered it
+// NOTE: The time of the change is stored in CreatedAt, FromStatus is empty for the creation of a booking
+type BookingTransition struct {
+	gorm.Model
+	BookingId  uint   `gorm:"notNull;index"`
+	FromStatus Status `gorm:"notNull;size:20"`
+	ToStatus   Status `gorm:"notNull;size:20"`
+	Actor      string `gorm:"notNull;size:60"`
+	Reason     string `gorm:"notNull;size:255"`
+}
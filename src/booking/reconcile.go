@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/service"
+	log "github.com/sirupsen/logrus"
+	"os"
+)
+
+// runReconcile reconciles the bookings once, prints the report as JSON to stdout and returns the exit code:
+// 1 if the reconciliation failed, 2 if discrepancies remain, 0 otherwise
+func runReconcile(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report discrepancies without repairing them")
+	_ = flags.Parse(args)
+
+	report, err := service.Reconcile(*dryRun)
+	if err != nil {
+		log.Errorf("Error reconciling bookings: %v", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Errorf("Error writing reconciliation report: %v", err)
+		return 1
+	}
+	if report.Unrepaired() > 0 {
+		return 2
+	}
+	return 0
+}
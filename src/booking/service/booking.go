@@ -8,6 +8,9 @@ import (
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
 	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto/client/property"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -16,42 +19,108 @@ import (
 
 // CreateBooking creates the given booking
 // and tries to confirm the booking at the property service
+// NOTE: The price is quoted before the booking is stored, so no booking is created without a price.
+// The property service declines the confirmation if the stay costs a different amount by then.
+// The booking is stored together with an outbox message for its confirmation, so that the confirmation
+// is retried by the outbox dispatcher if the property service is unavailable or the booking service stops.
+// Only a definitive refusal of the property service is returned as error once the booking is stored,
+// the booking stays pending otherwise.
 func CreateBooking(booking *model.Booking) error {
+	booking.CheckIn, booking.CheckOut = model.TruncateToDay(booking.CheckIn), model.TruncateToDay(booking.CheckOut)
+	if booking.Nights() < 1 {
+		return &model.BookingError{Message: "Check-out must be at least one day after check-in"}
+	}
+	customer, err := getCustomer(booking.CustomerId)
+	if err != nil {
+		return err
+	}
+	booking.CustomerName = customer.Name
+	price, err := QuoteBooking(booking.PropertyId, booking.CheckIn, booking.CheckOut)
+	if err != nil {
+		return err
+	}
+	booking.Price = *price
+	if booking.Guests.Adults == 0 {
+		booking.Guests.Adults = 1
+	}
 	booking.SetStatusPending()
+	booking.Transitions = []model.BookingTransition{{ToStatus: model.PENDING, Actor: booking.CustomerName}}
 
-	result := db.DB.Create(booking)
-	if result.Error != nil {
-		return result.Error
+	var message *model.OutboxMessage
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(booking).Error; err != nil {
+			return err
+		}
+		var err error
+		message, err = enqueue(tx, booking, model.CONFIRM_BOOKING, booking.PropertyId)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
 	entry := log.WithField("ID", booking.ID)
 	entry.Info("Successfully stored new booking in database.")
 	entry.Tracef("Stored: %v", booking)
 
-	err := confirmBooking(booking)
-	if err != nil {
-		return err
+	if err := processOutboxMessage(message, booking); err != nil {
+		if isDeclined(err) {
+			return err
+		}
+		entry.Warnf("Confirmation failed, the outbox dispatcher will retry: %v", err)
+		return nil
 	}
 
-	entry.Info("Successfully confirmed booking.")
+	if booking.Status == model.CONFIRMED {
+		entry.Info("Successfully confirmed booking.")
+	}
 	return nil
 }
 
-// GetBookings retrieves all existing bookings
-func GetBookings() ([]model.Booking, error) {
-	var bookings []model.Booking
-	result := db.DB.Find(&bookings)
-	if result.Error != nil {
-		return nil, result.Error
+// sortableBookings maps the fields bookings can be ordered by to their columns
+var sortableBookings = map[string]string{
+	"id":            "id",
+	"customer_name": "customer_name",
+	"property_id":   "property_id",
+	"check_in":      "check_in",
+	"created_at":    "created_at",
+	"updated_at":    "updated_at",
+}
+
+// GetBookings retrieves the page of the bookings matching the given filter selected by the given page request
+// and returns the token of the next page, which is empty for the last page
+func GetBookings(filter model.BookingFilter, page model.PageRequest) ([]model.Booking, string, error) {
+	query := db.DB.Preload("Transitions")
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	} else if !filter.IncludeCancelled {
+		query = query.Where("status <> ?", model.CANCELLED)
+	}
+	if filter.PropertyId != 0 {
+		query = query.Where("property_id = ?", filter.PropertyId)
+	}
+	if filter.CustomerId != 0 {
+		query = query.Where("customer_id = ?", filter.CustomerId)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedBefore)
+	}
+
+	bookings, nextPageToken, err := paginate[model.Booking](query, page, filter, sortableBookings)
+	if err != nil {
+		return nil, "", err
 	}
 	log.Tracef("Retrieved: %v", bookings)
-	return bookings, nil
+	return bookings, nextPageToken, nil
 }
 
 // GetBooking retrieves the booking matching the given id
 func GetBooking(id uint) (*model.Booking, error) {
 	booking := new(model.Booking)
-	result := db.DB.First(booking, id)
+	result := db.DB.Preload("Transitions").First(booking, id)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -63,17 +132,50 @@ func GetBooking(id uint) (*model.Booking, error) {
 }
 
 // UpdateBooking updates the booking matching the given id
-func UpdateBooking(id uint, booking *model.Booking) (*model.Booking, error) {
+// NOTE: A different property id moves the booking to that property, see moveBooking.
+// The update is rejected if the booking no longer has the expected version,
+// 0 updates whatever version was read, which still detects concurrent updates.
+// A customer id of 0 keeps the current customer.
+func UpdateBooking(id uint, booking *model.Booking, expectedVersion uint) (*model.Booking, error) {
 	existingBooking, err := GetBooking(id)
 	if existingBooking == nil || err != nil {
 		return existingBooking, err
 	}
-	existingBooking.CustomerName = booking.CustomerName
-	existingBooking.Comment = booking.Comment
+	if expectedVersion == 0 {
+		expectedVersion = existingBooking.Version
+	}
+	if existingBooking.Version != expectedVersion {
+		return nil, &model.VersionConflictError{Id: id, ExpectedVersion: expectedVersion}
+	}
+	// checked before the move, which cannot be undone
+	columns := map[string]interface{}{"comment": booking.Comment}
+	if booking.CustomerId != 0 && booking.CustomerId != existingBooking.CustomerId {
+		customer, err := getCustomer(booking.CustomerId)
+		if err != nil {
+			return nil, err
+		}
+		columns["customer_id"], columns["customer_name"] = booking.CustomerId, customer.Name
+	}
 
-	result := db.DB.Save(existingBooking)
-	if result.Error != nil {
-		return nil, result.Error
+	if booking.PropertyId != 0 && booking.PropertyId != existingBooking.PropertyId {
+		// the version is claimed before the property service is involved,
+		// so that a stale update never reserves the new property
+		if err := updateVersioned(db.DB, existingBooking, expectedVersion, map[string]interface{}{}); err != nil {
+			return nil, err
+		}
+		if err := moveBooking(existingBooking, booking.PropertyId); err != nil {
+			return nil, err
+		}
+		expectedVersion = existingBooking.Version
+	}
+
+	// only the updatable columns are written, so that concurrent status changes are never reverted
+	if err := updateVersioned(db.DB, existingBooking, expectedVersion, columns); err != nil {
+		return nil, err
+	}
+	existingBooking.Comment = booking.Comment
+	if customerName, ok := columns["customer_name"]; ok {
+		existingBooking.CustomerId, existingBooking.CustomerName = booking.CustomerId, customerName.(string)
 	}
 
 	entry := log.WithField("ID", id)
@@ -82,88 +184,144 @@ func UpdateBooking(id uint, booking *model.Booking) (*model.Booking, error) {
 	return existingBooking, nil
 }
 
-// DeleteBooking deletes the booking matching the given id
-// and cancels it at the property service
+// DeleteBooking cancels the booking matching the given id on behalf of its customer
+// NOTE: Bookings are no longer removed, so that cancelled bookings stay traceable
 func DeleteBooking(id uint) (*model.Booking, error) {
-	booking, err := deleteWithoutCancellation(id)
+	booking, err := GetBooking(id)
 	if booking == nil || err != nil {
 		return booking, err
 	}
+	return release(booking, model.CANCELLED, booking.CustomerName, "")
+}
 
-	err = cancelBooking(booking)
-	if err != nil {
-		return nil, err
+// confirmBooking connects to the property service via gRPC and confirms the given booking
+// NOTE: Rejects the booking if the property service declines the confirmation,
+// other failures leave the booking pending so that the confirmation can be retried.
+// The booking also stays pending if the owner of the property has to approve it.
+func confirmBooking(booking *model.Booking, actor string) error {
+	var price *model.Price
+	if booking.Price.IsQuoted() {
+		price = &booking.Price
 	}
+	confirmation, err := reserveProperty(booking, booking.PropertyId, booking.HoldToken, price)
+	if err != nil {
+		if !isDeclined(err) {
+			return err
+		}
 
-	return booking, nil
-}
+		entry := log.WithField("bookingId", booking.ID)
+		entry.Info("Rejecting booking because the property service declined it")
+		if rejectErr := transition(booking, model.REJECTED, systemActor, err.Error()); rejectErr != nil {
+			return errors.Join(err, rejectErr)
+		}
+		return err
+	}
 
-// deleteWithoutCancellation deletes the booking matching the given id
-func deleteWithoutCancellation(id uint) (*model.Booking, error) {
-	booking, err := GetBooking(id)
-	if booking == nil || err != nil {
-		return booking, err
+	if confirmation.Quote != nil && !booking.Price.IsQuoted() {
+		booking.Price = mapToPrice(confirmation.Quote)
+		if err := updateBooking(db.DB, booking, priceColumns(booking.Price)); err != nil {
+			return err
+		}
 	}
-	result := db.DB.Delete(booking)
-	if result.Error != nil {
-		return nil, result.Error
+
+	if confirmation.ApprovalRequired {
+		entry := log.WithField("ID", booking.ID)
+		entry.Info("Booking stays pending until the owner of the property approves it.")
+		booking.ApprovalRequired = true
+		return updateBooking(db.DB, booking, map[string]interface{}{"approval_required": true})
 	}
-	entry := log.WithField("ID", id)
-	entry.Info("Successfully deleted booking.")
-	entry.Tracef("Deleted: %v", booking)
 
-	return booking, nil
+	err = transition(booking, model.CONFIRMED, actor, "")
+	var transitionError *model.TransitionError
+	if errors.As(err, &transitionError) {
+		// the booking changed its status meanwhile, e.g. it was cancelled, so it may not need the reservation anymore
+		// NOTE: The release is skipped if the booking holds the reservation in its new status, see runReleaseStep
+		message, enqueueErr := enqueue(db.DB, booking, model.RELEASE_PROPERTY, booking.PropertyId)
+		if enqueueErr != nil {
+			return errors.Join(err, enqueueErr)
+		}
+		if releaseErr := processOutboxMessage(message, nil); releaseErr != nil && !isDeclined(releaseErr) {
+			entry := log.WithField("ID", booking.ID)
+			entry.Warnf("Releasing the property failed, the outbox dispatcher will retry: %v", releaseErr)
+		}
+	}
+	return err
 }
 
-// confirmBooking connects to the property service via gRPC and confirms the given booking
-// NOTE: Deletes the booking if the confirmation fails
-func confirmBooking(booking *model.Booking) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
-	conn, err := client.GetPropertyConnection(ctx)
-	if err != nil {
-		log.Errorf("Error connecting to property service: %v", err)
-		return err
+// isDeclined checks whether the property service answered a request with a definitive refusal
+func isDeclined(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.FailedPrecondition:
+		return true
 	}
+	return false
+}
 
-	defer func(conn *grpc.ClientConn) {
-		err := conn.Close()
-		if err != nil {
-			log.Errorf("Error closing connection: %s", err)
-		}
-	}(conn)
+// cancelBooking connects to the property service via gRPC and cancels the given booking
+func cancelBooking(booking *model.Booking) error {
+	return releaseProperty(booking, booking.PropertyId)
+}
 
-	propertyClient := proto.NewPropertyInternalClient(conn)
-	_, err = propertyClient.ConfirmBooking(ctx, &proto.BookingReq{
-		BookingId:  uint32(booking.ID),
-		PropertyId: uint32(booking.PropertyId),
+// getRefundTiers connects to the property service via gRPC and retrieves the cancellation policy of the property of the given booking
+func getRefundTiers(booking *model.Booking) ([]model.RefundTier, error) {
+	var policy *proto.CancellationPolicyResp
+	err := callPropertyService(func(ctx context.Context, propertyClient proto.PropertyInternalClient) error {
+		var err error
+		policy, err = propertyClient.GetCancellationPolicy(ctx, &proto.BookingReq{PropertyId: uint32(booking.PropertyId)})
+		return err
 	})
 	if err != nil {
-		log.Errorf("Error calling property service: %v", err)
-		entry := log.WithField("bookingId", booking.ID)
-		entry.Info("Trying to delete booking to make state consistent")
-		// does not require cancellation because booking was never confirmed
-		_, deleteErr := deleteWithoutCancellation(booking.ID)
-
-		if deleteErr != nil {
-			return errors.Join(err, deleteErr)
-		}
-		return err
+		return nil, err
 	}
 
-	booking.SetStatusConfirmed()
+	tiers := make([]model.RefundTier, len(policy.Tiers))
+	for i, tier := range policy.Tiers {
+		tiers[i] = model.RefundTier{DaysBefore: tier.DaysBefore, RefundPercent: tier.RefundPercent}
+	}
+	return tiers, nil
+}
 
-	result := db.DB.Save(booking)
-	if result.Error != nil {
-		return result.Error
+// reserveProperty connects to the property service via gRPC and reserves the property matching the given id
+// for the stay and guests of the given booking
+// NOTE: If a price is given, the property service declines the reservation if the stay costs a different amount.
+func reserveProperty(booking *model.Booking, propertyId uint, holdToken string, price *model.Price) (*proto.BookingConfirmationResp, error) {
+	var quote *proto.StayQuote
+	if price != nil {
+		quote = mapToProtoStayQuote(*price)
 	}
+	var confirmation *proto.BookingConfirmationResp
+	err := callPropertyService(func(ctx context.Context, propertyClient proto.PropertyInternalClient) error {
+		var err error
+		confirmation, err = propertyClient.ConfirmBooking(ctx, &proto.BookingReq{
+			BookingId:  uint32(booking.ID),
+			PropertyId: uint32(propertyId),
+			CheckIn:    timestamppb.New(booking.CheckIn),
+			CheckOut:   timestamppb.New(booking.CheckOut),
+			HoldToken:  holdToken,
+			Adults:     booking.Guests.Adults,
+			Children:   booking.Guests.Children,
+			Pets:       booking.Guests.Pets,
+			Quote:      quote,
+		})
+		return err
+	})
+	return confirmation, err
+}
 
-	return nil
+// releaseProperty connects to the property service via gRPC and frees the property matching the given id
+// from the reservation of the given booking
+func releaseProperty(booking *model.Booking, propertyId uint) error {
+	return callPropertyService(func(ctx context.Context, propertyClient proto.PropertyInternalClient) error {
+		_, err := propertyClient.CancelBooking(ctx, &proto.BookingReq{
+			BookingId:  uint32(booking.ID),
+			PropertyId: uint32(propertyId),
+		})
+		return err
+	})
 }
 
-// cancelBooking connects to the property service via gRPC and cancels the given booking
-func cancelBooking(booking *model.Booking) error {
+// callPropertyService connects to the property service via gRPC and passes a client for it to the given call
+func callPropertyService(call func(context.Context, proto.PropertyInternalClient) error) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
@@ -180,15 +338,36 @@ func cancelBooking(booking *model.Booking) error {
 		}
 	}(conn)
 
-	propertyClient := proto.NewPropertyInternalClient(conn)
-	_, err = propertyClient.CancelBooking(ctx, &proto.BookingReq{
-		BookingId:  uint32(booking.ID),
-		PropertyId: uint32(booking.PropertyId),
-	})
+	err = call(ctx, proto.NewPropertyInternalClient(conn))
 	if err != nil {
 		log.Errorf("Error calling property service: %v", err)
 		return err
 	}
+	return nil
+}
+
+// updateBooking writes the given columns of the given booking within the given transaction and increments its version
+// NOTE: Every write to a booking changes its version, so that updates based on an earlier read are rejected
+func updateBooking(tx *gorm.DB, booking *model.Booking, columns map[string]interface{}) error {
+	columns["version"] = gorm.Expr("version + 1")
+	if err := tx.Model(booking).Updates(columns).Error; err != nil {
+		return err
+	}
+	booking.Version++
+	return nil
+}
 
+// updateVersioned writes the given columns of the given booking and increments its version
+// if the booking still has the expected version, checking and writing are a single statement
+func updateVersioned(tx *gorm.DB, booking *model.Booking, expectedVersion uint, columns map[string]interface{}) error {
+	columns["version"] = gorm.Expr("version + 1")
+	result := tx.Model(booking).Where("version = ?", expectedVersion).Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return &model.VersionConflictError{Id: booking.ID, ExpectedVersion: expectedVersion}
+	}
+	booking.Version = expectedVersion + 1
 	return nil
 }
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"time"
+)
+
+// CreateGroupBooking creates the given group with one booking per given property for the stay from checkIn to checkOut
+// and confirms all of them at the property service
+// NOTE: If a single property declines or requires the approval of its owner, the properties confirmed so far
+// are cancelled again and all bookings of the group are rejected, so either all or none of the properties are booked.
+// The confirmation is a step of the outbox, if the property service is unavailable the dispatcher retries it.
+func CreateGroupBooking(group *model.BookingGroup, propertyIds []uint, checkIn time.Time, checkOut time.Time) error {
+	if len(propertyIds) == 0 {
+		return &model.BookingError{Message: "A group booking needs at least one property"}
+	}
+	seen := make(map[uint]bool)
+	for _, propertyId := range propertyIds {
+		if seen[propertyId] {
+			return &model.BookingError{Message: fmt.Sprintf("Property %d is part of the group booking more than once", propertyId)}
+		}
+		seen[propertyId] = true
+	}
+	customer, err := getCustomer(group.CustomerId)
+	if err != nil {
+		return err
+	}
+	group.CustomerName = customer.Name
+
+	for _, propertyId := range propertyIds {
+		booking := model.Booking{
+			Comment:      group.Comment,
+			CustomerId:   group.CustomerId,
+			CustomerName: group.CustomerName,
+			PropertyId:   propertyId,
+			CheckIn:      model.TruncateToDay(checkIn),
+			CheckOut:     model.TruncateToDay(checkOut),
+			Guests:       model.Guests{Adults: 1},
+		}
+		if booking.Nights() < 1 {
+			return &model.BookingError{Message: "Check-out must be at least one day after check-in"}
+		}
+		booking.SetStatusPending()
+		booking.Transitions = []model.BookingTransition{{ToStatus: model.PENDING, Actor: group.CustomerName}}
+		group.Bookings = append(group.Bookings, booking)
+	}
+
+	// a single message confirms the whole group, see runConfirmStep
+	var message *model.OutboxMessage
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		var err error
+		message, err = enqueue(tx, &group.Bookings[0], model.CONFIRM_BOOKING, group.Bookings[0].PropertyId)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	entry := log.WithField("groupId", group.ID)
+	entry.Info("Successfully stored new group booking in database.")
+
+	confirmErr := processOutboxMessage(message, &group.Bookings[0])
+	if confirmErr != nil && !isDeclined(confirmErr) {
+		entry.Warnf("Confirmation failed, the outbox dispatcher will retry: %v", confirmErr)
+		confirmErr = nil
+	}
+
+	// the step works on the stored group, so the outcome is read back
+	storedGroup, err := GetGroupBooking(group.ID)
+	if err != nil {
+		return errors.Join(confirmErr, err)
+	}
+	if storedGroup != nil {
+		*group = *storedGroup
+	}
+	return confirmErr
+}
+
+// GetGroupBooking retrieves the group booking matching the given id including its bookings
+func GetGroupBooking(id uint) (*model.BookingGroup, error) {
+	group := new(model.BookingGroup)
+	result := db.DB.Preload("Bookings.Transitions").First(group, id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	log.Tracef("Retrieved: %v", group)
+	return group, nil
+}
+
+// CancelGroupBooking cancels all bookings of the group booking matching the given id for the given reason
+func CancelGroupBooking(id uint, actor string, reason string) (*model.BookingGroup, error) {
+	group, err := GetGroupBooking(id)
+	if group == nil || err != nil {
+		return group, err
+	}
+
+	if err := cancelAll(group.Bookings, actor, reason); err != nil {
+		return nil, err
+	}
+
+	entry := log.WithField("groupId", group.ID)
+	entry.Info("Successfully cancelled group booking.")
+	return group, nil
+}
+
+// confirmGroup reserves the properties of all bookings of the given group and confirms the bookings together
+// NOTE: Repeated attempts are safe, the property service returns the existing reservation of a booking.
+// Failures without a definitive answer of the property service leave the group pending for the next attempt.
+func confirmGroup(group *model.BookingGroup) error {
+	if len(pendingBookings(group.Bookings)) != len(group.Bookings) {
+		// the group left the saga, e.g. because it was cancelled or an earlier attempt decided it
+		return nil
+	}
+
+	for i := range group.Bookings {
+		booking := &group.Bookings[i]
+		confirmation, err := reserveProperty(booking, booking.PropertyId, "", nil)
+		if err != nil {
+			if isDeclined(err) {
+				return rejectGroup(group, group.Bookings[:i], err)
+			}
+			return err
+		}
+		if confirmation.ApprovalRequired {
+			message := fmt.Sprintf("Property %d requires the approval of its owner and cannot be part of a group booking", booking.PropertyId)
+			return rejectGroup(group, group.Bookings[:i+1], status.Error(codes.FailedPrecondition, message))
+		}
+		if confirmation.Quote != nil {
+			booking.Price = mapToPrice(confirmation.Quote)
+		}
+	}
+
+	// the bookings are confirmed together, so that the group is never left partly confirmed
+	records := make([]*model.BookingTransition, len(group.Bookings))
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range group.Bookings {
+			booking := &group.Bookings[i]
+			columns := priceColumns(booking.Price)
+			columns["version"] = gorm.Expr("version + 1")
+			if err := tx.Model(booking).Updates(columns).Error; err != nil {
+				return err
+			}
+			record, err := writeTransition(tx, booking, model.CONFIRMED, systemActor, "")
+			if err != nil {
+				return err
+			}
+			records[i] = record
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range group.Bookings {
+		group.Bookings[i].Version++
+		applyTransition(&group.Bookings[i], records[i])
+	}
+	entry := log.WithField("groupId", group.ID)
+	entry.Info("Successfully confirmed group booking.")
+	return nil
+}
+
+// rejectGroup rejects all bookings of the given group because of the given cause
+// and frees the properties reserved for the given bookings
+// NOTE: The rejections are stored together with the outbox messages releasing the properties,
+// so that the dispatcher frees them if the property service is unavailable.
+func rejectGroup(group *model.BookingGroup, reserved []model.Booking, cause error) error {
+	entry := log.WithField("groupId", group.ID)
+	entry.Infof("Rejecting group booking because a property declined it: %v", cause)
+
+	records := make([]*model.BookingTransition, len(group.Bookings))
+	releases := make([]*model.OutboxMessage, len(reserved))
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range group.Bookings {
+			var err error
+			if records[i], err = writeTransition(tx, &group.Bookings[i], model.REJECTED, systemActor, cause.Error()); err != nil {
+				return err
+			}
+		}
+		for i := range reserved {
+			var err error
+			if releases[i], err = enqueue(tx, &reserved[i], model.RELEASE_PROPERTY, reserved[i].PropertyId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+
+	for i := range group.Bookings {
+		applyTransition(&group.Bookings[i], records[i])
+	}
+	for i := range releases {
+		booking := &reserved[i]
+		if err := processOutboxMessage(releases[i], booking); err != nil && !isDeclined(err) {
+			entry.Warnf("Releasing property %d failed, the outbox dispatcher will retry: %v", booking.PropertyId, err)
+		}
+	}
+	return cause
+}
+
+// pendingBookings returns the given bookings that are still pending
+func pendingBookings(bookings []model.Booking) []*model.Booking {
+	var pending []*model.Booking
+	for i := range bookings {
+		if bookings[i].Status == model.PENDING {
+			pending = append(pending, &bookings[i])
+		}
+	}
+	return pending
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// systemActor is recorded for status changes that are not triggered by a person
+const systemActor = "system"
+
+// transitions lists the statuses a booking may change to from its current status
+var transitions = map[model.Status][]model.Status{
+	model.PENDING:    {model.CONFIRMED, model.REJECTED, model.CANCELLED, model.EXPIRED},
+	model.CONFIRMED:  {model.CANCELLED, model.CHECKED_IN},
+	model.CHECKED_IN: {model.COMPLETED},
+}
+
+// canTransition checks whether the transition table allows changing from one status to the other
+func canTransition(from model.Status, to model.Status) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfirmBooking retries the confirmation of the pending booking matching the given id at the property service
+func ConfirmBooking(id uint, actor string) (*model.Booking, error) {
+	booking, err := GetBooking(id)
+	if booking == nil || err != nil {
+		return booking, err
+	}
+	if !canTransition(booking.Status, model.CONFIRMED) {
+		return nil, &model.TransitionError{BookingId: booking.ID, From: booking.Status, To: model.CONFIRMED}
+	}
+
+	if err := confirmBooking(booking, actor); err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// CancelBooking cancels the booking matching the given id for the given reason
+// NOTE: The booking is kept with status CANCELLED instead of being deleted
+func CancelBooking(id uint, actor string, reason string) (*model.Booking, error) {
+	booking, err := GetBooking(id)
+	if booking == nil || err != nil {
+		return booking, err
+	}
+	return release(booking, model.CANCELLED, actor, reason)
+}
+
+// RejectBooking rejects the pending booking matching the given id
+func RejectBooking(id uint, actor string) (*model.Booking, error) {
+	booking, err := GetBooking(id)
+	if booking == nil || err != nil {
+		return booking, err
+	}
+	return release(booking, model.REJECTED, actor, "")
+}
+
+// CheckInBooking marks the guests of the confirmed booking matching the given id as arrived
+func CheckInBooking(id uint, actor string) (*model.Booking, error) {
+	return changeStatus(id, model.CHECKED_IN, actor, "")
+}
+
+// CompleteBooking marks the checked-in booking matching the given id as completed
+func CompleteBooking(id uint, actor string) (*model.Booking, error) {
+	return changeStatus(id, model.COMPLETED, actor, "")
+}
+
+// ExpireBooking expires the pending booking matching the given id
+func ExpireBooking(id uint, actor string) (*model.Booking, error) {
+	booking, err := GetBooking(id)
+	if booking == nil || err != nil {
+		return booking, err
+	}
+	return release(booking, model.EXPIRED, actor, "")
+}
+
+// ApproveBooking confirms the pending booking matching the given id after the owner of the property approved it
+func ApproveBooking(id uint, actor string) (*model.Booking, error) {
+	return decide(id, model.CONFIRMED, actor, "")
+}
+
+// DeclineBooking rejects the pending booking matching the given id after the owner of the property declined it
+// NOTE: The property service releases its tentative reservation itself
+func DeclineBooking(id uint, actor string, reason string) (*model.Booking, error) {
+	return decide(id, model.REJECTED, actor, reason)
+}
+
+// cancelAll cancels the given bookings for the given reason
+// NOTE: Bookings that cannot be cancelled anymore, e.g. rejected or completed ones, are skipped.
+// The cancellation continues if a single booking fails, the errors are returned together.
+func cancelAll(bookings []model.Booking, actor string, reason string) error {
+	var errs []error
+	for i := range bookings {
+		booking := &bookings[i]
+		if !canTransition(booking.Status, model.CANCELLED) {
+			continue
+		}
+		if _, err := release(booking, model.CANCELLED, actor, reason); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// decide moves the booking matching the given id to the status chosen by the owner of the property
+// if the booking is awaiting approval
+func decide(id uint, to model.Status, actor string, reason string) (*model.Booking, error) {
+	booking, err := GetBooking(id)
+	if booking == nil || err != nil {
+		return booking, err
+	}
+	if !booking.ApprovalRequired {
+		return nil, &model.BookingError{Message: fmt.Sprintf("Booking %d is not awaiting approval", booking.ID)}
+	}
+
+	// the decision and the end of the approval are stored together, so that neither is left behind
+	var record *model.BookingTransition
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateBooking(tx, booking, map[string]interface{}{"approval_required": false}); err != nil {
+			return err
+		}
+		var err error
+		record, err = writeTransition(tx, booking, to, actor, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	booking.ApprovalRequired = false
+	applyTransition(booking, record)
+	return booking, nil
+}
+
+// release moves the given booking to the given status and frees the property at the property service
+// if it is reserved for the booking
+// NOTE: The property is freed via the outbox, if the property service is unavailable the dispatcher retries it.
+func release(booking *model.Booking, to model.Status, actor string, reason string) (*model.Booking, error) {
+	if !canTransition(booking.Status, to) {
+		return nil, &model.TransitionError{BookingId: booking.ID, From: booking.Status, To: to}
+	}
+
+	// the policy is retrieved before freeing the property, so that a cancellation is never left without refund
+	applyPolicy := to == model.CANCELLED && booking.Status == model.CONFIRMED
+	if applyPolicy {
+		tiers, err := getRefundTiers(booking)
+		if err != nil {
+			return nil, err
+		}
+		booking.ApplyCancellationPolicy(tiers, time.Now())
+	}
+
+	// the status is changed together with the outbox message releasing the property,
+	// so that the property is never freed for a booking that keeps its status
+	var record *model.BookingTransition
+	var message *model.OutboxMessage
+	holdsReservation := booking.HoldsReservation()
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if record, err = writeTransition(tx, booking, to, actor, reason); err != nil {
+			return err
+		}
+		if applyPolicy {
+			err := tx.Model(booking).UpdateColumns(map[string]interface{}{
+				"cancellation_refund_percent": booking.Cancellation.RefundPercent,
+				"cancellation_refund":         booking.Cancellation.Refund,
+				"cancellation_fee":            booking.Cancellation.Fee,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if holdsReservation {
+			message, err = enqueue(tx, booking, model.RELEASE_PROPERTY, booking.PropertyId)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	applyTransition(booking, record)
+	if applyPolicy {
+		entry := log.WithField("ID", booking.ID)
+		entry.Infof("Refunding %d%% of the price, the cancellation fee is %d.", booking.Cancellation.RefundPercent, booking.Cancellation.Fee)
+	}
+
+	if message != nil {
+		if err := processOutboxMessage(message, booking); err != nil {
+			entry := log.WithField("ID", booking.ID)
+			entry.Warnf("Releasing the property failed, the outbox dispatcher will retry: %v", err)
+		}
+	}
+	return booking, nil
+}
+
+// changeStatus moves the booking matching the given id to the given status
+// without involving the property service
+func changeStatus(id uint, to model.Status, actor string, reason string) (*model.Booking, error) {
+	booking, err := GetBooking(id)
+	if booking == nil || err != nil {
+		return booking, err
+	}
+
+	if err := transition(booking, to, actor, reason); err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// transition changes the status of the given booking if the transition table allows it
+// and records the change together with the given actor and reason
+func transition(booking *model.Booking, to model.Status, actor string, reason string) error {
+	var record *model.BookingTransition
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		record, err = writeTransition(tx, booking, to, actor, reason)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	applyTransition(booking, record)
+	return nil
+}
+
+// writeTransition stores the status change of the given booking within the given transaction
+// NOTE: The booking itself is only changed by applyTransition after the transaction is committed.
+// The status is only changed if it is still the one that was read, so that a concurrent status change
+// is never overwritten, e.g. a cancellation by a late confirmation.
+func writeTransition(tx *gorm.DB, booking *model.Booking, to model.Status, actor string, reason string) (*model.BookingTransition, error) {
+	from := booking.Status
+	if !canTransition(from, to) {
+		return nil, &model.TransitionError{BookingId: booking.ID, From: from, To: to}
+	}
+
+	record := &model.BookingTransition{
+		BookingId:  booking.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor,
+		// reasons of the property service, e.g. a list of violations, may exceed the column
+		Reason: truncate(reason, model.MaxReasonLength),
+	}
+	columns := map[string]interface{}{"status": to, "version": gorm.Expr("version + 1")}
+	result := tx.Model(new(model.Booking)).Where("id = ? AND status = ?", booking.ID, from).Updates(columns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		current := new(model.Booking)
+		if err := tx.Select("status").First(current, booking.ID).Error; err != nil {
+			return nil, err
+		}
+		return nil, &model.TransitionError{BookingId: booking.ID, From: current.Status, To: to}
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// applyTransition changes the given booking according to a stored transition
+func applyTransition(booking *model.Booking, record *model.BookingTransition) {
+	booking.Status = record.ToStatus
+	booking.Version++
+	booking.Transitions = append(booking.Transitions, *record)
+
+	entry := log.WithField("ID", booking.ID)
+	entry.Infof("Successfully changed booking status from %s to %s.", record.FromStatus, record.ToStatus)
+	entry.Tracef("Transition: %v", record)
+}
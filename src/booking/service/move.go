@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// moveBooking moves the given booking to the property matching the given id
+// NOTE: The new property is reserved before the booking points at it and the old one is only freed afterwards,
+// so the booking never points at a property that does not know about it.
+// Both releases are steps of the outbox: the release of the new property is enqueued before reserving it
+// and skipped once the booking points at it, the release of the old property is stored together with the move.
+// So no property keeps a reservation the booking does not use, even if the booking service fails in between.
+// Pending bookings are confirmed by the move, confirmed bookings can only move to properties
+// that do not require the approval of their owner.
+func moveBooking(booking *model.Booking, propertyId uint) error {
+	if booking.Status != model.PENDING && booking.Status != model.CONFIRMED {
+		message := fmt.Sprintf("Booking %d cannot move to another property in status %s", booking.ID, booking.Status)
+		return &model.BookingError{Message: message}
+	}
+	entry := log.WithField("ID", booking.ID)
+
+	rollback, err := enqueue(db.DB, booking, model.RELEASE_PROPERTY, propertyId)
+	if err != nil {
+		return err
+	}
+	abort := func(cause error) error {
+		entry.Warnf("Cancelling reservation at property %d because moving the booking failed: %v", propertyId, cause)
+		if err := processOutboxMessage(rollback, booking); err != nil && !isDeclined(err) {
+			entry.Warnf("Cancelling the reservation failed, the outbox dispatcher will retry: %v", err)
+		}
+		return cause
+	}
+
+	confirmation, err := reserveProperty(booking, propertyId, "", nil)
+	if isDeclined(err) {
+		// the new property did not reserve anything
+		if finishErr := finishOutboxMessage(rollback, nil); finishErr != nil {
+			entry.Errorf("Error finishing outbox message %d: %v", rollback.ID, finishErr)
+		}
+		return err
+	}
+	if err != nil {
+		return abort(err)
+	}
+
+	if confirmation.ApprovalRequired && booking.Status == model.CONFIRMED {
+		message := fmt.Sprintf("Confirmed booking %d cannot move to property %d, because its owner has to approve bookings", booking.ID, propertyId)
+		return abort(&model.BookingError{Message: message})
+	}
+
+	// the price of the stay at the new property replaces the old one
+	updates := map[string]interface{}{}
+	if confirmation.Quote != nil {
+		updates = priceColumns(mapToPrice(confirmation.Quote))
+	}
+	updates["property_id"] = propertyId
+	updates["approval_required"] = confirmation.ApprovalRequired
+	oldPropertyId := booking.PropertyId
+	// pending bookings without reservation have nothing to free at the old property
+	heldReservation := booking.HoldsReservation()
+	confirm := booking.Status == model.PENDING && !confirmation.ApprovalRequired
+
+	var record *model.BookingTransition
+	var release *model.OutboxMessage
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateBooking(tx, booking, updates); err != nil {
+			return err
+		}
+		var err error
+		if confirm {
+			if record, err = writeTransition(tx, booking, model.CONFIRMED, systemActor, ""); err != nil {
+				return err
+			}
+		}
+		if heldReservation {
+			release, err = enqueue(tx, booking, model.RELEASE_PROPERTY, oldPropertyId)
+		}
+		return err
+	})
+	if err != nil {
+		return abort(err)
+	}
+	if confirmation.Quote != nil {
+		booking.Price = mapToPrice(confirmation.Quote)
+	}
+	booking.PropertyId = propertyId
+	booking.ApprovalRequired = confirmation.ApprovalRequired
+	if record != nil {
+		applyTransition(booking, record)
+	}
+	entry.Infof("Successfully moved booking from property %d to property %d.", oldPropertyId, propertyId)
+
+	// the booking points at the new property now, so its rollback is skipped
+	for _, message := range []*model.OutboxMessage{rollback, release} {
+		if message == nil {
+			continue
+		}
+		if err := processOutboxMessage(message, booking); err != nil && !isDeclined(err) {
+			entry.Warnf("Releasing property %d failed, the outbox dispatcher will retry: %v", message.PropertyId, err)
+		}
+	}
+	return nil
+}
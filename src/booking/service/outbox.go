@@ -0,0 +1,256 @@
+package service
+
+import (
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// maxConfirmAttempts limits the retries of a confirmation, afterwards the booking expires
+const maxConfirmAttempts = 10
+
+var (
+	outboxInterval = getDurationEnv("OUTBOX_INTERVAL", 5*time.Second)
+	// time a message is reserved for the dispatcher processing it, afterwards another dispatcher may take over
+	outboxLease = getDurationEnv("OUTBOX_LEASE", 30*time.Second)
+	// upper bound of the exponential backoff between attempts
+	outboxMaxBackoff = getDurationEnv("OUTBOX_MAX_BACKOFF", 5*time.Minute)
+	// processed messages are purged after this time
+	outboxRetention = getDurationEnv("OUTBOX_RETENTION", 7*24*time.Hour)
+)
+
+// DispatchOutbox carries out all due steps of booking sagas and returns the number of processed messages
+// NOTE: Failed steps are retried with exponential backoff, every message is claimed before it is processed,
+// so that several booking service instances can dispatch concurrently.
+func DispatchOutbox() (int, error) {
+	now := time.Now()
+	if err := db.DB.Unscoped().Where("processed_at <= ?", now.Add(-outboxRetention)).Delete(new(model.OutboxMessage)).Error; err != nil {
+		return 0, err
+	}
+
+	var messages []model.OutboxMessage
+	result := db.DB.Where("processed_at IS NULL AND next_attempt_at <= ?", now).Order("id").Limit(100).Find(&messages)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	processed := 0
+	for i := range messages {
+		message := &messages[i]
+		claimed, err := claimOutboxMessage(message)
+		if err != nil {
+			return processed, err
+		}
+		if !claimed {
+			continue
+		}
+		if err := processOutboxMessage(message, nil); err != nil && !message.IsProcessed() {
+			entry := log.WithField("bookingId", message.BookingId)
+			entry.Warnf("Step %s failed in attempt %d: %v", message.Action, message.Attempts, err)
+			continue
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// StartOutboxDispatcher periodically dispatches the outbox in the background until the returned function is called
+// NOTE: Messages left over by a previous run of the booking service are picked up after their lease expired
+func StartOutboxDispatcher() func() {
+	ticker := time.NewTicker(outboxInterval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := DispatchOutbox(); err != nil {
+					log.Errorf("Error dispatching outbox: %v", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	log.Infof("Started outbox dispatcher with interval %s", outboxInterval)
+	return func() {
+		close(done)
+	}
+}
+
+// enqueue writes a message for the given step of the saga of the given booking within the given transaction
+// NOTE: The message is claimed for the caller, who is expected to process it right away.
+// The dispatcher only takes over if the caller fails to do so within the lease.
+func enqueue(tx *gorm.DB, booking *model.Booking, action model.OutboxAction, propertyId uint) (*model.OutboxMessage, error) {
+	message := &model.OutboxMessage{
+		BookingId:     booking.ID,
+		PropertyId:    propertyId,
+		Action:        action,
+		NextAttemptAt: time.Now().Add(outboxLease),
+	}
+	if err := tx.Create(message).Error; err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// claimOutboxMessage reserves the given message for the lease, the update only succeeds for one dispatcher
+func claimOutboxMessage(message *model.OutboxMessage) (bool, error) {
+	nextAttemptAt := time.Now().Add(outboxLease)
+	result := db.DB.Model(message).Where("processed_at IS NULL AND next_attempt_at = ?", message.NextAttemptAt).
+		Update("next_attempt_at", nextAttemptAt)
+	return result.RowsAffected == 1, result.Error
+}
+
+// processOutboxMessage carries out the step of the given message at the property service
+// for the given booking, which is retrieved if it is nil
+// NOTE: Definitive answers of the property service end the step, e.g. a declined confirmation rejects the booking.
+// Other failures schedule a retry, a confirmation that keeps failing expires the booking and releases the property.
+func processOutboxMessage(message *model.OutboxMessage, booking *model.Booking) error {
+	var err error
+	if booking == nil {
+		booking, err = GetBooking(message.BookingId)
+	}
+	if err == nil && booking != nil {
+		switch message.Action {
+		case model.CONFIRM_BOOKING:
+			err = runConfirmStep(booking)
+		case model.RELEASE_PROPERTY:
+			err = runReleaseStep(booking, message.PropertyId)
+		default:
+			err = fmt.Errorf("unknown outbox action %s", message.Action)
+		}
+	}
+
+	message.Attempts++
+	if err == nil || isDeclined(err) {
+		return finishOutboxMessage(message, err)
+	}
+	if message.Action == model.CONFIRM_BOOKING && message.Attempts >= maxConfirmAttempts && booking != nil {
+		if giveUpErr := giveUpConfirmation(message, booking, err); giveUpErr != nil {
+			return giveUpErr
+		}
+		return err
+	}
+	if retryErr := scheduleRetry(message, err); retryErr != nil {
+		return retryErr
+	}
+	return err
+}
+
+// runConfirmStep confirms the given booking unless it left the saga in the meantime,
+// e.g. because it was cancelled or is already confirmed
+// NOTE: Bookings of a group are only confirmed together, so the step confirms the whole group, see confirmGroup.
+func runConfirmStep(booking *model.Booking) error {
+	if booking.Status != model.PENDING || booking.ApprovalRequired {
+		return nil
+	}
+	if booking.GroupId != nil {
+		group, err := GetGroupBooking(*booking.GroupId)
+		if group == nil || err != nil {
+			return err
+		}
+		return confirmGroup(group)
+	}
+	return confirmBooking(booking, systemActor)
+}
+
+// runReleaseStep frees the property matching the given id from the reservation of the given booking
+// unless the booking still holds it, e.g. because the move that enqueued the release succeeded
+func runReleaseStep(booking *model.Booking, propertyId uint) error {
+	if booking.PropertyId == propertyId && booking.HoldsReservation() {
+		return nil
+	}
+	return releaseProperty(booking, propertyId)
+}
+
+// finishOutboxMessage marks the given message as processed, err is the definitive answer of the property service if any
+func finishOutboxMessage(message *model.OutboxMessage, err error) error {
+	now := time.Now()
+	message.ProcessedAt = &now
+	updates := map[string]interface{}{"attempts": message.Attempts, "processed_at": now}
+	if err != nil {
+		updates["last_error"] = truncate(err.Error(), 255)
+	}
+	if result := db.DB.Model(message).Updates(updates); result.Error != nil {
+		return result.Error
+	}
+	return err
+}
+
+// scheduleRetry records the failed attempt and schedules the next one with exponential backoff
+func scheduleRetry(message *model.OutboxMessage, err error) error {
+	backoff := outboxInterval << (message.Attempts - 1)
+	if backoff > outboxMaxBackoff || backoff <= 0 {
+		backoff = outboxMaxBackoff
+	}
+	message.NextAttemptAt = time.Now().Add(backoff)
+	return db.DB.Model(message).Updates(map[string]interface{}{
+		"attempts":        message.Attempts,
+		"next_attempt_at": message.NextAttemptAt,
+		"last_error":      truncate(err.Error(), 255),
+	}).Error
+}
+
+// giveUpConfirmation expires the given booking and releases the property in case one of the attempts reserved it
+// NOTE: The whole group of the booking is expired, as its bookings are only confirmed together.
+func giveUpConfirmation(message *model.OutboxMessage, booking *model.Booking, err error) error {
+	reason := truncate(fmt.Sprintf("Confirmation failed %d times: %v", message.Attempts, err), 255)
+	bookings := []*model.Booking{booking}
+	if booking.GroupId != nil {
+		group, err := GetGroupBooking(*booking.GroupId)
+		if err != nil {
+			return err
+		}
+		if group != nil {
+			bookings = pendingBookings(group.Bookings)
+		}
+	}
+
+	now := time.Now()
+	records := make([]*model.BookingTransition, len(bookings))
+	releases := make([]*model.OutboxMessage, len(bookings))
+	txErr := db.DB.Transaction(func(tx *gorm.DB) error {
+		for i, booking := range bookings {
+			var err error
+			if records[i], err = writeTransition(tx, booking, model.EXPIRED, systemActor, reason); err != nil {
+				return err
+			}
+			if releases[i], err = enqueue(tx, booking, model.RELEASE_PROPERTY, booking.PropertyId); err != nil {
+				return err
+			}
+		}
+		return tx.Model(message).Updates(map[string]interface{}{
+			"attempts":     message.Attempts,
+			"processed_at": now,
+			"last_error":   reason,
+		}).Error
+	})
+	if txErr != nil {
+		return txErr
+	}
+	message.ProcessedAt = &now
+
+	for i, booking := range bookings {
+		applyTransition(booking, records[i])
+		if err := processOutboxMessage(releases[i], booking); err != nil && !isDeclined(err) {
+			entry := log.WithField("bookingId", booking.ID)
+			entry.Warnf("Releasing the property failed, the outbox dispatcher will retry: %v", err)
+		}
+	}
+	return nil
+}
+
+// truncate shortens the given text to at most the given number of characters without splitting a character
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// QuoteBooking connects to the property service via gRPC and computes the price of a stay
+// from checkIn to checkOut at the property matching the given id without booking it
+func QuoteBooking(propertyId uint, checkIn time.Time, checkOut time.Time) (*model.Price, error) {
+	checkIn, checkOut = model.TruncateToDay(checkIn), model.TruncateToDay(checkOut)
+	if !checkOut.After(checkIn) {
+		return nil, &model.BookingError{Message: "Check-out must be at least one day after check-in"}
+	}
+
+	var quote *proto.StayQuote
+	err := callPropertyService(func(ctx context.Context, propertyClient proto.PropertyInternalClient) error {
+		var err error
+		quote, err = propertyClient.QuoteStay(ctx, &proto.BookingReq{
+			PropertyId: uint32(propertyId),
+			CheckIn:    timestamppb.New(checkIn),
+			CheckOut:   timestamppb.New(checkOut),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	price := mapToPrice(quote)
+	return &price, nil
+}
+
+// priceColumns maps the given price to the columns of a booking
+func priceColumns(price model.Price) map[string]interface{} {
+	return map[string]interface{}{
+		"price_nights":       price.Nights,
+		"price_nightly_rate": price.NightlyRate,
+		"price_cleaning_fee": price.CleaningFee,
+		"price_subtotal":     price.Subtotal,
+		"price_tax":          price.Tax,
+		"price_total":        price.Total,
+		"price_currency":     price.Currency,
+	}
+}
+
+func mapToPrice(quote *proto.StayQuote) model.Price {
+	return model.Price{
+		Nights:      quote.Nights,
+		NightlyRate: quote.NightlyRate,
+		CleaningFee: quote.CleaningFee,
+		Subtotal:    quote.Subtotal,
+		Tax:         quote.Tax,
+		Total:       quote.Total,
+		Currency:    quote.Currency,
+	}
+}
+
+func mapToProtoStayQuote(price model.Price) *proto.StayQuote {
+	return &proto.StayQuote{
+		Nights:      price.Nights,
+		NightlyRate: price.NightlyRate,
+		CleaningFee: price.CleaningFee,
+		Subtotal:    price.Subtotal,
+		Tax:         price.Tax,
+		Total:       price.Total,
+		Currency:    price.Currency,
+	}
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	// 0 disables the periodic reconciliation
+	reconcileInterval = getDurationEnv("RECONCILE_INTERVAL", time.Hour)
+	// the periodic reconciliation only reports discrepancies unless this is set to false
+	reconcileDryRun = getBoolEnv("RECONCILE_DRY_RUN", true)
+	// bookings changed more recently are not reconciled yet
+	reconcileGrace = getDurationEnv("RECONCILE_GRACE", 10*time.Minute)
+)
+
+// Reconcile compares the bookings with the reservations of the property service and repairs the discrepancies
+// unless dryRun is set
+// NOTE: Only stays that have not ended yet are compared. Bookings that may be changing are skipped, see busyBookings.
+// Discrepancies without a safe repair are only reported.
+// Bookings may change while they are compared, so every repair checks the current state again, see repair.
+func Reconcile(dryRun bool) (*model.ReconciliationReport, error) {
+	report := &model.ReconciliationReport{StartedAt: time.Now(), DryRun: dryRun, Discrepancies: []model.Discrepancy{}}
+	today := model.TruncateToDay(report.StartedAt)
+
+	var bookings []model.Booking
+	if err := db.DB.Where("check_out > ?", today).Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+	reservations, err := listReservations(today)
+	if err != nil {
+		return nil, err
+	}
+	report.Bookings, report.Reservations = len(bookings), len(reservations)
+
+	skipped, err := busyBookings(report.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	bookingsById := make(map[uint]*model.Booking)
+	for i := range bookings {
+		bookingsById[bookings[i].ID] = &bookings[i]
+	}
+	// reservations may belong to bookings whose stay has changed or ended since
+	if err := loadMissingBookings(bookingsById, reservations); err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[uint]bool)
+	for _, reservation := range reservations {
+		bookingId, propertyId := uint(reservation.BookingId), uint(reservation.PropertyId)
+		if skipped[bookingId] {
+			continue
+		}
+		booking := bookingsById[bookingId]
+		if booking != nil && booking.PropertyId == propertyId {
+			reserved[bookingId] = true
+		}
+
+		switch {
+		case booking == nil:
+			report.Discrepancies = append(report.Discrepancies, model.Discrepancy{
+				Kind:        model.ORPHANED_RESERVATION,
+				BookingId:   bookingId,
+				PropertyId:  propertyId,
+				Description: fmt.Sprintf("Property %d is reserved for booking %d which does not exist", propertyId, bookingId),
+				Repair:      model.FREE_PROPERTY,
+			})
+		case !booking.HoldsReservation() || booking.PropertyId != propertyId:
+			report.Discrepancies = append(report.Discrepancies, model.Discrepancy{
+				Kind:          model.ORPHANED_RESERVATION,
+				BookingId:     bookingId,
+				PropertyId:    propertyId,
+				BookingStatus: booking.Status,
+				Description: fmt.Sprintf("Property %d is reserved for booking %d which is %s at property %d",
+					propertyId, bookingId, booking.Status, booking.PropertyId),
+				Repair: model.FREE_PROPERTY,
+			})
+		case !booking.CheckIn.Equal(reservation.CheckIn.AsTime()) || !booking.CheckOut.Equal(reservation.CheckOut.AsTime()) ||
+			reservation.Status != expectedReservationStatus(booking):
+			report.Discrepancies = append(report.Discrepancies, model.Discrepancy{
+				Kind:          model.RESERVATION_MISMATCH,
+				BookingId:     bookingId,
+				PropertyId:    propertyId,
+				BookingStatus: booking.Status,
+				Description: fmt.Sprintf("Property %d is reserved %s from %s to %s for booking %d which is %s from %s to %s",
+					propertyId, reservation.Status, reservation.CheckIn.AsTime().Format(time.DateOnly), reservation.CheckOut.AsTime().Format(time.DateOnly),
+					bookingId, booking.Status, booking.CheckIn.Format(time.DateOnly), booking.CheckOut.Format(time.DateOnly)),
+				Repair: model.MANUAL,
+			})
+		}
+	}
+
+	for _, booking := range bookings {
+		if skipped[booking.ID] || reserved[booking.ID] || !booking.HoldsReservation() {
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, model.Discrepancy{
+			Kind:          model.MISSING_RESERVATION,
+			BookingId:     booking.ID,
+			PropertyId:    booking.PropertyId,
+			BookingStatus: booking.Status,
+			Description:   fmt.Sprintf("Booking %d is %s but property %d has no reservation for it", booking.ID, booking.Status, booking.PropertyId),
+			Repair:        model.RESERVE_PROPERTY,
+		})
+	}
+
+	if !dryRun && len(report.Discrepancies) > 0 {
+		current, err := listReservations(today)
+		if err != nil {
+			return nil, err
+		}
+		for i := range report.Discrepancies {
+			repair(&report.Discrepancies[i], current)
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	log.Infof("Reconciled %d bookings with %d reservations: %d discrepancies, %d unrepaired",
+		report.Bookings, report.Reservations, len(report.Discrepancies), report.Unrepaired())
+	return report, nil
+}
+
+// StartReconciler periodically reconciles the bookings in the background until the returned function is called
+func StartReconciler() func() {
+	if reconcileInterval <= 0 {
+		log.Info("Periodic reconciliation is disabled")
+		return func() {}
+	}
+	ticker := time.NewTicker(reconcileInterval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				report, err := Reconcile(reconcileDryRun)
+				if err != nil {
+					log.Errorf("Error reconciling bookings: %v", err)
+					continue
+				}
+				if len(report.Discrepancies) > 0 {
+					data, _ := json.Marshal(report)
+					log.Warnf("Reconciliation report: %s", data)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	log.Infof("Started reconciler with interval %s, dry run: %t", reconcileInterval, reconcileDryRun)
+	return func() {
+		close(done)
+	}
+}
+
+// repair carries out the repair action of the given discrepancy and records the outcome
+// NOTE: The booking is read again right before the repair, which is skipped if the discrepancy is gone by now,
+// e.g. because the booking was cancelled or confirmed in the meantime. The given reservations are the current ones.
+func repair(discrepancy *model.Discrepancy, reservations []*proto.ReservationEntry) {
+	if discrepancy.Repair != model.FREE_PROPERTY && discrepancy.Repair != model.RESERVE_PROPERTY {
+		return
+	}
+	entry := log.WithField("bookingId", discrepancy.BookingId)
+
+	booking, err := GetBooking(discrepancy.BookingId)
+	if err == nil {
+		var reason string
+		reason, err = changedSinceComparison(discrepancy, booking, reservations)
+		if err == nil && reason != "" {
+			entry.Infof("Skipping repair %s of %s: %s", discrepancy.Repair, discrepancy.Kind, reason)
+			discrepancy.RepairError = "Skipped, " + reason
+			return
+		}
+	}
+	if err == nil {
+		if discrepancy.Repair == model.FREE_PROPERTY {
+			err = releaseProperty(&model.Booking{Model: gorm.Model{ID: discrepancy.BookingId}}, discrepancy.PropertyId)
+		} else {
+			_, err = reserveProperty(booking, discrepancy.PropertyId, "", nil)
+		}
+	}
+
+	if err != nil {
+		entry.Warnf("Repair %s of %s failed: %v", discrepancy.Repair, discrepancy.Kind, err)
+		discrepancy.RepairError = err.Error()
+		return
+	}
+	entry.Infof("Repaired %s via %s", discrepancy.Kind, discrepancy.Repair)
+	discrepancy.Repaired = true
+}
+
+// changedSinceComparison checks whether the given discrepancy still applies to the given current booking,
+// which is nil if it does not exist, and the given current reservations, and returns the reason if not
+func changedSinceComparison(discrepancy *model.Discrepancy, booking *model.Booking, reservations []*proto.ReservationEntry) (string, error) {
+	busy, err := busyBookings(time.Now())
+	if err != nil {
+		return "", err
+	}
+	if busy[discrepancy.BookingId] {
+		return "the booking is changing", nil
+	}
+
+	reserved := false
+	for _, reservation := range reservations {
+		if uint(reservation.BookingId) == discrepancy.BookingId && uint(reservation.PropertyId) == discrepancy.PropertyId {
+			reserved = true
+		}
+	}
+	holdsReservation := booking != nil && booking.HoldsReservation() && booking.PropertyId == discrepancy.PropertyId
+
+	if discrepancy.Repair == model.FREE_PROPERTY {
+		if !reserved {
+			return "the reservation no longer exists", nil
+		}
+		if holdsReservation {
+			return fmt.Sprintf("the booking is %s at the property by now", booking.Status), nil
+		}
+		return "", nil
+	}
+	if !holdsReservation {
+		return "the booking no longer holds a reservation at the property", nil
+	}
+	if reserved {
+		return "the reservation exists by now", nil
+	}
+	return "", nil
+}
+
+// busyBookings returns the ids of the bookings that may be changing at the given time, so they must not be repaired:
+// bookings with unprocessed outbox messages, the other bookings of their groups and bookings changed within the grace period
+// NOTE: A single message confirms a whole group, see runConfirmStep.
+func busyBookings(now time.Time) (map[uint]bool, error) {
+	var inSaga []uint
+	if err := db.DB.Model(new(model.OutboxMessage)).Where("processed_at IS NULL").Distinct().Pluck("booking_id", &inSaga).Error; err != nil {
+		return nil, err
+	}
+	busy := make(map[uint]bool)
+	for _, id := range inSaga {
+		busy[id] = true
+	}
+
+	var changing []uint
+	query := db.DB.Model(new(model.Booking)).Where("updated_at > ?", now.Add(-reconcileGrace))
+	if len(inSaga) > 0 {
+		groupsInSaga := db.DB.Model(new(model.Booking)).Select("group_id").Where("id IN (?) AND group_id IS NOT NULL", inSaga)
+		query = db.DB.Model(new(model.Booking)).Where("updated_at > ? OR group_id IN (?)", now.Add(-reconcileGrace), groupsInSaga)
+	}
+	if err := query.Pluck("id", &changing).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range changing {
+		busy[id] = true
+	}
+	return busy, nil
+}
+
+// loadMissingBookings adds the bookings of the given reservations which are not in the given map yet
+func loadMissingBookings(bookingsById map[uint]*model.Booking, reservations []*proto.ReservationEntry) error {
+	var missing []uint
+	for _, reservation := range reservations {
+		if _, ok := bookingsById[uint(reservation.BookingId)]; !ok {
+			missing = append(missing, uint(reservation.BookingId))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var bookings []model.Booking
+	if err := db.DB.Find(&bookings, missing).Error; err != nil {
+		return err
+	}
+	for i := range bookings {
+		bookingsById[bookings[i].ID] = &bookings[i]
+	}
+	return nil
+}
+
+// expectedReservationStatus returns the status the reservation of the given booking should have
+func expectedReservationStatus(booking *model.Booking) string {
+	if booking.Status == model.PENDING && booking.ApprovalRequired {
+		return "PENDING_APPROVAL"
+	}
+	return "CONFIRMED"
+}
+
+// listReservations connects to the property service via gRPC and retrieves all reservations ending after the given time
+func listReservations(checkOutAfter time.Time) ([]*proto.ReservationEntry, error) {
+	var list *proto.ReservationList
+	err := callPropertyService(func(ctx context.Context, propertyClient proto.PropertyInternalClient) error {
+		var err error
+		list, err = propertyClient.ListReservations(ctx, &proto.ListReservationsReq{CheckOutAfter: timestamppb.New(checkOutAfter)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Reservations, nil
+}
+
+// getBoolEnv parses the env variable with the given key as bool, e.g. "true"
+func getBoolEnv(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// CreateBookingSeries creates the given series with one booking per occurrence of its recurrence rule,
+// starting with the stay from checkIn to checkOut, and confirms each occurrence at the property service
+// NOTE: Unlike group bookings, occurrences are confirmed independently. Occurrences the property declines
+// are rejected and reported as conflicts by the series, the others stay booked.
+// Every confirmation is a step of the outbox, if the property service is unavailable the dispatcher retries it.
+func CreateBookingSeries(series *model.BookingSeries, checkIn time.Time, checkOut time.Time, guests model.Guests) error {
+	occurrences, err := series.Occurrences(checkIn, checkOut)
+	if err != nil {
+		return err
+	}
+	if guests.Adults == 0 {
+		guests.Adults = 1
+	}
+	customer, err := getCustomer(series.CustomerId)
+	if err != nil {
+		return err
+	}
+	series.CustomerName = customer.Name
+
+	for _, occurrence := range occurrences {
+		booking := model.Booking{
+			Comment:      series.Comment,
+			CustomerId:   series.CustomerId,
+			CustomerName: series.CustomerName,
+			PropertyId:   series.PropertyId,
+			CheckIn:      occurrence.CheckIn,
+			CheckOut:     occurrence.CheckOut,
+			Guests:       guests,
+		}
+		booking.SetStatusPending()
+		booking.Transitions = []model.BookingTransition{{ToStatus: model.PENDING, Actor: series.CustomerName}}
+		series.Bookings = append(series.Bookings, booking)
+	}
+
+	messages := make([]*model.OutboxMessage, len(series.Bookings))
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(series).Error; err != nil {
+			return err
+		}
+		for i := range series.Bookings {
+			var err error
+			if messages[i], err = enqueue(tx, &series.Bookings[i], model.CONFIRM_BOOKING, series.PropertyId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	entry := log.WithField("seriesId", series.ID)
+	entry.Infof("Successfully stored new booking series with %d occurrences in database.", len(series.Bookings))
+
+	for i := range series.Bookings {
+		booking := &series.Bookings[i]
+		if err := processOutboxMessage(messages[i], booking); err != nil {
+			checkIn := booking.CheckIn.Format(time.DateOnly)
+			if isDeclined(err) {
+				entry.Infof("Occurrence %d from %s could not be confirmed: %v", booking.ID, checkIn, err)
+			} else {
+				entry.Warnf("Confirmation of occurrence %d from %s failed, the outbox dispatcher will retry: %v", booking.ID, checkIn, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetBookingSeries retrieves the booking series matching the given id including its occurrences
+func GetBookingSeries(id uint) (*model.BookingSeries, error) {
+	series := new(model.BookingSeries)
+	result := db.DB.Preload("Bookings", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("check_in")
+	}).Preload("Bookings.Transitions").First(series, id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	log.Tracef("Retrieved: %v", series)
+	return series, nil
+}
+
+// CancelBookingSeries cancels all occurrences of the booking series matching the given id for the given reason
+func CancelBookingSeries(id uint, actor string, reason string) (*model.BookingSeries, error) {
+	series, err := GetBookingSeries(id)
+	if series == nil || err != nil {
+		return series, err
+	}
+
+	if err := cancelAll(series.Bookings, actor, reason); err != nil {
+		return nil, err
+	}
+
+	entry := log.WithField("seriesId", series.ID)
+	entry.Info("Successfully cancelled booking series.")
+	return series, nil
+}
+
+// CancelSeriesOccurrence cancels the occurrence matching the given booking id of the booking series matching the given id
+func CancelSeriesOccurrence(id uint, bookingId uint, actor string, reason string) (*model.BookingSeries, error) {
+	series, err := GetBookingSeries(id)
+	if series == nil || err != nil {
+		return series, err
+	}
+
+	for i := range series.Bookings {
+		booking := &series.Bookings[i]
+		if booking.ID != bookingId {
+			continue
+		}
+		if _, err := release(booking, model.CANCELLED, actor, reason); err != nil {
+			return nil, err
+		}
+		return series, nil
+	}
+	return nil, &model.BookingError{Message: fmt.Sprintf("Booking %d is not an occurrence of series %d", bookingId, id)}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"github.com/HaCaK/pse-bee-gobooking/src/booking/proto"
+)
+
+// JoinWaitlist connects to the property service via gRPC and queues the customer of the request for the requested stay
+func JoinWaitlist(req *proto.WaitlistReq) (*proto.WaitlistEntry, error) {
+	var waitlistEntry *proto.WaitlistEntry
+	err := callPropertyService(func(ctx context.Context, propertyClient proto.PropertyInternalClient) error {
+		var err error
+		waitlistEntry, err = propertyClient.AddToWaitlist(ctx, req)
+		return err
+	})
+	return waitlistEntry, err
+}
+
+// LeaveWaitlist connects to the property service via gRPC and removes the waitlist entry of the request
+func LeaveWaitlist(req *proto.WaitlistReq) error {
+	return callPropertyService(func(ctx context.Context, propertyClient proto.PropertyInternalClient) error {
+		_, err := propertyClient.RemoveFromWaitlist(ctx, req)
+		return err
+	})
+}
+
+// GetWaitlist connects to the property service via gRPC and retrieves the waitlist entries matching the request
+func GetWaitlist(req *proto.WaitlistReq) ([]*proto.WaitlistEntry, error) {
+	var waitlist *proto.Waitlist
+	err := callPropertyService(func(ctx context.Context, propertyClient proto.PropertyInternalClient) error {
+		var err error
+		waitlist, err = propertyClient.GetWaitlist(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return waitlist.Entries, nil
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var DB *gorm.DB
@@ -29,9 +31,88 @@ func Connect(connect string) error {
 		return errors.New("failed to connect database")
 	}
 	log.Info("Starting automatic migration")
-	if err := DB.Debug().AutoMigrate(&model.Property{}); err != nil {
+	if err := DB.Debug().AutoMigrate(&model.Property{}, &model.Reservation{}, &model.RefundTier{}, &model.Hold{}, &model.WaitlistEntry{}, &model.IdempotencyRecord{}, &model.SearchTerm{}, &model.Amenity{}, &model.Tag{}, &model.Photo{}, &model.Review{}); err != nil {
+		return err
+	}
+	if err := migrateBookedProperties(); err != nil {
+		return err
+	}
+	amenities := append([]model.Amenity(nil), model.DefaultAmenities...)
+	if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&amenities).Error; err != nil {
 		return err
 	}
 	log.Info("Finished automatic migration")
 	return nil
 }
+
+// migrateBookedProperties replaces the status and booking id of properties that used to be booked as a whole
+// by reservations and drops these columns afterwards
+// NOTE: Bookings used to have no dates, so the stay is taken from the bookings table of the booking service,
+// which has to be migrated first. The migration fails and keeps the columns instead of freeing a property
+// whose stay is unknown.
+func migrateBookedProperties() error {
+	migrator := DB.Migrator()
+	if migrator.HasColumn(&model.Property{}, "status") && migrator.HasColumn(&model.Property{}, "booking_id") {
+		var booked []struct {
+			Id        uint
+			BookingId uint
+		}
+		result := DB.Table("properties").Select("id, booking_id").
+			Where("status = ? AND booking_id <> 0 AND deleted_at IS NULL", "BOOKED").Scan(&booked)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			for _, property := range booked {
+				var reservations int64
+				result := tx.Model(new(model.Reservation)).
+					Where("property_id = ? AND booking_id = ?", property.Id, property.BookingId).Count(&reservations)
+				if result.Error != nil {
+					return result.Error
+				}
+				if reservations > 0 {
+					continue
+				}
+
+				var stay struct {
+					CheckIn  time.Time
+					CheckOut time.Time
+				}
+				result = tx.Table("bookings").Select("check_in, check_out").Where("id = ?", property.BookingId).Limit(1).Scan(&stay)
+				if result.Error != nil {
+					return fmt.Errorf("failed to read the stay of booking %d of property %d: %w", property.BookingId, property.Id, result.Error)
+				}
+				if result.RowsAffected == 0 || !stay.CheckOut.After(stay.CheckIn) {
+					return fmt.Errorf("property %d is booked by booking %d without a known stay, "+
+						"set its check-in and check-out before migrating", property.Id, property.BookingId)
+				}
+
+				reservation := model.Reservation{
+					PropertyId:        property.Id,
+					BookingId:         property.BookingId,
+					CheckIn:           model.TruncateToDay(stay.CheckIn),
+					CheckOut:          model.TruncateToDay(stay.CheckOut),
+					ReservationStatus: model.CONFIRMED,
+				}
+				if err := tx.Create(&reservation).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("Migrated %d booked properties to reservations", len(booked))
+	}
+
+	for _, column := range []string{"status", "booking_id"} {
+		if migrator.HasColumn(&model.Property{}, column) {
+			if err := migrator.DropColumn(&model.Property{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
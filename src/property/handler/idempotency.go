@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/service"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	googleproto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// idempotencyKeyHeader is the gRPC metadata key to which the proxy forwards the Idempotency-Key HTTP header
+const idempotencyKeyHeader = "idempotency-key"
+
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyInterceptor makes requests carrying an Idempotency-Key safe to retry:
+// the response of the first successful request is stored and returned for every repetition
+// NOTE: Failed requests are not stored, so a retry with the same key handles the request again.
+// Reusing a key for a different request is rejected. Only the methods in idempotentMethods are covered,
+// the key of any other request is ignored.
+// This file is identical in the property and the booking service apart from the imports,
+// changes have to be made to both copies.
+func IdempotencyInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	key := getIdempotencyKey(ctx)
+	request, ok := req.(googleproto.Message)
+	if key == "" || !ok || !idempotentMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, status.Errorf(codes.InvalidArgument, "Idempotency-Key must not be longer than %d characters", maxIdempotencyKeyLength)
+	}
+
+	requestHash, err := hashRequest(request)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	record, err := service.StartIdempotentRequest(key, info.FullMethod, requestHash)
+	if err != nil {
+		var idempotencyError *model.IdempotencyError
+		if errors.As(err, &idempotencyError) {
+			if idempotencyError.InProgress {
+				return nil, status.Errorf(codes.Unavailable, err.Error())
+			}
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		log.Errorf("Error calling service StartIdempotentRequest with key %s: %v", key, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if record.IsCompleted() {
+		stored := new(anypb.Any)
+		if err := googleproto.Unmarshal(record.Response, stored); err != nil {
+			return nil, status.Errorf(codes.Internal, err.Error())
+		}
+		return stored.UnmarshalNew()
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		if abortErr := service.AbortIdempotentRequest(record); abortErr != nil {
+			log.Errorf("Error calling service AbortIdempotentRequest with key %s: %v", key, abortErr)
+		}
+		return nil, err
+	}
+
+	if err := storeResponse(record, resp); err != nil {
+		// the request succeeded, only retries will not be recognized
+		log.Errorf("Error storing response for Idempotency-Key %s: %v", key, err)
+		if abortErr := service.AbortIdempotentRequest(record); abortErr != nil {
+			log.Errorf("Error calling service AbortIdempotentRequest with key %s: %v", key, abortErr)
+		}
+	}
+	return resp, nil
+}
+
+func getIdempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(idempotencyKeyHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// hashRequest fingerprints the request, so that a key cannot be reused for a different request
+func hashRequest(request googleproto.Message) (string, error) {
+	data, err := googleproto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func storeResponse(record *model.IdempotencyRecord, resp interface{}) error {
+	message, ok := resp.(googleproto.Message)
+	if !ok {
+		return errors.New("response is not a protobuf message")
+	}
+	stored, err := anypb.New(message)
+	if err != nil {
+		return err
+	}
+	data, err := googleproto.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return service.CompleteIdempotentRequest(record, data)
+}
@@ -0,0 +1,63 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"net"
+)
+
+type MockBookingInternalServer struct {
+	proto.BookingInternalServer
+	// stays returned by GetStay by booking id
+	Stays map[uint32]*proto.StayResp
+	// booking id for which DeclineBooking fails as if the booking service was unavailable
+	UnavailableBookingId uint32
+}
+
+// Start creates and starts a mock BookingInternalServer that listens on the given port
+// this is done to isolate testing of property service from the actual implementation of the booking service
+func (h *MockBookingInternalServer) Start(port string) func() {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Fatalf("Failed to listen on grpc port %s: %v", port, err)
+	}
+
+	baseServer := grpc.NewServer()
+	proto.RegisterBookingInternalServer(baseServer, h)
+	go func() {
+		if err := baseServer.Serve(lis); err != nil {
+			log.Printf("Error serving bookingInternalServer: %v", err)
+		}
+	}()
+
+	closer := func() {
+		baseServer.Stop()
+	}
+
+	return closer
+}
+
+func (h *MockBookingInternalServer) ApproveBooking(_ context.Context, _ *proto.BookingDecisionReq) (*emptypb.Empty, error) {
+	return new(emptypb.Empty), nil
+}
+
+func (h *MockBookingInternalServer) DeclineBooking(_ context.Context, req *proto.BookingDecisionReq) (*emptypb.Empty, error) {
+	if req.BookingId != 0 && req.BookingId == h.UnavailableBookingId {
+		return nil, status.Errorf(codes.Unavailable, "Booking service unavailable")
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (h *MockBookingInternalServer) GetStay(_ context.Context, req *proto.StayReq) (*proto.StayResp, error) {
+	stay, ok := h.Stays[req.BookingId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Booking not found")
+	}
+	return stay, nil
+}
@@ -0,0 +1,75 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"strings"
+)
+
+type MockUserInternalServer struct {
+	proto.UserInternalServer
+	// accounts returned by GetAccount by user id, EnsureAccounts adds the accounts of new names
+	Accounts map[uint32]*proto.Account
+}
+
+// Start creates and starts a mock UserInternalServer that listens on the given port
+// this is done to isolate testing of property service from the actual implementation of the user service
+func (h *MockUserInternalServer) Start(port string) func() {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Fatalf("Failed to listen on grpc port %s: %v", port, err)
+	}
+
+	baseServer := grpc.NewServer()
+	proto.RegisterUserInternalServer(baseServer, h)
+	go func() {
+		if err := baseServer.Serve(lis); err != nil {
+			log.Printf("Error serving userInternalServer: %v", err)
+		}
+	}()
+
+	closer := func() {
+		baseServer.Stop()
+	}
+
+	return closer
+}
+
+func (h *MockUserInternalServer) GetAccount(_ context.Context, req *proto.AccountReq) (*proto.Account, error) {
+	account, ok := h.Accounts[req.Id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "User %d not found", req.Id)
+	}
+	return account, nil
+}
+
+func (h *MockUserInternalServer) EnsureAccounts(_ context.Context, req *proto.EnsureAccountsReq) (*proto.AccountList, error) {
+	list := new(proto.AccountList)
+	for _, name := range req.Names {
+		if strings.TrimSpace(name) == "" || len([]rune(name)) > 60 {
+			return nil, status.Errorf(codes.InvalidArgument, "Name must contain 1 to 60 characters")
+		}
+		account := h.findAccount(name)
+		if account == nil {
+			account = &proto.Account{Id: uint32(len(h.Accounts) + 1), Name: name, Roles: []string{req.Role}}
+			h.Accounts[account.Id] = account
+		}
+		list.Accounts = append(list.Accounts, account)
+	}
+	return list, nil
+}
+
+func (h *MockUserInternalServer) findAccount(name string) *proto.Account {
+	for _, account := range h.Accounts {
+		if strings.EqualFold(account.Name, name) {
+			return account
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/service"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MaxMessageSize allows gRPC messages to carry a photo of model.MaxPhotoSize
+const MaxMessageSize = model.MaxPhotoSize + 1<<20
+
+func (h *PropertyHandler) UploadPhoto(_ context.Context, req *proto.UploadPhotoReq) (*proto.PhotoResp, error) {
+	photo, err := service.UploadPhoto(uint(req.PropertyId), req.Data)
+	if err != nil {
+		log.Errorf("Error calling service UploadPhoto for property with ID %v: %v", req.PropertyId, err)
+		return nil, mapPhotoError(err)
+	}
+	if photo == nil {
+		return nil, status.Errorf(codes.NotFound, "Property not found")
+	}
+	return mapToProtoPhotoResp(photo), nil
+}
+
+func (h *PropertyHandler) GetPhotoContent(_ context.Context, req *proto.PhotoContentReq) (*proto.PhotoContentResp, error) {
+	photo, data, err := service.GetPhotoContent(uint(req.PropertyId), uint(req.PhotoId), req.Thumbnail)
+	if err != nil {
+		log.Errorf("Error calling service GetPhotoContent with ID %v: %v", req.PhotoId, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if photo == nil {
+		return nil, status.Errorf(codes.NotFound, "Photo not found")
+	}
+
+	contentType := photo.ContentType
+	if req.Thumbnail {
+		contentType = "image/jpeg"
+	}
+	return &proto.PhotoContentResp{ContentType: contentType, Data: data, CreatedAt: timestamppb.New(photo.CreatedAt)}, nil
+}
+
+func (h *PropertyHandler) ListPhotos(_ context.Context, req *proto.PropertyPhotosReq) (*proto.ListPhotosResp, error) {
+	photos, err := service.GetPhotos(uint(req.PropertyId))
+	if err != nil {
+		log.Errorf("Error calling service GetPhotos for property with ID %v: %v", req.PropertyId, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	return &proto.ListPhotosResp{Photos: mapToProtoPhotoResps(photos)}, nil
+}
+
+func (h *PropertyHandler) ReorderPhotos(_ context.Context, req *proto.ReorderPhotosReq) (*proto.ListPhotosResp, error) {
+	photoIds := make([]uint, len(req.PhotoIds))
+	for i, id := range req.PhotoIds {
+		photoIds[i] = uint(id)
+	}
+
+	photos, err := service.ReorderPhotos(uint(req.PropertyId), photoIds)
+	if err != nil {
+		log.Errorf("Error calling service ReorderPhotos for property with ID %v: %v", req.PropertyId, err)
+		return nil, mapPhotoError(err)
+	}
+	return &proto.ListPhotosResp{Photos: mapToProtoPhotoResps(photos)}, nil
+}
+
+func (h *PropertyHandler) SetCoverPhoto(_ context.Context, req *proto.PhotoIdReq) (*proto.ListPhotosResp, error) {
+	photos, err := service.SetCoverPhoto(uint(req.PropertyId), uint(req.PhotoId))
+	if err != nil {
+		log.Errorf("Error calling service SetCoverPhoto with ID %v: %v", req.PhotoId, err)
+		return nil, mapPhotoError(err)
+	}
+	if photos == nil {
+		return nil, status.Errorf(codes.NotFound, "Photo not found")
+	}
+	return &proto.ListPhotosResp{Photos: mapToProtoPhotoResps(photos)}, nil
+}
+
+func (h *PropertyHandler) DeletePhoto(_ context.Context, req *proto.PhotoIdReq) (*emptypb.Empty, error) {
+	photo, err := service.DeletePhoto(uint(req.PropertyId), uint(req.PhotoId))
+	if err != nil {
+		log.Errorf("Error calling service DeletePhoto with ID %v: %v", req.PhotoId, err)
+		return nil, mapPhotoError(err)
+	}
+	if photo == nil {
+		return nil, status.Errorf(codes.NotFound, "Photo not found")
+	}
+	return new(emptypb.Empty), nil
+}
+
+// mapPhotoError rejects invalid photos and requests with InvalidArgument
+func mapPhotoError(err error) error {
+	var propertyError *model.PropertyError
+	if errors.As(err, &propertyError) {
+		return status.Errorf(codes.InvalidArgument, propertyError.Error())
+	}
+	return status.Errorf(codes.Internal, err.Error())
+}
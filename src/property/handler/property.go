@@ -10,6 +10,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"time"
 )
 
 type PropertyHandler struct {
@@ -17,33 +18,126 @@ type PropertyHandler struct {
 	proto.PropertyInternalServer
 }
 
+// idempotentMethods lists the methods that change properties, their requests may carry an Idempotency-Key
+var idempotentMethods = map[string]bool{
+	proto.PropertyExternal_CreateProperty_FullMethodName: true,
+	proto.PropertyExternal_UpdateProperty_FullMethodName: true,
+	proto.PropertyExternal_DeleteProperty_FullMethodName: true,
+	proto.PropertyExternal_HoldProperty_FullMethodName:   true,
+	proto.PropertyExternal_ApproveBooking_FullMethodName: true,
+	proto.PropertyExternal_DeclineBooking_FullMethodName: true,
+	proto.PropertyExternal_JoinWaitlist_FullMethodName:   true,
+	proto.PropertyExternal_LeaveWaitlist_FullMethodName:  true,
+	proto.PropertyExternal_CreateAmenity_FullMethodName:  true,
+	proto.PropertyExternal_UploadPhoto_FullMethodName:    true,
+	proto.PropertyExternal_ReorderPhotos_FullMethodName:  true,
+	proto.PropertyExternal_SetCoverPhoto_FullMethodName:  true,
+	proto.PropertyExternal_DeletePhoto_FullMethodName:    true,
+	proto.PropertyExternal_CreateReview_FullMethodName:   true,
+	proto.PropertyExternal_ReplyToReview_FullMethodName:  true,
+}
+
 func (h *PropertyHandler) CreateProperty(_ context.Context, req *proto.CreatePropertyReq) (*proto.PropertyResp, error) {
 	property := model.Property{
 		Name:        req.Name,
 		Description: req.Description,
-		OwnerName:   req.OwnerName,
+		OwnerId:     uint(req.OwnerId),
 		Address:     req.Address,
+		MaxGuests:   req.MaxGuests,
+		Bedrooms:    req.Bedrooms,
+		NoPets:      req.NoPets,
+	}
+	if err := property.SetBookingMode(req.BookingMode); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if err := property.SetPricing(req.NightlyRate, req.CleaningFee, req.Currency, req.TaxRate); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if err := property.SetCancellationPolicy(req.CancellationPolicy, mapToRefundTiers(req.RefundTiers)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if err := property.SetPostalAddress(mapToPostalAddress(req.PostalAddress)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if req.Location != nil {
+		if err := property.SetLocation(req.Location.Latitude, req.Location.Longitude); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+	}
+	property.SetAmenities(req.Amenities)
+	if err := property.SetTags(req.Tags); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
 	}
 
 	if err := service.CreateProperty(&property); err != nil {
 		log.Errorf("Error calling service CreateProperty: %v", err)
+
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
+		}
+		var permissionError *model.PermissionError
+		if errors.As(err, &permissionError) {
+			return nil, status.Errorf(codes.PermissionDenied, permissionError.Error())
+		}
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 
 	return mapToProtoPropertyResp(&property), nil
 }
 
-func (h *PropertyHandler) UpdateProperty(_ context.Context, req *proto.UpdatePropertyReq) (*proto.PropertyResp, error) {
+func (h *PropertyHandler) UpdateProperty(ctx context.Context, req *proto.UpdatePropertyReq) (*proto.PropertyResp, error) {
+	expectedVersion, err := getExpectedVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
 	property := model.Property{
 		Name:        req.Name,
 		Description: req.Description,
-		OwnerName:   req.OwnerName,
+		OwnerId:     uint(req.OwnerId),
 		Address:     req.Address,
+		MaxGuests:   req.MaxGuests,
+		Bedrooms:    req.Bedrooms,
+		NoPets:      req.NoPets,
+	}
+	if err := property.SetBookingMode(req.BookingMode); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if err := property.SetPricing(req.NightlyRate, req.CleaningFee, req.Currency, req.TaxRate); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if err := property.SetCancellationPolicy(req.CancellationPolicy, mapToRefundTiers(req.RefundTiers)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if err := property.SetPostalAddress(mapToPostalAddress(req.PostalAddress)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if req.Location != nil {
+		if err := property.SetLocation(req.Location.Latitude, req.Location.Longitude); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+	}
+	property.SetAmenities(req.Amenities)
+	if err := property.SetTags(req.Tags); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
 	}
 
-	updatedProperty, err := service.UpdateProperty(uint(req.Id), &property)
+	updatedProperty, err := service.UpdateProperty(uint(req.Id), &property, expectedVersion)
 	if err != nil {
 		log.Errorf("Error calling service UpdateProperty with ID %v: %v", req.Id, err)
+
+		var conflictError *model.VersionConflictError
+		if errors.As(err, &conflictError) {
+			return nil, status.Errorf(codes.Aborted, conflictError.Error())
+		}
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
+		}
+		var permissionError *model.PermissionError
+		if errors.As(err, &permissionError) {
+			return nil, status.Errorf(codes.PermissionDenied, permissionError.Error())
+		}
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 	if updatedProperty == nil {
@@ -65,10 +159,133 @@ func (h *PropertyHandler) GetProperty(_ context.Context, req *proto.PropertyIdRe
 	return mapToProtoPropertyResp(property), nil
 }
 
-func (h *PropertyHandler) GetProperties(_ context.Context, _ *emptypb.Empty) (*proto.ListPropertiesResp, error) {
-	properties, err := service.GetProperties()
+func (h *PropertyHandler) GetProperties(_ context.Context, req *proto.ListPropertiesReq) (*proto.ListPropertiesResp, error) {
+	filter := model.PropertyFilter{OwnerId: uint(req.OwnerId), Amenities: req.Amenity, Tags: req.Tag}
+	if req.CreatedAfter != nil {
+		filter.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+	if req.CreatedBefore != nil {
+		filter.CreatedBefore = req.CreatedBefore.AsTime()
+	}
+	page := model.PageRequest{PageSize: req.PageSize, PageToken: req.PageToken, OrderBy: req.OrderBy}
+
+	properties, nextPageToken, err := service.GetProperties(filter, page)
 	if err != nil {
 		log.Errorf("Error calling service GetProperties: %v", err)
+
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	facets, err := service.GetPropertyFacets(filter)
+	if err != nil {
+		log.Errorf("Error calling service GetPropertyFacets: %v", err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	var protoProperties []*proto.PropertyResp
+	for _, property := range properties {
+		protoProperties = append(protoProperties, mapToProtoPropertyResp(&property))
+	}
+	return &proto.ListPropertiesResp{
+		Properties:    protoProperties,
+		NextPageToken: nextPageToken,
+		AmenityFacets: mapToProtoFacetCounts(facets.Amenities),
+		TagFacets:     mapToProtoFacetCounts(facets.Tags),
+	}, nil
+}
+
+func (h *PropertyHandler) GetAmenities(_ context.Context, _ *emptypb.Empty) (*proto.ListAmenitiesResp, error) {
+	amenities, err := service.GetAmenities()
+	if err != nil {
+		log.Errorf("Error calling service GetAmenities: %v", err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	var protoAmenities []*proto.AmenityResp
+	for _, amenity := range amenities {
+		protoAmenities = append(protoAmenities, mapToProtoAmenityResp(&amenity))
+	}
+	return &proto.ListAmenitiesResp{Amenities: protoAmenities}, nil
+}
+
+func (h *PropertyHandler) CreateAmenity(_ context.Context, req *proto.CreateAmenityReq) (*proto.AmenityResp, error) {
+	amenity, err := model.NewAmenity(req.Code, req.Name)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	if err := service.CreateAmenity(amenity); err != nil {
+		log.Errorf("Error calling service CreateAmenity: %v", err)
+
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.AlreadyExists, propertyError.Error())
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	return mapToProtoAmenityResp(amenity), nil
+}
+
+func (h *PropertyHandler) SearchProperties(_ context.Context, req *proto.SearchPropertiesReq) (*proto.SearchPropertiesResp, error) {
+	page := model.PageRequest{PageSize: req.PageSize, PageToken: req.PageToken}
+	results, nextPageToken, err := service.SearchProperties(req.Q, page)
+	if err != nil {
+		log.Errorf("Error calling service SearchProperties: %v", err)
+
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	var protoResults []*proto.PropertySearchResult
+	for _, result := range results {
+		protoResults = append(protoResults, mapToProtoPropertySearchResult(&result))
+	}
+	return &proto.SearchPropertiesResp{Results: protoResults, NextPageToken: nextPageToken}, nil
+}
+
+func (h *PropertyHandler) GetNearbyProperties(_ context.Context, req *proto.NearbyPropertiesReq) (*proto.NearbyPropertiesResp, error) {
+	page := model.PageRequest{PageSize: req.PageSize, PageToken: req.PageToken}
+	nearby, nextPageToken, err := service.GetNearbyProperties(req.Lat, req.Lng, req.RadiusKm, page)
+	if err != nil {
+		log.Errorf("Error calling service GetNearbyProperties: %v", err)
+
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	var protoResults []*proto.NearbyProperty
+	for _, result := range nearby {
+		protoResults = append(protoResults, &proto.NearbyProperty{
+			Property:   mapToProtoPropertyResp(&result.Property),
+			DistanceKm: result.DistanceKm,
+		})
+	}
+	return &proto.NearbyPropertiesResp{Results: protoResults, NextPageToken: nextPageToken}, nil
+}
+
+func (h *PropertyHandler) SearchAvailableProperties(_ context.Context, req *proto.SearchAvailablePropertiesReq) (*proto.ListPropertiesResp, error) {
+	if req.From == nil || req.To == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Search window requires from and to")
+	}
+
+	properties, err := service.GetAvailableProperties(req.From.AsTime(), req.To.AsTime())
+	if err != nil {
+		log.Errorf("Error calling service GetAvailableProperties: %v", err)
+
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
+		}
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 
@@ -97,9 +314,13 @@ func (h *PropertyHandler) DeleteProperty(_ context.Context, req *proto.PropertyI
 	return new(emptypb.Empty), nil
 }
 
-func (h *PropertyHandler) ConfirmBooking(_ context.Context, req *proto.BookingReq) (*emptypb.Empty, error) {
+func (h *PropertyHandler) ConfirmBooking(_ context.Context, req *proto.BookingReq) (*proto.BookingConfirmationResp, error) {
 	log.Infof("Received booking request: %v", req)
 
+	if req.CheckIn == nil || req.CheckOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
 	existingProperty, err := service.GetProperty(uint(req.PropertyId))
 	if existingProperty == nil {
 		return nil, status.Errorf(codes.NotFound, "Property not found")
@@ -108,10 +329,28 @@ func (h *PropertyHandler) ConfirmBooking(_ context.Context, req *proto.BookingRe
 		return nil, err
 	}
 
-	err = service.BookProperty(existingProperty, uint(req.BookingId))
+	// the price the customer agreed to is verified before the property is reserved
+	if req.Quote != nil {
+		quote, err := existingProperty.QuoteStay(req.CheckIn.AsTime(), req.CheckOut.AsTime())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		if quote.Total != req.Quote.Total || quote.Currency != req.Quote.Currency {
+			return nil, status.Errorf(codes.FailedPrecondition, "The price of the stay changed from %d %s to %d %s",
+				req.Quote.Total, req.Quote.Currency, quote.Total, quote.Currency)
+		}
+	}
+
+	guests := model.Guests{Adults: req.Adults, Children: req.Children, Pets: req.Pets}
+	reservation, err := service.BookProperty(existingProperty, uint(req.BookingId), req.CheckIn.AsTime(), req.CheckOut.AsTime(), guests, req.HoldToken)
 	if err != nil {
 		log.Errorf("Error calling service BookProperty with ID %v: %v", req.PropertyId, err)
 
+		var capacityError *model.CapacityError
+		if errors.As(err, &capacityError) {
+			return nil, mapCapacityError(capacityError)
+		}
+
 		var propertyError *model.PropertyError
 		if errors.As(err, &propertyError) {
 			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
@@ -119,7 +358,72 @@ func (h *PropertyHandler) ConfirmBooking(_ context.Context, req *proto.BookingRe
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 
-	return new(emptypb.Empty), nil
+	quote, err := existingProperty.QuoteStay(reservation.CheckIn, reservation.CheckOut)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	return &proto.BookingConfirmationResp{
+		ApprovalRequired: reservation.IsPendingApproval(),
+		Quote:            mapToProtoStayQuote(quote),
+	}, nil
+}
+
+func (h *PropertyHandler) GetCancellationPolicy(_ context.Context, req *proto.BookingReq) (*proto.CancellationPolicyResp, error) {
+	existingProperty, err := service.GetProperty(uint(req.PropertyId))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if existingProperty == nil {
+		return nil, status.Errorf(codes.NotFound, "Property not found")
+	}
+
+	var tiers []*proto.PolicyTier
+	for _, tier := range existingProperty.EffectiveRefundTiers() {
+		tiers = append(tiers, &proto.PolicyTier{DaysBefore: tier.DaysBefore, RefundPercent: tier.RefundPercent})
+	}
+	return &proto.CancellationPolicyResp{
+		Policy: string(existingProperty.CancellationPolicy),
+		Tiers:  tiers,
+	}, nil
+}
+
+func (h *PropertyHandler) ListReservations(_ context.Context, req *proto.ListReservationsReq) (*proto.ReservationList, error) {
+	var checkOutAfter time.Time
+	if req.CheckOutAfter != nil {
+		checkOutAfter = req.CheckOutAfter.AsTime()
+	}
+	reservations, err := service.GetReservations(checkOutAfter)
+	if err != nil {
+		log.Errorf("Error calling service GetReservations: %v", err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	list := new(proto.ReservationList)
+	for _, reservation := range reservations {
+		list.Reservations = append(list.Reservations, mapToProtoReservationEntry(&reservation))
+	}
+	return list, nil
+}
+
+func (h *PropertyHandler) QuoteStay(_ context.Context, req *proto.BookingReq) (*proto.StayQuote, error) {
+	if req.CheckIn == nil || req.CheckOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
+	existingProperty, err := service.GetProperty(uint(req.PropertyId))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if existingProperty == nil {
+		return nil, status.Errorf(codes.NotFound, "Property not found")
+	}
+
+	quote, err := existingProperty.QuoteStay(req.CheckIn.AsTime(), req.CheckOut.AsTime())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	return mapToProtoStayQuote(quote), nil
 }
 
 func (h *PropertyHandler) CancelBooking(_ context.Context, req *proto.BookingReq) (*emptypb.Empty, error) {
@@ -146,3 +450,82 @@ func (h *PropertyHandler) CancelBooking(_ context.Context, req *proto.BookingReq
 
 	return new(emptypb.Empty), nil
 }
+
+func (h *PropertyHandler) HoldProperty(_ context.Context, req *proto.HoldPropertyReq) (*proto.HoldResp, error) {
+	if req.CheckIn == nil || req.CheckOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
+	existingProperty, err := service.GetProperty(uint(req.PropertyId))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if existingProperty == nil {
+		return nil, status.Errorf(codes.NotFound, "Property not found")
+	}
+
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+	hold, err := service.HoldProperty(existingProperty, req.CheckIn.AsTime(), req.CheckOut.AsTime(), ttl)
+	if err != nil {
+		log.Errorf("Error calling service HoldProperty with ID %v: %v", req.PropertyId, err)
+
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	return mapToProtoHoldResp(hold), nil
+}
+
+func (h *PropertyHandler) ApproveBooking(_ context.Context, req *proto.ReservationDecisionReq) (*proto.PropertyResp, error) {
+	return decideReservation(req, "ApproveReservation", func(property *model.Property) error {
+		return service.ApproveReservation(property, uint(req.BookingId), uint(req.OwnerId))
+	})
+}
+
+func (h *PropertyHandler) DeclineBooking(_ context.Context, req *proto.ReservationDecisionReq) (*proto.PropertyResp, error) {
+	return decideReservation(req, "DeclineReservation", func(property *model.Property) error {
+		return service.DeclineReservation(property, uint(req.BookingId), uint(req.OwnerId), req.Reason)
+	})
+}
+
+// decideReservation calls the given service function with the property of the request
+// and returns the property including its updated reservations
+func decideReservation(req *proto.ReservationDecisionReq, serviceName string, decide func(*model.Property) error) (*proto.PropertyResp, error) {
+	log.Infof("Received decision request: %v", req)
+
+	existingProperty, err := service.GetProperty(uint(req.PropertyId))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if existingProperty == nil {
+		return nil, status.Errorf(codes.NotFound, "Property not found")
+	}
+
+	err = decide(existingProperty)
+	if err != nil {
+		log.Errorf("Error calling service %s with ID %v: %v", serviceName, req.PropertyId, err)
+
+		var permissionError *model.PermissionError
+		if errors.As(err, &permissionError) {
+			return nil, status.Errorf(codes.PermissionDenied, permissionError.Error())
+		}
+		var propertyError *model.PropertyError
+		if errors.As(err, &propertyError) {
+			return nil, status.Errorf(codes.InvalidArgument, propertyError.Error())
+		}
+		// errors of the booking service are passed on with their original code
+		if bookingStatus, ok := status.FromError(err); ok {
+			return nil, bookingStatus.Err()
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	updatedProperty, err := service.GetProperty(uint(req.PropertyId))
+	if err != nil || updatedProperty == nil {
+		return nil, status.Errorf(codes.Internal, "Could not reload property after decision: %v", err)
+	}
+	return mapToProtoPropertyResp(updatedProperty), nil
+}
@@ -1,41 +1,71 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/handler/integration_test"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/service"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/storage"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	googleproto "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"image"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
+const bookingInternalServerPort = "9112"
+const userInternalServerPort = "9113"
+
 type PropertyTestSuite struct {
 	suite.Suite
-	ctx                         context.Context
-	client                      proto.PropertyExternalClient
-	closePropertyExternalServer func()
-	cleanUpDB                   func()
+	ctx                       context.Context
+	client                    proto.PropertyExternalClient
+	internalClient            proto.PropertyInternalClient
+	closePropertyServer       func()
+	mockBookingInternalServer *integration_test.MockBookingInternalServer
+	mockUserInternalServer    *integration_test.MockUserInternalServer
+	closeMockUserServer       func()
+	cleanUpDB                 func()
 }
 
 // beforeAll
 func (suite *PropertyTestSuite) SetupSuite() {
 	log.Info(">>> From SetupSuite")
 	suite.ctx = context.Background()
-	suite.client, suite.closePropertyExternalServer = startPropertyExternalServer(suite.ctx)
+	suite.client, suite.internalClient, suite.closePropertyServer = startPropertyServer(suite.ctx)
+	suite.mockBookingInternalServer = new(integration_test.MockBookingInternalServer)
+	// every property needs an owner
+	suite.mockUserInternalServer = &integration_test.MockUserInternalServer{Accounts: getMockAccounts()}
+	suite.closeMockUserServer = suite.mockUserInternalServer.Start(userInternalServerPort)
 }
 
 // beforeEach
 func (suite *PropertyTestSuite) SetupTest() {
 	log.Info("--- From SetupTest: Setting up fresh DB")
 	suite.cleanUpDB = db.SetupTestDB(suite.T())
+	photos, err := storage.NewFileStore(suite.T().TempDir())
+	suite.Require().NoError(err)
+	storage.Photos = photos
 }
 
 // afterAll
 func (suite *PropertyTestSuite) TearDownSuite() {
 	log.Info(">>> From TearDownSuite")
-	suite.closePropertyExternalServer()
+	suite.closePropertyServer()
+	suite.closeMockUserServer()
 }
 
 // afterEach
@@ -51,13 +81,13 @@ func (suite *PropertyTestSuite) TestPropertyHandler_GetProperties() {
 	}
 
 	tests := map[string]struct {
-		in           *emptypb.Empty
+		in           *proto.ListPropertiesReq
 		setupFunc    func()
 		tearDownFunc func()
 		expected     expectation
 	}{
 		"GivenNoProperty_WhenGetProperties_ThenReturnEmpty": {
-			in:           new(emptypb.Empty),
+			in:           &proto.ListPropertiesReq{},
 			setupFunc:    nil,
 			tearDownFunc: nil,
 			expected: expectation{
@@ -66,7 +96,7 @@ func (suite *PropertyTestSuite) TestPropertyHandler_GetProperties() {
 			},
 		},
 		"GivenOneProperty_WhenGetProperties_ThenReturnProperty": {
-			in: new(emptypb.Empty),
+			in: &proto.ListPropertiesReq{},
 			setupFunc: func() {
 				createPropertyInDB()
 			},
@@ -78,6 +108,27 @@ func (suite *PropertyTestSuite) TestPropertyHandler_GetProperties() {
 				err: nil,
 			},
 		},
+		"GivenPropertyOfOtherOwner_WhenGetPropertiesOfOwner_ThenReturnEmpty": {
+			in: &proto.ListPropertiesReq{OwnerId: 2},
+			setupFunc: func() {
+				createPropertyInDB()
+			},
+			tearDownFunc: func() {
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: getMockListPropertiesResp(nil),
+				err: nil,
+			},
+		},
+		"GivenUnknownOrder_WhenGetProperties_ThenReturnError": {
+			in: &proto.ListPropertiesReq{OrderBy: "rating desc"},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Cannot order by \"rating desc\", " +
+					"expected one of created_at, id, name, nightly_rate, owner_name, updated_at optionally followed by asc or desc"),
+			},
+		},
 	}
 
 	for scenario, testData := range tests {
@@ -104,6 +155,425 @@ func (suite *PropertyTestSuite) TestPropertyHandler_GetProperties() {
 	}
 }
 
+func (suite *PropertyTestSuite) TestPropertyHandler_GetPropertiesInPages() {
+	// given
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		_, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{Name: name, OwnerId: 1})
+		suite.Require().NoError(err)
+	}
+	in := &proto.ListPropertiesReq{PageSize: 2, OrderBy: "name desc", OwnerId: 1}
+
+	// when
+	first, err := suite.client.GetProperties(suite.ctx, in)
+
+	// then
+	suite.Require().NoError(err)
+	suite.Require().Len(first.Properties, 2)
+	suite.Equal("gamma", first.Properties[0].Name)
+	suite.Equal("beta", first.Properties[1].Name)
+	suite.NotEmpty(first.NextPageToken)
+
+	// when retrieving the next page
+	in.PageToken = first.NextPageToken
+	second, err := suite.client.GetProperties(suite.ctx, in)
+
+	// then it is the last one
+	suite.Require().NoError(err)
+	suite.Require().Len(second.Properties, 1)
+	suite.Equal("alpha", second.Properties[0].Name)
+	suite.Empty(second.NextPageToken)
+
+	// when using the token with another order
+	in.OrderBy = "name"
+	_, err = suite.client.GetProperties(suite.ctx, in)
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = Invalid page token, it has to be used with the same filters and order"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_GetPropertiesWithAmenitiesAndTags() {
+	// given
+	_, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{
+		Name: "villa", OwnerId: 1, Amenities: []string{"pool", "wifi"}, Tags: []string{" Family ", "beach"}})
+	suite.Require().NoError(err)
+	_, err = suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{
+		Name: "flat", OwnerId: 1, Amenities: []string{"wifi"}, Tags: []string{"city"}})
+	suite.Require().NoError(err)
+
+	// when
+	out, err := suite.client.GetProperties(suite.ctx, &proto.ListPropertiesReq{Amenity: []string{"wifi"}, Tag: []string{"family"}})
+
+	// then only the property with all amenities and tags is returned
+	suite.Require().NoError(err)
+	suite.Require().Len(out.Properties, 1)
+	suite.Equal("villa", out.Properties[0].Name)
+	suite.ElementsMatch([]string{"family", "beach"}, out.Properties[0].Tags)
+	suite.Len(out.Properties[0].Amenities, 2)
+
+	// when listing all properties
+	out, err = suite.client.GetProperties(suite.ctx, &proto.ListPropertiesReq{})
+
+	// then the facets count the properties by amenity and tag
+	suite.Require().NoError(err)
+	amenityCounts := make(map[string]uint32)
+	for _, facet := range out.AmenityFacets {
+		amenityCounts[facet.Value] = facet.Count
+	}
+	suite.Equal(uint32(2), amenityCounts["wifi"])
+	suite.Equal(uint32(1), amenityCounts["pool"])
+	suite.Contains(amenityCounts, "parking")
+	suite.Equal(uint32(0), amenityCounts["parking"])
+	suite.Len(out.TagFacets, 3)
+
+	// when creating a property with an amenity missing in the catalogue
+	_, err = suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{Name: "hut", OwnerId: 1, Amenities: []string{"sauna"}})
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = Unknown amenities sauna, see the catalogue of amenities"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+
+	// when the amenity is added to the catalogue
+	_, err = suite.client.CreateAmenity(suite.ctx, &proto.CreateAmenityReq{Code: "sauna", Name: "Sauna"})
+	suite.Require().NoError(err)
+	_, err = suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{Name: "hut", OwnerId: 1, Amenities: []string{"sauna"}})
+
+	// then
+	suite.NoError(err)
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_SearchProperties() {
+	// given
+	beach, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{
+		Name: "Beach House", Description: "Sunny house with a view of the sea", OwnerId: 1, Address: "Seaside 1, Kiel"})
+	suite.Require().NoError(err)
+	cabin, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{
+		Name: "Mountain Cabin", Description: "Cosy cabin close to the beach lift", OwnerId: 1, Address: "Alpweg 2, Garmisch"})
+	suite.Require().NoError(err)
+
+	// when searching with a typo
+	out, err := suite.client.SearchProperties(suite.ctx, &proto.SearchPropertiesReq{Q: "beech"})
+
+	// then the match in the name ranks above the match in the description
+	suite.Require().NoError(err)
+	suite.Require().Len(out.Results, 2)
+	suite.Equal(beach.Id, out.Results[0].Property.Id)
+	suite.Equal(cabin.Id, out.Results[1].Property.Id)
+	suite.Greater(out.Results[0].Score, out.Results[1].Score)
+	suite.Equal("NAME", out.Results[0].Snippets[0].Field)
+	suite.Equal("<em>Beach</em> House", out.Results[0].Snippets[0].Text)
+
+	// when the first two letters are swapped
+	out, err = suite.client.SearchProperties(suite.ctx, &proto.SearchPropertiesReq{Q: "ebach"})
+
+	// then the typo is corrected as well
+	suite.Require().NoError(err)
+	suite.Len(out.Results, 2)
+
+	// when the first letter is wrong
+	out, err = suite.client.SearchProperties(suite.ctx, &proto.SearchPropertiesReq{Q: "peach"})
+
+	// then terms starting with other letters are no candidates
+	suite.Require().NoError(err)
+	suite.Empty(out.Results)
+
+	// when the property is updated
+	_, err = suite.client.UpdateProperty(suite.ctx, &proto.UpdatePropertyReq{Id: cabin.Id, Name: "Mountain Cabin", OwnerId: 1})
+	suite.Require().NoError(err)
+	out, err = suite.client.SearchProperties(suite.ctx, &proto.SearchPropertiesReq{Q: "beach"})
+
+	// then the index no longer contains its old description
+	suite.Require().NoError(err)
+	suite.Require().Len(out.Results, 1)
+	suite.Equal(beach.Id, out.Results[0].Property.Id)
+
+	// when the property is deleted
+	_, err = suite.client.DeleteProperty(suite.ctx, &proto.PropertyIdReq{Id: beach.Id})
+	suite.Require().NoError(err)
+	out, err = suite.client.SearchProperties(suite.ctx, &proto.SearchPropertiesReq{Q: "beach"})
+
+	// then it is no longer found
+	suite.Require().NoError(err)
+	suite.Empty(out.Results)
+
+	// when searching without words
+	_, err = suite.client.SearchProperties(suite.ctx, &proto.SearchPropertiesReq{Q: " ,"})
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = The search query must contain at least one word"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_Photos() {
+	// given
+	property, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{Name: "name", OwnerId: 1})
+	suite.Require().NoError(err)
+
+	// when uploading two photos
+	first, err := suite.client.UploadPhoto(suite.ctx, &proto.UploadPhotoReq{PropertyId: property.Id, Data: encodeTestPNG(800, 600)})
+	suite.Require().NoError(err)
+	second, err := suite.client.UploadPhoto(suite.ctx, &proto.UploadPhotoReq{PropertyId: property.Id, Data: encodeTestPNG(100, 200)})
+	suite.Require().NoError(err)
+
+	// then the first one is the cover and a thumbnail is generated
+	suite.True(first.Cover)
+	suite.False(second.Cover)
+	suite.Equal("image/png", first.ContentType)
+	suite.Equal(uint32(800), first.Width)
+	thumbnail, err := suite.client.GetPhotoContent(suite.ctx, &proto.PhotoContentReq{PropertyId: property.Id, PhotoId: first.Id, Thumbnail: true})
+	suite.Require().NoError(err)
+	suite.Equal("image/jpeg", thumbnail.ContentType)
+	config, _, err := image.DecodeConfig(bytes.NewReader(thumbnail.Data))
+	suite.Require().NoError(err)
+	suite.Equal(320, config.Width)
+	suite.Equal(240, config.Height)
+
+	// when reordering the photos and choosing the second one as cover
+	_, err = suite.client.ReorderPhotos(suite.ctx, &proto.ReorderPhotosReq{PropertyId: property.Id, PhotoIds: []uint32{second.Id, first.Id}})
+	suite.Require().NoError(err)
+	list, err := suite.client.SetCoverPhoto(suite.ctx, &proto.PhotoIdReq{PropertyId: property.Id, PhotoId: second.Id})
+
+	// then
+	suite.Require().NoError(err)
+	suite.Require().Len(list.Photos, 2)
+	suite.Equal(second.Id, list.Photos[0].Id)
+	suite.True(list.Photos[0].Cover)
+	suite.False(list.Photos[1].Cover)
+
+	// when uploading something else than an image
+	_, err = suite.client.UploadPhoto(suite.ctx, &proto.UploadPhotoReq{PropertyId: property.Id, Data: []byte("no image")})
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = Unsupported content type text/plain; charset=utf-8, " +
+		"expected image/jpeg, image/png or image/gif"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+
+	// when the property is deleted
+	var stored []model.Photo
+	suite.Require().NoError(db.DB.Find(&stored).Error)
+	_, err = suite.client.DeleteProperty(suite.ctx, &proto.PropertyIdReq{Id: property.Id})
+	suite.Require().NoError(err)
+
+	// then its photos are removed together with their blobs
+	_, err = suite.client.GetPhotoContent(suite.ctx, &proto.PhotoContentReq{PropertyId: property.Id, PhotoId: first.Id})
+	suite.Equal(codes.NotFound, status.Code(err))
+	suite.Require().Len(stored, 2)
+	for _, photo := range stored {
+		_, err := storage.Photos.Get(photo.StorageKey)
+		suite.ErrorIs(err, storage.ErrNotFound)
+		_, err = storage.Photos.Get(photo.ThumbnailKey)
+		suite.ErrorIs(err, storage.ErrNotFound)
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_Reviews() {
+	cancel := suite.mockBookingInternalServer.Start(bookingInternalServerPort)
+	defer cancel()
+	defer func() { suite.mockBookingInternalServer.Stays = nil }()
+
+	// given
+	property, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{Name: "name", OwnerId: 1})
+	suite.Require().NoError(err)
+	suite.mockBookingInternalServer.Stays = map[uint32]*proto.StayResp{
+		1: {BookingId: 1, PropertyId: property.Id, CustomerId: 11, CustomerName: "alice", Status: "COMPLETED"},
+		2: {BookingId: 2, PropertyId: property.Id, CustomerId: 12, CustomerName: "bob", Status: "CONFIRMED"},
+		3: {BookingId: 3, PropertyId: property.Id, CustomerId: 13, CustomerName: "carol", Status: "COMPLETED"},
+	}
+
+	// when reviewing a stay that is not over yet
+	_, err = suite.client.CreateReview(suite.ctx, &proto.CreateReviewReq{PropertyId: property.Id, BookingId: 2, CustomerId: 12, Rating: 5})
+
+	// then
+	expected := "rpc error: code = PermissionDenied desc = Booking 2 is CONFIRMED, only completed stays can be reviewed"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+
+	// when reviewing the stay of someone else
+	_, err = suite.client.CreateReview(suite.ctx, &proto.CreateReviewReq{PropertyId: property.Id, BookingId: 1, CustomerId: 12, Rating: 5})
+
+	// then
+	suite.Equal(codes.PermissionDenied, status.Code(err))
+
+	// when reviewing completed stays
+	review, err := suite.client.CreateReview(suite.ctx, &proto.CreateReviewReq{PropertyId: property.Id, BookingId: 1, CustomerId: 11, Rating: 5, Text: " Lovely place "})
+	suite.Require().NoError(err)
+	_, err = suite.client.CreateReview(suite.ctx, &proto.CreateReviewReq{PropertyId: property.Id, BookingId: 3, CustomerId: 13, Rating: 2})
+	suite.Require().NoError(err)
+
+	// then the property shows their average rating
+	suite.Equal("Lovely place", review.Text)
+	suite.Equal("alice", review.CustomerName)
+	suite.Nil(review.RepliedAt)
+	stored, err := suite.client.GetProperty(suite.ctx, &proto.PropertyIdReq{Id: property.Id})
+	suite.Require().NoError(err)
+	suite.Equal(uint32(2), stored.ReviewCount)
+	suite.Equal(3.5, stored.AverageRating)
+	list, err := suite.client.ListReviews(suite.ctx, &proto.ListReviewsReq{PropertyId: property.Id, OrderBy: "rating desc"})
+	suite.Require().NoError(err)
+	suite.Require().Len(list.Reviews, 2)
+	suite.Equal("alice", list.Reviews[0].CustomerName)
+
+	// when reviewing the property again
+	_, err = suite.client.CreateReview(suite.ctx, &proto.CreateReviewReq{PropertyId: property.Id, BookingId: 1, CustomerId: 11, Rating: 1})
+
+	// then
+	expected = "rpc error: code = InvalidArgument desc = alice already reviewed property 1"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+
+	// when someone else than the owner replies
+	_, err = suite.client.ReplyToReview(suite.ctx, &proto.ReplyToReviewReq{PropertyId: property.Id, ReviewId: review.Id, OwnerId: 2, Text: "Thanks"})
+
+	// then
+	suite.Equal(codes.PermissionDenied, status.Code(err))
+
+	// when the owner replies twice
+	reply, err := suite.client.ReplyToReview(suite.ctx, &proto.ReplyToReviewReq{PropertyId: property.Id, ReviewId: review.Id, OwnerId: 1, Text: "Thanks"})
+	suite.Require().NoError(err)
+	_, err = suite.client.ReplyToReview(suite.ctx, &proto.ReplyToReviewReq{PropertyId: property.Id, ReviewId: review.Id, OwnerId: 1, Text: "Thanks again"})
+
+	// then only the first reply is stored
+	suite.Equal("Thanks", reply.Reply)
+	suite.NotNil(reply.RepliedAt)
+	expected = "rpc error: code = InvalidArgument desc = Review 1 already has a reply"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_GetNearbyProperties() {
+	// given
+	locations := map[string]*proto.GeoPoint{
+		"Orlando":   {Latitude: 28.5384, Longitude: -81.3789},
+		"Kissimmee": {Latitude: 28.2920, Longitude: -81.4076},
+		"Miami":     {Latitude: 25.7617, Longitude: -80.1918},
+	}
+	for city, location := range locations {
+		_, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{
+			Name: city, OwnerId: 1, PostalAddress: &proto.PostalAddress{City: city, Country: "us"}, Location: location})
+		suite.Require().NoError(err)
+	}
+	_, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{Name: "Unknown", OwnerId: 1})
+	suite.Require().NoError(err)
+
+	// when
+	out, err := suite.client.GetNearbyProperties(suite.ctx, &proto.NearbyPropertiesReq{Lat: 28.5384, Lng: -81.3789, RadiusKm: 50})
+
+	// then only the properties within the radius are returned, the closest first
+	suite.Require().NoError(err)
+	suite.Require().Len(out.Results, 2)
+	suite.Equal("Orlando", out.Results[0].Property.Name)
+	suite.InDelta(0, out.Results[0].DistanceKm, 0.01)
+	suite.Equal("Kissimmee", out.Results[1].Property.Name)
+	suite.InDelta(27.5, out.Results[1].DistanceKm, 0.5)
+	suite.Equal("US", out.Results[1].Property.PostalAddress.Country)
+
+	// when the radius is too large
+	_, err = suite.client.GetNearbyProperties(suite.ctx, &proto.NearbyPropertiesReq{Lat: 28.5384, Lng: -81.3789, RadiusKm: 1000})
+
+	// then
+	expected := "rpc error: code = InvalidArgument desc = Radius must be greater than 0 and at most 500 km"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_SearchAvailableProperties() {
+	type expectation struct {
+		out *proto.ListPropertiesResp
+		err error
+	}
+
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := checkIn.AddDate(0, 0, 7)
+
+	tests := map[string]struct {
+		in           *proto.SearchAvailablePropertiesReq
+		setupFunc    func()
+		tearDownFunc func()
+		expected     expectation
+	}{
+		"GivenNoSearchWindow_WhenSearchAvailableProperties_ThenReturnInvalidArgument": {
+			in:           &proto.SearchAvailablePropertiesReq{},
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Search window requires from and to"),
+			},
+		},
+		"GivenConflictingReservation_WhenSearchAvailableProperties_ThenReturnEmpty": {
+			in: &proto.SearchAvailablePropertiesReq{
+				From: timestamppb.New(checkIn.AddDate(0, 0, 6)),
+				To:   timestamppb.New(checkOut.AddDate(0, 0, 6)),
+			},
+			setupFunc: func() {
+				createPropertyInDB()
+				createReservationInDB(1, checkIn, checkOut)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: getMockListPropertiesResp(nil),
+				err: nil,
+			},
+		},
+		"GivenReservationOutsideSearchWindow_WhenSearchAvailableProperties_ThenReturnProperty": {
+			in: &proto.SearchAvailablePropertiesReq{
+				From: timestamppb.New(checkOut),
+				To:   timestamppb.New(checkOut.AddDate(0, 0, 7)),
+			},
+			setupFunc: func() {
+				createPropertyInDB()
+				createReservationInDB(1, checkIn, checkOut)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: getMockListPropertiesResp(getMockPropertyRespWithDefaultOwnerName()),
+				err: nil,
+			},
+		},
+	}
+
+	for scenario, testData := range tests {
+		log.Infof("Scenario: %s", scenario)
+
+		if testData.setupFunc != nil {
+			testData.setupFunc()
+		}
+
+		out, err := suite.client.SearchAvailableProperties(suite.ctx, testData.in)
+		if err != nil {
+			if testData.expected.err == nil || testData.expected.err.Error() != err.Error() {
+				suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", testData.expected.err, err)
+			}
+		} else if out == nil ||
+			len(out.Properties) != len(testData.expected.out.Properties) ||
+			(len(out.Properties) > 0 && out.Properties[0].OwnerName != testData.expected.out.Properties[0].OwnerName) {
+			suite.T().Errorf("Out:\n Expected: %v\n Actual: %v", testData.expected.out, out)
+		}
+
+		if testData.tearDownFunc != nil {
+			testData.tearDownFunc()
+		}
+	}
+}
+
 func (suite *PropertyTestSuite) TestPropertyHandler_GetProperty() {
 	type expectation struct {
 		out *proto.PropertyResp
@@ -194,7 +664,7 @@ func (suite *PropertyTestSuite) TestPropertyHandler_UpdateProperty() {
 			},
 		},
 		"GivenNoProperty_WhenUpdateProperty_ThenReturnNotFound": {
-			in:           &proto.UpdatePropertyReq{Id: 1, OwnerName: "other"},
+			in:           &proto.UpdatePropertyReq{Id: 1, OwnerId: 2},
 			setupFunc:    nil,
 			tearDownFunc: nil,
 			expected: expectation{
@@ -203,7 +673,7 @@ func (suite *PropertyTestSuite) TestPropertyHandler_UpdateProperty() {
 			},
 		},
 		"GivenOneProperty_WhenUpdateProperty_ThenReturnUpdatedProperty": {
-			in: &proto.UpdatePropertyReq{Id: 1, OwnerName: "other"},
+			in: &proto.UpdatePropertyReq{Id: 1, OwnerId: 2},
 			setupFunc: func() {
 				createPropertyInDB()
 			},
@@ -241,6 +711,48 @@ func (suite *PropertyTestSuite) TestPropertyHandler_UpdateProperty() {
 	}
 }
 
+func (suite *PropertyTestSuite) TestPropertyHandler_UpdatePropertyWithIfMatch() {
+	// given
+	created, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{Name: "name", OwnerId: 1})
+	suite.Require().NoError(err)
+	defer deletePropertyInDB()
+	suite.Equal("1", created.Etag)
+
+	// when updating the retrieved version
+	ctx := metadata.AppendToOutgoingContext(suite.ctx, "if-match", `"1"`)
+	updated, err := suite.client.UpdateProperty(ctx, &proto.UpdatePropertyReq{Id: created.Id, Name: "first", OwnerId: 1})
+
+	// then the version is incremented
+	suite.Require().NoError(err)
+	suite.Equal("2", updated.Etag)
+
+	// when a second client updates the same version
+	_, err = suite.client.UpdateProperty(ctx, &proto.UpdatePropertyReq{Id: created.Id, Name: "second", OwnerId: 1})
+
+	// then the update is rejected and the first one is kept
+	expected := "rpc error: code = Aborted desc = Property 1 was modified, it no longer has version 1"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+	property, err := suite.client.GetProperty(suite.ctx, &proto.PropertyIdReq{Id: created.Id})
+	suite.Require().NoError(err)
+	suite.Equal("first", property.Name)
+
+	// when the property is booked after it was retrieved
+	defer deleteReservationsInDB()
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	_, err = suite.internalClient.ConfirmBooking(suite.ctx, getMockBookingReq(1, checkIn, checkIn.AddDate(0, 0, 7)))
+	suite.Require().NoError(err)
+	ctx = metadata.AppendToOutgoingContext(suite.ctx, "if-match", `"2"`)
+	_, err = suite.client.UpdateProperty(ctx, &proto.UpdatePropertyReq{Id: created.Id, Name: "third", OwnerId: 1})
+
+	// then the reservation changed the version as well
+	expected = "rpc error: code = Aborted desc = Property 1 was modified, it no longer has version 2"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
 func (suite *PropertyTestSuite) TestPropertyHandler_CreateProperty() {
 	type expectation struct {
 		out *proto.PropertyResp
@@ -253,8 +765,35 @@ func (suite *PropertyTestSuite) TestPropertyHandler_CreateProperty() {
 		tearDownFunc func()
 		expected     expectation
 	}{
+		"GivenNoOwner_WhenCreateProperty_ThenReturnInvalidArgument": {
+			in:           &proto.CreatePropertyReq{},
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = A property requires the id of its owner"),
+			},
+		},
+		"GivenUnknownOwner_WhenCreateProperty_ThenReturnInvalidArgument": {
+			in:           &proto.CreatePropertyReq{OwnerId: 99},
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = User 99 does not exist"),
+			},
+		},
+		"GivenCustomerAccount_WhenCreateProperty_ThenReturnPermissionDenied": {
+			in:           &proto.CreatePropertyReq{OwnerId: 3},
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = PermissionDenied desc = User customer (ID: 3) is no owner"),
+			},
+		},
 		"GivenNoProperty_WhenCreateProperty_ThenReturnCreatedProperty": {
-			in:        &proto.CreatePropertyReq{OwnerName: "owner"},
+			in:        &proto.CreatePropertyReq{OwnerId: 1},
 			setupFunc: nil,
 			tearDownFunc: func() {
 				deletePropertyInDB()
@@ -290,6 +829,31 @@ func (suite *PropertyTestSuite) TestPropertyHandler_CreateProperty() {
 	}
 }
 
+func (suite *PropertyTestSuite) TestPropertyHandler_CreatePropertyWithIdempotencyKey() {
+	// given
+	defer deletePropertyInDB()
+	ctx := metadata.AppendToOutgoingContext(suite.ctx, "idempotency-key", "retry-1")
+	in := &proto.CreatePropertyReq{Name: "name", OwnerId: 1}
+	first, err := suite.client.CreateProperty(ctx, in)
+	suite.Require().NoError(err)
+
+	// when the request is retried
+	retried, err := suite.client.CreateProperty(ctx, in)
+
+	// then the original property is returned and no second one is created
+	suite.Require().NoError(err)
+	suite.True(googleproto.Equal(first, retried), "Unexpected: %v", retried)
+	list, err := suite.client.GetProperties(suite.ctx, &proto.ListPropertiesReq{})
+	suite.Require().NoError(err)
+	suite.Len(list.Properties, 1)
+
+	// when the same key is used for another method
+	_, err = suite.client.UpdateProperty(ctx, &proto.UpdatePropertyReq{Id: first.Id, Name: "renamed"})
+
+	// then the keys do not interfere
+	suite.Require().NoError(err)
+}
+
 func (suite *PropertyTestSuite) TestPropertyHandler_DeleteProperty() {
 	type expectation struct {
 		out *emptypb.Empty
@@ -320,6 +884,38 @@ func (suite *PropertyTestSuite) TestPropertyHandler_DeleteProperty() {
 				err: errors.New("rpc error: code = NotFound desc = Property not found"),
 			},
 		},
+		"GivenUpcomingReservation_WhenDeleteProperty_ThenReturnInvalidArgument": {
+			in: &proto.PropertyIdReq{Id: 1},
+			setupFunc: func() {
+				createPropertyInDB()
+				checkIn := model.TruncateToDay(time.Now()).AddDate(0, 0, 3)
+				createReservationInDB(1, checkIn, checkIn.AddDate(0, 0, 7))
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Property cannot be deleted, because it is booked. Please, cancel the bookings first."),
+			},
+		},
+		"GivenActiveHold_WhenDeleteProperty_ThenReturnInvalidArgument": {
+			in: &proto.PropertyIdReq{Id: 1},
+			setupFunc: func() {
+				createPropertyInDB()
+				checkIn := model.TruncateToDay(time.Now()).AddDate(0, 0, 3)
+				createHoldInDB("token", checkIn, checkIn.AddDate(0, 0, 7), time.Now().Add(time.Hour))
+			},
+			tearDownFunc: func() {
+				deleteHoldsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Property cannot be deleted, because it is booked. Please, cancel the bookings first."),
+			},
+		},
 		"GivenOneProperty_WhenDeleteProperty_ThenDeleteProperty": {
 			in: &proto.PropertyIdReq{Id: 1},
 			setupFunc: func() {
@@ -344,7 +940,7 @@ func (suite *PropertyTestSuite) TestPropertyHandler_DeleteProperty() {
 
 		out, err := suite.client.DeleteProperty(suite.ctx, testData.in)
 		if err != nil {
-			if testData.expected.err.Error() != err.Error() {
+			if testData.expected.err == nil || testData.expected.err.Error() != err.Error() {
 				suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", testData.expected.err, err)
 			}
 		} else if out == nil {
@@ -357,6 +953,797 @@ func (suite *PropertyTestSuite) TestPropertyHandler_DeleteProperty() {
 	}
 }
 
+func (suite *PropertyTestSuite) TestPropertyHandler_ConfirmBooking() {
+	type expectation struct {
+		out *proto.BookingConfirmationResp
+		err error
+	}
+
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := checkIn.AddDate(0, 0, 7)
+
+	tests := map[string]struct {
+		in           *proto.BookingReq
+		setupFunc    func()
+		tearDownFunc func()
+		expected     expectation
+	}{
+		"GivenNoProperty_WhenConfirmBooking_ThenReturnNotFound": {
+			in:           getMockBookingReq(2, checkIn, checkOut),
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = NotFound desc = Property not found"),
+			},
+		},
+		"GivenCheckOutBeforeCheckIn_WhenConfirmBooking_ThenReturnInvalidArgument": {
+			in: getMockBookingReq(2, checkOut, checkIn),
+			setupFunc: func() {
+				createPropertyInDB()
+			},
+			tearDownFunc: func() {
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Check-out must be at least one day after check-in"),
+			},
+		},
+		"GivenOverlappingReservation_WhenConfirmBooking_ThenReturnInvalidArgument": {
+			in: getMockBookingReq(2, checkIn.AddDate(0, 0, 3), checkOut.AddDate(0, 0, 3)),
+			setupFunc: func() {
+				createPropertyInDB()
+				createReservationInDB(1, checkIn, checkOut)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Sorry, property name (ID: 1) is already booked between 2023-07-13 and 2023-07-20"),
+			},
+		},
+		"GivenAdjacentReservation_WhenConfirmBooking_ThenConfirmBooking": {
+			in: getMockBookingReq(2, checkOut, checkOut.AddDate(0, 0, 7)),
+			setupFunc: func() {
+				createPropertyInDB()
+				createReservationInDB(1, checkIn, checkOut)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: &proto.BookingConfirmationResp{ApprovalRequired: false},
+				err: nil,
+			},
+		},
+		"GivenActiveHold_WhenConfirmBookingWithoutToken_ThenReturnInvalidArgument": {
+			in: getMockBookingReq(2, checkIn, checkOut),
+			setupFunc: func() {
+				createPropertyInDB()
+				createHoldInDB("token", checkIn, checkOut, time.Now().Add(time.Hour))
+			},
+			tearDownFunc: func() {
+				deleteHoldsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Sorry, property name (ID: 1) is already booked between 2023-07-10 and 2023-07-17"),
+			},
+		},
+		"GivenActiveHold_WhenConfirmBookingWithToken_ThenConfirmBooking": {
+			in: getMockBookingReqWithHold(2, checkIn, checkOut, "token"),
+			setupFunc: func() {
+				createPropertyInDB()
+				createHoldInDB("token", checkIn, checkOut, time.Now().Add(time.Hour))
+			},
+			tearDownFunc: func() {
+				deleteHoldsInDB()
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: &proto.BookingConfirmationResp{ApprovalRequired: false},
+				err: nil,
+			},
+		},
+		"GivenExpiredHold_WhenConfirmBookingWithToken_ThenReturnInvalidArgument": {
+			in: getMockBookingReqWithHold(2, checkIn, checkOut, "token"),
+			setupFunc: func() {
+				createPropertyInDB()
+				createHoldInDB("token", checkIn, checkOut, time.Now().Add(-time.Minute))
+			},
+			tearDownFunc: func() {
+				deleteHoldsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Hold token is expired or does not cover the stay from 2023-07-10 to 2023-07-17"),
+			},
+		},
+		"GivenExpiredHold_WhenConfirmBookingWithoutToken_ThenConfirmBooking": {
+			in: getMockBookingReq(2, checkIn, checkOut),
+			setupFunc: func() {
+				createPropertyInDB()
+				createHoldInDB("token", checkIn, checkOut, time.Now().Add(-time.Minute))
+			},
+			tearDownFunc: func() {
+				deleteHoldsInDB()
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: &proto.BookingConfirmationResp{ApprovalRequired: false},
+				err: nil,
+			},
+		},
+		"GivenPropertyInRequestMode_WhenConfirmBooking_ThenRequireApproval": {
+			in: getMockBookingReq(2, checkIn, checkOut),
+			setupFunc: func() {
+				createPropertyWithBookingModeInDB(model.REQUEST)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: &proto.BookingConfirmationResp{ApprovalRequired: true},
+				err: nil,
+			},
+		},
+	}
+
+	for scenario, testData := range tests {
+		log.Infof("Scenario: %s", scenario)
+
+		if testData.setupFunc != nil {
+			testData.setupFunc()
+		}
+
+		out, err := suite.internalClient.ConfirmBooking(suite.ctx, testData.in)
+		if err != nil {
+			if testData.expected.err == nil || testData.expected.err.Error() != err.Error() {
+				suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", testData.expected.err, err)
+			}
+		} else if out == nil || testData.expected.err != nil ||
+			out.ApprovalRequired != testData.expected.out.ApprovalRequired {
+			suite.T().Errorf("Out:\n Expected: %v\n Actual: %v", testData.expected.out, out)
+		}
+
+		if testData.tearDownFunc != nil {
+			testData.tearDownFunc()
+		}
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_ConfirmBookingConcurrently() {
+	const attempts = 20
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC)
+
+	// given
+	createPropertyInDB()
+	defer deletePropertyInDB()
+	defer deleteReservationsInDB()
+
+	// when many bookings for the same stay are confirmed in parallel
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = suite.internalClient.ConfirmBooking(suite.ctx, getMockBookingReq(uint32(i+1), checkIn, checkOut))
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// then exactly one wins and all others are declined
+	confirmed := 0
+	for _, err := range errs {
+		if err == nil {
+			confirmed++
+		} else if status.Code(err) != codes.InvalidArgument {
+			suite.T().Errorf("Unexpected err: %v", err)
+		}
+	}
+	suite.Equal(1, confirmed)
+
+	property, err := suite.client.GetProperty(suite.ctx, &proto.PropertyIdReq{Id: 1})
+	suite.Require().NoError(err)
+	suite.Len(property.Reservations, 1)
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_ConfirmBookingExceedingCapacity() {
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := checkIn.AddDate(0, 0, 7)
+
+	type expectation struct {
+		code       codes.Code
+		violations []string
+	}
+
+	tests := map[string]struct {
+		guests    model.Guests
+		setupFunc func()
+		expected  expectation
+	}{
+		"GivenTooManyGuestsAndPets_WhenConfirmBooking_ThenReturnAllViolations": {
+			guests: model.Guests{Adults: 3, Children: 2, Pets: 1},
+			setupFunc: func() {
+				createPropertyWithCapacityInDB(4, 0, true)
+			},
+			expected: expectation{
+				code: codes.InvalidArgument,
+				violations: []string{
+					"guests: 3 adults and 2 children exceed the capacity of property name (ID: 1) of 4 guests",
+					"pets: Property name (ID: 1) does not allow pets",
+				},
+			},
+		},
+		"GivenTooFewBedrooms_WhenConfirmBooking_ThenReturnViolation": {
+			guests: model.Guests{Adults: 3},
+			setupFunc: func() {
+				createPropertyWithCapacityInDB(0, 1, false)
+			},
+			expected: expectation{
+				code:       codes.InvalidArgument,
+				violations: []string{"adults: 3 adults exceed the 1 bedrooms of property name (ID: 1) sleeping 2 adults each"},
+			},
+		},
+		"GivenFittingGuests_WhenConfirmBooking_ThenConfirmBooking": {
+			guests: model.Guests{Adults: 3, Children: 1},
+			setupFunc: func() {
+				createPropertyWithCapacityInDB(4, 2, true)
+			},
+			expected: expectation{
+				code:       codes.OK,
+				violations: nil,
+			},
+		},
+	}
+
+	for scenario, testData := range tests {
+		log.Infof("Scenario: %s", scenario)
+
+		if testData.setupFunc != nil {
+			testData.setupFunc()
+		}
+
+		in := getMockBookingReq(2, checkIn, checkOut)
+		in.Adults, in.Children, in.Pets = testData.guests.Adults, testData.guests.Children, testData.guests.Pets
+		_, err := suite.internalClient.ConfirmBooking(suite.ctx, in)
+
+		st := status.Convert(err)
+		if st.Code() != testData.expected.code {
+			suite.T().Errorf("Code:\n Expected: %v\n Actual: %v", testData.expected.code, st.Code())
+		}
+		var violations []string
+		for _, detail := range st.Details() {
+			if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+				for _, violation := range badRequest.FieldViolations {
+					violations = append(violations, violation.Field+": "+violation.Description)
+				}
+			}
+		}
+		if !reflect.DeepEqual(testData.expected.violations, violations) {
+			suite.T().Errorf("Violations:\n Expected: %v\n Actual: %v", testData.expected.violations, violations)
+		}
+
+		deleteReservationsInDB()
+		deletePropertyInDB()
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_HoldProperty() {
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := checkIn.AddDate(0, 0, 7)
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	restoreClock := service.SetClock(fixedClock{now: now})
+	defer restoreClock()
+
+	createPropertyInDB()
+	defer deletePropertyInDB()
+	defer deleteHoldsInDB()
+
+	hold, err := suite.client.HoldProperty(suite.ctx, &proto.HoldPropertyReq{
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(checkIn),
+		CheckOut:   timestamppb.New(checkOut),
+		TtlSeconds: 600,
+	})
+	suite.Require().NoError(err)
+	suite.Equal(now.Add(10*time.Minute), hold.ExpiresAt.AsTime())
+
+	_, err = suite.client.HoldProperty(suite.ctx, &proto.HoldPropertyReq{
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(checkIn.AddDate(0, 0, 3)),
+		CheckOut:   timestamppb.New(checkOut.AddDate(0, 0, 3)),
+	})
+	suite.EqualError(err, "rpc error: code = InvalidArgument desc = Sorry, property name (ID: 1) is already booked between 2023-07-13 and 2023-07-20")
+
+	_, err = suite.client.HoldProperty(suite.ctx, &proto.HoldPropertyReq{
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(checkIn),
+		CheckOut:   timestamppb.New(checkOut),
+		TtlSeconds: 24 * 60 * 60,
+	})
+	suite.EqualError(err, "rpc error: code = InvalidArgument desc = Holds must expire within 1h0m0s")
+
+	// the hold expires once the clock passes its ttl and the reaper removes it
+	service.SetClock(fixedClock{now: now.Add(11 * time.Minute)})
+	released, err := service.ReleaseExpiredHolds()
+	suite.Require().NoError(err)
+	suite.Equal(int64(1), released)
+
+	_, err = suite.internalClient.ConfirmBooking(suite.ctx, getMockBookingReqWithHold(2, checkIn, checkOut, hold.Token))
+	suite.EqualError(err, "rpc error: code = InvalidArgument desc = Hold "+hold.Token+" is expired or does not cover the stay from 2023-07-10 to 2023-07-17")
+
+	_, err = suite.internalClient.ConfirmBooking(suite.ctx, getMockBookingReq(2, checkIn, checkOut))
+	suite.NoError(err)
+	deleteReservationsInDB()
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_Waitlist() {
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := checkIn.AddDate(0, 0, 7)
+
+	// given
+	createPropertyInDB()
+	createReservationInDB(1, checkIn, checkOut)
+	defer deletePropertyInDB()
+	defer deleteReservationsInDB()
+	defer deleteHoldsInDB()
+	defer deleteWaitlistInDB()
+
+	joinReq := &proto.JoinWaitlistReq{
+		PropertyId:   1,
+		CustomerName: "first",
+		CheckIn:      timestamppb.New(checkIn),
+		CheckOut:     timestamppb.New(checkOut),
+	}
+
+	// when joining the waitlist of the booked property
+	first, err := suite.client.JoinWaitlist(suite.ctx, joinReq)
+	suite.Require().NoError(err)
+	joinReq.CustomerName = "second"
+	second, err := suite.client.JoinWaitlist(suite.ctx, joinReq)
+	suite.Require().NoError(err)
+
+	// then both customers wait in the order they joined
+	waitlist, err := suite.client.ListWaitlist(suite.ctx, &proto.PropertyWaitlistReq{PropertyId: 1})
+	suite.Require().NoError(err)
+	suite.Len(waitlist.Entries, 2)
+	suite.Equal("first", waitlist.Entries[0].CustomerName)
+	suite.Equal("WAITING", waitlist.Entries[0].Status)
+
+	// when someone else tries to remove the first entry
+	_, err = suite.client.LeaveWaitlist(suite.ctx, &proto.LeaveWaitlistReq{PropertyId: 1, Id: first.Id, CustomerName: "second"})
+	suite.EqualError(err, "rpc error: code = PermissionDenied desc = Only customer first can leave waitlist entry 1")
+
+	// when the booking is cancelled
+	_, err = suite.internalClient.CancelBooking(suite.ctx, getMockBookingReq(1, checkIn, checkOut))
+	suite.Require().NoError(err)
+
+	// then only the first customer is offered a hold
+	waitlist, err = suite.client.ListWaitlist(suite.ctx, &proto.PropertyWaitlistReq{PropertyId: 1})
+	suite.Require().NoError(err)
+	suite.Equal("OFFERED", waitlist.Entries[0].Status)
+	suite.Equal("WAITING", waitlist.Entries[1].Status)
+
+	// and the public list does not reveal the token of the hold
+	for _, entry := range waitlist.Entries {
+		suite.Empty(entry.HoldToken)
+	}
+
+	// when the first customer looks up their own entries
+	own, err := suite.internalClient.GetWaitlist(suite.ctx, &proto.WaitlistReq{PropertyId: 1, CustomerName: "first"})
+	suite.Require().NoError(err)
+	suite.Require().Len(own.Entries, 1)
+	suite.NotEmpty(own.Entries[0].HoldToken)
+
+	// when the first customer books with the offered hold
+	_, err = suite.internalClient.ConfirmBooking(suite.ctx, getMockBookingReqWithHold(2, checkIn, checkOut, own.Entries[0].HoldToken))
+	suite.Require().NoError(err)
+
+	// then the fulfilled entry is removed
+	waitlist, err = suite.client.ListWaitlist(suite.ctx, &proto.PropertyWaitlistReq{PropertyId: 1})
+	suite.Require().NoError(err)
+	suite.Len(waitlist.Entries, 1)
+	suite.Equal(second.Id, waitlist.Entries[0].Id)
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_QuoteStay() {
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := checkIn.AddDate(0, 0, 7)
+
+	// given
+	_, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{
+		Name:        "name",
+		OwnerId:     1,
+		NightlyRate: 10000,
+		CleaningFee: 2500,
+		Currency:    "EUR",
+		TaxRate:     700,
+	})
+	suite.Require().NoError(err)
+	defer deletePropertyInDB()
+	defer deleteReservationsInDB()
+
+	expected := &proto.StayQuote{
+		Nights:      7,
+		NightlyRate: 10000,
+		CleaningFee: 2500,
+		Subtotal:    72500,
+		Tax:         5075,
+		Total:       77575,
+		Currency:    "EUR",
+	}
+
+	// when
+	quote, err := suite.internalClient.QuoteStay(suite.ctx, getMockBookingReq(0, checkIn, checkOut))
+
+	// then
+	suite.Require().NoError(err)
+	suite.True(googleproto.Equal(expected, quote), "Unexpected: %v", quote)
+
+	// when the booking is confirmed with a price that is no longer valid
+	req := getMockBookingReq(2, checkIn, checkOut)
+	req.Quote = &proto.StayQuote{Total: 70000, Currency: "EUR"}
+	_, err = suite.internalClient.ConfirmBooking(suite.ctx, req)
+
+	// then the confirmation is declined
+	suite.EqualError(err, "rpc error: code = FailedPrecondition desc = The price of the stay changed from 70000 EUR to 77575 EUR")
+
+	// when the booking is confirmed with the quoted price
+	req.Quote = expected
+	confirmation, err := suite.internalClient.ConfirmBooking(suite.ctx, req)
+
+	// then the confirmation contains the same quote
+	suite.Require().NoError(err)
+	suite.True(googleproto.Equal(expected, confirmation.Quote), "Unexpected: %v", confirmation.Quote)
+
+	// when the pricing is invalid
+	_, err = suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{Name: "name", Currency: "euro"})
+
+	// then
+	suite.EqualError(err, "rpc error: code = InvalidArgument desc = Unknown currency euro, expected an ISO 4217 code like EUR")
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_ListReservations() {
+	// given
+	createPropertyInDB()
+	defer deletePropertyInDB()
+	createReservationInDB(1, time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 7, 5, 0, 0, 0, 0, time.UTC))
+	createReservationInDB(2, time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC), time.Date(2023, 7, 17, 0, 0, 0, 0, time.UTC))
+	defer deleteReservationsInDB()
+
+	// when
+	list, err := suite.internalClient.ListReservations(suite.ctx, &proto.ListReservationsReq{
+		CheckOutAfter: timestamppb.New(time.Date(2023, 7, 5, 0, 0, 0, 0, time.UTC)),
+	})
+
+	// then only the reservation ending later is listed
+	suite.Require().NoError(err)
+	suite.Require().Len(list.Reservations, 1)
+	suite.Equal(uint32(2), list.Reservations[0].BookingId)
+	suite.Equal("CONFIRMED", list.Reservations[0].Status)
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_CancellationPolicy() {
+	// given
+	_, err := suite.client.CreateProperty(suite.ctx, &proto.CreatePropertyReq{
+		Name:               "name",
+		OwnerId:            1,
+		CancellationPolicy: "CUSTOM",
+		RefundTiers:        []*proto.RefundTier{{DaysBefore: 3, RefundPercent: 25}, {DaysBefore: 30, RefundPercent: 100}},
+	})
+	suite.Require().NoError(err)
+	defer deletePropertyInDB()
+	defer deleteRefundTiersInDB()
+
+	expected := &proto.CancellationPolicyResp{
+		Policy: "CUSTOM",
+		Tiers:  []*proto.PolicyTier{{DaysBefore: 30, RefundPercent: 100}, {DaysBefore: 3, RefundPercent: 25}},
+	}
+
+	// when
+	policy, err := suite.internalClient.GetCancellationPolicy(suite.ctx, &proto.BookingReq{PropertyId: 1})
+
+	// then the tiers are ordered from the earliest cancellation to the latest
+	suite.Require().NoError(err)
+	suite.True(googleproto.Equal(expected, policy), "Unexpected: %v", policy)
+
+	// when switching to a predefined policy
+	_, err = suite.client.UpdateProperty(suite.ctx, &proto.UpdatePropertyReq{Id: 1, Name: "name", CancellationPolicy: "MODERATE"})
+	suite.Require().NoError(err)
+	policy, err = suite.internalClient.GetCancellationPolicy(suite.ctx, &proto.BookingReq{PropertyId: 1})
+
+	// then the custom tiers are replaced
+	suite.Require().NoError(err)
+	suite.Equal("MODERATE", policy.Policy)
+	suite.Len(policy.Tiers, 2)
+
+	// when setting tiers for a predefined policy
+	_, err = suite.client.UpdateProperty(suite.ctx, &proto.UpdatePropertyReq{
+		Id: 1, Name: "name", CancellationPolicy: "STRICT", RefundTiers: []*proto.RefundTier{{DaysBefore: 1, RefundPercent: 100}},
+	})
+
+	// then
+	expectedErr := "rpc error: code = InvalidArgument desc = Refund tiers can only be set for CUSTOM cancellation policies"
+	if err == nil || err.Error() != expectedErr {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expectedErr, err)
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_MigrateBookedProperties() {
+	// given a property booked as a whole by an earlier version
+	createPropertyInDB()
+	defer deletePropertyInDB()
+	defer deleteReservationsInDB()
+	suite.Require().NoError(db.DB.Exec("ALTER TABLE properties ADD COLUMN status VARCHAR(10), ADD COLUMN booking_id INT UNSIGNED").Error)
+	suite.Require().NoError(db.DB.Exec("UPDATE properties SET status = 'BOOKED', booking_id = 7 WHERE id = 1").Error)
+	suite.Require().NoError(db.DB.Exec("CREATE TABLE bookings (id INT UNSIGNED PRIMARY KEY, check_in DATETIME, check_out DATETIME)").Error)
+	defer db.DB.Exec("DROP TABLE bookings")
+
+	// when the stay of its booking is unknown
+	err := db.Connect("localhost:3306")
+
+	// then the migration fails and keeps the columns
+	expected := "property 1 is booked by booking 7 without a known stay, set its check-in and check-out before migrating"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+	if !db.DB.Migrator().HasColumn(new(model.Property), "booking_id") {
+		suite.T().Errorf("Column booking_id was dropped")
+	}
+
+	// when the booking has a stay
+	suite.Require().NoError(db.DB.Exec("INSERT INTO bookings VALUES (7, '2023-07-10 00:00:00', '2023-07-17 00:00:00')").Error)
+	err = db.Connect("localhost:3306")
+
+	// then the property keeps its reservation and the columns are dropped
+	if err != nil {
+		suite.T().Errorf("Unexpected err: %v", err)
+	}
+	var reservations []model.Reservation
+	db.DB.Where("property_id = ? AND booking_id = ?", 1, 7).Find(&reservations)
+	if len(reservations) != 1 || !reservations[0].CheckIn.Equal(time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)) {
+		suite.T().Errorf("Unexpected reservations: %v", reservations)
+	}
+	if db.DB.Migrator().HasColumn(new(model.Property), "status") || db.DB.Migrator().HasColumn(new(model.Property), "booking_id") {
+		suite.T().Errorf("Columns status and booking_id were not dropped")
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_MigrateUsers() {
+	defer func() { suite.mockUserInternalServer.Accounts = getMockAccounts() }()
+
+	// given a migrated property and properties of earlier versions only storing the name of their owner
+	createPropertyInDB()
+	for _, ownerName := range []string{"Mickey Mouse", "mickey mouse", "\t"} {
+		suite.Require().NoError(db.DB.Create(&model.Property{Name: "name", OwnerName: ownerName}).Error)
+	}
+
+	// when
+	count, err := service.MigrateUsers()
+
+	// then names differing in case are linked to one account and the blank name is skipped
+	suite.Require().NoError(err)
+	suite.Equal(int64(2), count)
+	list, err := suite.client.GetProperties(suite.ctx, &proto.ListPropertiesReq{OwnerId: 4})
+	suite.Require().NoError(err)
+	suite.Require().Len(list.Properties, 2)
+	suite.Equal(list.Properties[0].OwnerName, list.Properties[1].OwnerName)
+	suite.Equal([]string{"OWNER"}, suite.mockUserInternalServer.Accounts[4].Roles)
+
+	// when migrating again
+	count, err = service.MigrateUsers()
+
+	// then
+	suite.Require().NoError(err)
+	suite.Equal(int64(0), count)
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_ApproveBooking() {
+	cancel := suite.mockBookingInternalServer.Start(bookingInternalServerPort)
+	defer cancel()
+
+	type expectation struct {
+		out *proto.PropertyResp
+		err error
+	}
+
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := checkIn.AddDate(0, 0, 7)
+
+	tests := map[string]struct {
+		in           *proto.ReservationDecisionReq
+		setupFunc    func()
+		tearDownFunc func()
+		expected     expectation
+	}{
+		"GivenOtherOwner_WhenApproveBooking_ThenReturnPermissionDenied": {
+			in: &proto.ReservationDecisionReq{PropertyId: 1, BookingId: 1, OwnerId: 2},
+			setupFunc: func() {
+				createPropertyWithBookingModeInDB(model.REQUEST)
+				createReservationWithStatusInDB(1, checkIn, checkOut, model.PENDING_APPROVAL)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = PermissionDenied desc = Only the owner of property name (ID: 1) can decide about its bookings"),
+			},
+		},
+		"GivenConfirmedReservation_WhenApproveBooking_ThenReturnInvalidArgument": {
+			in: &proto.ReservationDecisionReq{PropertyId: 1, BookingId: 1, OwnerId: 1},
+			setupFunc: func() {
+				createPropertyWithBookingModeInDB(model.REQUEST)
+				createReservationInDB(1, checkIn, checkOut)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Booking 1 of property name (ID: 1) is not awaiting approval"),
+			},
+		},
+		"GivenPendingReservation_WhenApproveBooking_ThenConfirmReservation": {
+			in: &proto.ReservationDecisionReq{PropertyId: 1, BookingId: 1, OwnerId: 1},
+			setupFunc: func() {
+				createPropertyWithBookingModeInDB(model.REQUEST)
+				createReservationWithStatusInDB(1, checkIn, checkOut, model.PENDING_APPROVAL)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out: &proto.PropertyResp{Reservations: []*proto.ReservationResp{{BookingId: 1, Status: "CONFIRMED"}}},
+				err: nil,
+			},
+		},
+	}
+
+	for scenario, testData := range tests {
+		log.Infof("Scenario: %s", scenario)
+
+		if testData.setupFunc != nil {
+			testData.setupFunc()
+		}
+
+		out, err := suite.client.ApproveBooking(suite.ctx, testData.in)
+		if err != nil {
+			if testData.expected.err == nil || testData.expected.err.Error() != err.Error() {
+				suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", testData.expected.err, err)
+			}
+		} else if out == nil || testData.expected.err != nil ||
+			len(out.Reservations) != 1 || out.Reservations[0].Status != testData.expected.out.Reservations[0].Status {
+			suite.T().Errorf("Out:\n Expected: %v\n Actual: %v", testData.expected.out, out)
+		}
+
+		if testData.tearDownFunc != nil {
+			testData.tearDownFunc()
+		}
+	}
+}
+
+func (suite *PropertyTestSuite) TestPropertyHandler_DeclineBooking() {
+	cancel := suite.mockBookingInternalServer.Start(bookingInternalServerPort)
+	defer cancel()
+	suite.mockBookingInternalServer.UnavailableBookingId = 2
+	defer func() { suite.mockBookingInternalServer.UnavailableBookingId = 0 }()
+
+	type expectation struct {
+		out          *proto.PropertyResp
+		err          error
+		reservations []model.ReservationStatus
+	}
+
+	checkIn := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	checkOut := checkIn.AddDate(0, 0, 7)
+
+	tests := map[string]struct {
+		in           *proto.ReservationDecisionReq
+		setupFunc    func()
+		tearDownFunc func()
+		expected     expectation
+	}{
+		"GivenConfirmedReservation_WhenDeclineBooking_ThenReturnInvalidArgument": {
+			in: &proto.ReservationDecisionReq{PropertyId: 1, BookingId: 1, OwnerId: 1},
+			setupFunc: func() {
+				createPropertyWithBookingModeInDB(model.REQUEST)
+				createReservationInDB(1, checkIn, checkOut)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out:          nil,
+				err:          errors.New("rpc error: code = InvalidArgument desc = Booking 1 of property name (ID: 1) is not awaiting approval"),
+				reservations: []model.ReservationStatus{model.CONFIRMED},
+			},
+		},
+		"GivenUnavailableBookingService_WhenDeclineBooking_ThenKeepReservation": {
+			in: &proto.ReservationDecisionReq{PropertyId: 1, BookingId: 2, OwnerId: 1},
+			setupFunc: func() {
+				createPropertyWithBookingModeInDB(model.REQUEST)
+				createReservationWithStatusInDB(2, checkIn, checkOut, model.PENDING_APPROVAL)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out:          nil,
+				err:          errors.New("rpc error: code = Unavailable desc = Booking service unavailable"),
+				reservations: []model.ReservationStatus{model.PENDING_APPROVAL},
+			},
+		},
+		"GivenPendingReservation_WhenDeclineBooking_ThenDeleteReservation": {
+			in: &proto.ReservationDecisionReq{PropertyId: 1, BookingId: 1, OwnerId: 1},
+			setupFunc: func() {
+				createPropertyWithBookingModeInDB(model.REQUEST)
+				createReservationWithStatusInDB(1, checkIn, checkOut, model.PENDING_APPROVAL)
+			},
+			tearDownFunc: func() {
+				deleteReservationsInDB()
+				deletePropertyInDB()
+			},
+			expected: expectation{
+				out:          &proto.PropertyResp{},
+				err:          nil,
+				reservations: []model.ReservationStatus{},
+			},
+		},
+	}
+
+	for scenario, testData := range tests {
+		log.Infof("Scenario: %s", scenario)
+
+		if testData.setupFunc != nil {
+			testData.setupFunc()
+		}
+
+		out, err := suite.client.DeclineBooking(suite.ctx, testData.in)
+		if err != nil {
+			if testData.expected.err == nil || testData.expected.err.Error() != err.Error() {
+				suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", testData.expected.err, err)
+			}
+		} else if out == nil || testData.expected.err != nil || len(out.Reservations) != 0 {
+			suite.T().Errorf("Out:\n Expected: %v\n Actual: %v", testData.expected.out, out)
+		}
+
+		var reservations []model.Reservation
+		db.DB.Where("property_id = ?", 1).Find(&reservations)
+		statuses := make([]model.ReservationStatus, 0, len(reservations))
+		for _, reservation := range reservations {
+			statuses = append(statuses, reservation.ReservationStatus)
+		}
+		if !reflect.DeepEqual(testData.expected.reservations, statuses) {
+			suite.T().Errorf("Reservations:\n Expected: %v\n Actual: %v", testData.expected.reservations, statuses)
+		}
+
+		if testData.tearDownFunc != nil {
+			testData.tearDownFunc()
+		}
+	}
+}
+
 func TestPropertyTestSuite(t *testing.T) {
 	suite.Run(t, new(PropertyTestSuite))
 }
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/service"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *PropertyHandler) CreateReview(_ context.Context, req *proto.CreateReviewReq) (*proto.ReviewResp, error) {
+	review, err := model.NewReview(uint(req.PropertyId), uint(req.BookingId), uint(req.CustomerId), req.Rating, req.Text)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	createdReview, err := service.CreateReview(review)
+	if err != nil {
+		log.Errorf("Error calling service CreateReview for property with ID %v: %v", req.PropertyId, err)
+		return nil, mapReviewError(err)
+	}
+	if createdReview == nil {
+		return nil, status.Errorf(codes.NotFound, "Property not found")
+	}
+	return mapToProtoReviewResp(createdReview), nil
+}
+
+func (h *PropertyHandler) ListReviews(_ context.Context, req *proto.ListReviewsReq) (*proto.ListReviewsResp, error) {
+	page := model.PageRequest{PageSize: req.PageSize, PageToken: req.PageToken, OrderBy: req.OrderBy}
+	reviews, nextPageToken, err := service.GetReviews(uint(req.PropertyId), page)
+	if err != nil {
+		log.Errorf("Error calling service GetReviews for property with ID %v: %v", req.PropertyId, err)
+		return nil, mapReviewError(err)
+	}
+
+	var protoReviews []*proto.ReviewResp
+	for _, review := range reviews {
+		protoReviews = append(protoReviews, mapToProtoReviewResp(&review))
+	}
+	return &proto.ListReviewsResp{Reviews: protoReviews, NextPageToken: nextPageToken}, nil
+}
+
+func (h *PropertyHandler) ReplyToReview(_ context.Context, req *proto.ReplyToReviewReq) (*proto.ReviewResp, error) {
+	reply, err := model.ValidateReply(req.Text)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	review, err := service.ReplyToReview(uint(req.PropertyId), uint(req.ReviewId), uint(req.OwnerId), reply)
+	if err != nil {
+		log.Errorf("Error calling service ReplyToReview with ID %v: %v", req.ReviewId, err)
+		return nil, mapReviewError(err)
+	}
+	if review == nil {
+		return nil, status.Errorf(codes.NotFound, "Review not found")
+	}
+	return mapToProtoReviewResp(review), nil
+}
+
+// mapReviewError maps reviewers without a completed stay and other owners to PermissionDenied
+func mapReviewError(err error) error {
+	var permissionError *model.PermissionError
+	if errors.As(err, &permissionError) {
+		return status.Errorf(codes.PermissionDenied, permissionError.Error())
+	}
+	var propertyError *model.PropertyError
+	if errors.As(err, &propertyError) {
+		return status.Errorf(codes.InvalidArgument, propertyError.Error())
+	}
+	// errors of the booking service are passed on with their original code
+	if bookingStatus, ok := status.FromError(err); ok {
+		return bookingStatus.Err()
+	}
+	return status.Errorf(codes.Internal, err.Error())
+}
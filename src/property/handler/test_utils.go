@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
@@ -9,19 +10,28 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+	"image"
+	"image/color"
+	"image/png"
 	"net"
+	"time"
 )
 
-// creates and starts a PropertyExternalServer and returns a client that is connected to it and can be used for tests
-func startPropertyExternalServer(ctx context.Context) (proto.PropertyExternalClient, func()) {
+// creates and starts a PropertyExternalServer and PropertyInternalServer
+// and returns clients that are connected to them and can be used for tests
+func startPropertyServer(ctx context.Context) (proto.PropertyExternalClient, proto.PropertyInternalClient, func()) {
 	buffer := 1024 * 1024
 	lis := bufconn.Listen(buffer)
 
-	baseServer := grpc.NewServer()
-	proto.RegisterPropertyExternalServer(baseServer, new(PropertyHandler))
+	baseServer := grpc.NewServer(grpc.UnaryInterceptor(IdempotencyInterceptor))
+	propertyHandler := new(PropertyHandler)
+	proto.RegisterPropertyExternalServer(baseServer, propertyHandler)
+	proto.RegisterPropertyInternalServer(baseServer, propertyHandler)
 	go func() {
 		if err := baseServer.Serve(lis); err != nil {
-			log.Printf("Error serving propertyExternalServer: %v", err)
+			log.Printf("Error serving propertyServer: %v", err)
 		}
 	}()
 
@@ -30,16 +40,17 @@ func startPropertyExternalServer(ctx context.Context) (proto.PropertyExternalCli
 			return lis.Dial()
 		}), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		log.Printf("Error connecting to propertyExternalServer: %v", err)
+		log.Printf("Error connecting to propertyServer: %v", err)
 	}
 
 	closer := func() {
 		baseServer.Stop()
 	}
 
-	client := proto.NewPropertyExternalClient(conn)
+	externalClient := proto.NewPropertyExternalClient(conn)
+	internalClient := proto.NewPropertyInternalClient(conn)
 
-	return client, closer
+	return externalClient, internalClient, closer
 }
 
 func getMockListPropertiesResp(propertyResp *proto.PropertyResp) *proto.ListPropertiesResp {
@@ -65,15 +76,127 @@ func getMockPropertyResp(ownerName string) *proto.PropertyResp {
 	}
 }
 
+// getMockAccounts returns the accounts of the mock user service, the owner of the properties has ID 1
+func getMockAccounts() map[uint32]*proto.Account {
+	return map[uint32]*proto.Account{
+		1: {Id: 1, Name: "owner", Roles: []string{"OWNER"}},
+		2: {Id: 2, Name: "other", Roles: []string{"CUSTOMER", "OWNER"}},
+		3: {Id: 3, Name: "customer", Roles: []string{"CUSTOMER"}},
+	}
+}
+
 func createPropertyInDB() {
+	createPropertyWithBookingModeInDB(model.INSTANT)
+}
+
+func createPropertyWithBookingModeInDB(bookingMode model.BookingMode) {
 	property := model.Property{
+		Model:       gorm.Model{ID: 1},
+		Name:        "name",
 		Description: "description",
+		OwnerId:     1,
 		OwnerName:   "owner",
-		Status:      "FREE",
+		BookingMode: bookingMode,
+	}
+	db.DB.Create(&property)
+}
+
+func createPropertyWithCapacityInDB(maxGuests uint32, bedrooms uint32, noPets bool) {
+	property := model.Property{
+		Model:       gorm.Model{ID: 1},
+		Name:        "name",
+		Description: "description",
+		OwnerId:     1,
+		OwnerName:   "owner",
+		BookingMode: model.INSTANT,
+		MaxGuests:   maxGuests,
+		Bedrooms:    bedrooms,
+		NoPets:      noPets,
 	}
 	db.DB.Create(&property)
 }
 
+func createReservationInDB(bookingId uint, checkIn time.Time, checkOut time.Time) {
+	createReservationWithStatusInDB(bookingId, checkIn, checkOut, model.CONFIRMED)
+}
+
+func createReservationWithStatusInDB(bookingId uint, checkIn time.Time, checkOut time.Time, status model.ReservationStatus) {
+	reservation := model.Reservation{
+		PropertyId:        1,
+		BookingId:         bookingId,
+		CheckIn:           checkIn,
+		CheckOut:          checkOut,
+		ReservationStatus: status,
+	}
+	db.DB.Create(&reservation)
+}
+
+func deleteReservationsInDB() {
+	db.DB.Unscoped().Where("property_id = ?", 1).Delete(new(model.Reservation))
+}
+
+func getMockBookingReq(bookingId uint32, checkIn time.Time, checkOut time.Time) *proto.BookingReq {
+	return &proto.BookingReq{
+		BookingId:  bookingId,
+		PropertyId: 1,
+		CheckIn:    timestamppb.New(checkIn),
+		CheckOut:   timestamppb.New(checkOut),
+	}
+}
+
+func getMockBookingReqWithHold(bookingId uint32, checkIn time.Time, checkOut time.Time, holdToken string) *proto.BookingReq {
+	req := getMockBookingReq(bookingId, checkIn, checkOut)
+	req.HoldToken = holdToken
+	return req
+}
+
+func createHoldInDB(token string, checkIn time.Time, checkOut time.Time, expiresAt time.Time) {
+	hold := model.Hold{
+		Token:      token,
+		PropertyId: 1,
+		CheckIn:    checkIn,
+		CheckOut:   checkOut,
+		ExpiresAt:  expiresAt,
+	}
+	db.DB.Create(&hold)
+}
+
+func deleteHoldsInDB() {
+	db.DB.Unscoped().Where("property_id = ?", 1).Delete(new(model.Hold))
+}
+
+func deleteWaitlistInDB() {
+	db.DB.Unscoped().Where("property_id = ?", 1).Delete(new(model.WaitlistEntry))
+}
+
+// fixedClock always returns the same time, so that tests can control when holds expire
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
 func deletePropertyInDB() {
-	db.DB.Delete(new(model.Property), 1)
+	db.DB.Unscoped().Delete(new(model.Property), 1)
+}
+
+func deleteRefundTiersInDB() {
+	db.DB.Unscoped().Where("property_id = ?", 1).Delete(new(model.RefundTier))
+}
+
+// encodeTestPNG returns a PNG image of the given size with a gradient
+func encodeTestPNG(width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		log.Fatalf("Error encoding test image: %v", err)
+	}
+	return buffer.Bytes()
 }
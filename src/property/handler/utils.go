@@ -1,20 +1,281 @@
 package handler
 
 import (
+	"context"
+	"fmt"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"strconv"
+	"strings"
+	"time"
 )
 
+func mapToProtoPropertySearchResult(result *model.SearchResult) *proto.PropertySearchResult {
+	var snippets []*proto.SearchSnippet
+	for _, snippet := range result.Snippets {
+		snippets = append(snippets, &proto.SearchSnippet{Field: string(snippet.Field), Text: snippet.Text})
+	}
+	return &proto.PropertySearchResult{
+		Property: mapToProtoPropertyResp(&result.Property),
+		Score:    result.Score,
+		Snippets: snippets,
+	}
+}
+
 func mapToProtoPropertyResp(property *model.Property) *proto.PropertyResp {
+	var refundTiers []*proto.RefundTier
+	for _, tier := range property.EffectiveRefundTiers() {
+		refundTiers = append(refundTiers, &proto.RefundTier{
+			DaysBefore:    tier.DaysBefore,
+			RefundPercent: tier.RefundPercent,
+		})
+	}
+
+	var reservations []*proto.ReservationResp
+	for _, reservation := range property.Reservations {
+		reservations = append(reservations, &proto.ReservationResp{
+			BookingId: uint32(reservation.BookingId),
+			CheckIn:   timestamppb.New(reservation.CheckIn),
+			CheckOut:  timestamppb.New(reservation.CheckOut),
+			Status:    string(reservation.ReservationStatus),
+		})
+	}
+
+	var location *proto.GeoPoint
+	if property.HasLocation() {
+		location = &proto.GeoPoint{Latitude: *property.Latitude, Longitude: *property.Longitude}
+	}
+
+	var amenities []*proto.AmenityResp
+	for _, amenity := range property.Amenities {
+		amenities = append(amenities, mapToProtoAmenityResp(&amenity))
+	}
+	var tags []string
+	for _, tag := range property.Tags {
+		tags = append(tags, tag.Name)
+	}
+
 	return &proto.PropertyResp{
-		Id:          uint32(property.ID),
-		Name:        property.Name,
-		Description: property.Description,
-		OwnerName:   property.OwnerName,
-		Address:     property.Address,
-		Status:      string(property.Status),
-		CreatedAt:   timestamppb.New(property.CreatedAt),
-		UpdatedAt:   timestamppb.New(property.UpdatedAt),
+		Id:                 uint32(property.ID),
+		Name:               property.Name,
+		Description:        property.Description,
+		OwnerName:          property.OwnerName,
+		OwnerId:            uint32(property.OwnerId),
+		Address:            property.Address,
+		Status:             string(property.StatusAt(time.Now())),
+		CreatedAt:          timestamppb.New(property.CreatedAt),
+		UpdatedAt:          timestamppb.New(property.UpdatedAt),
+		Reservations:       reservations,
+		BookingMode:        string(property.BookingMode),
+		NightlyRate:        property.NightlyRate,
+		CleaningFee:        property.CleaningFee,
+		Currency:           property.Currency,
+		TaxRate:            property.TaxRate,
+		MaxGuests:          property.MaxGuests,
+		Bedrooms:           property.Bedrooms,
+		NoPets:             property.NoPets,
+		CancellationPolicy: string(property.CancellationPolicy),
+		RefundTiers:        refundTiers,
+		Etag:               strconv.FormatUint(uint64(property.Version), 10),
+		PostalAddress: &proto.PostalAddress{
+			Street:     property.PostalAddress.Street,
+			PostalCode: property.PostalAddress.PostalCode,
+			City:       property.PostalAddress.City,
+			Country:    property.PostalAddress.Country,
+		},
+		Location:      location,
+		Amenities:     amenities,
+		Tags:          tags,
+		Photos:        mapToProtoPhotoResps(property.Photos),
+		AverageRating: property.AverageRating(),
+		ReviewCount:   property.ReviewCount,
+	}
+}
+
+func mapToProtoReservationEntry(reservation *model.Reservation) *proto.ReservationEntry {
+	return &proto.ReservationEntry{
+		BookingId:  uint32(reservation.BookingId),
+		PropertyId: uint32(reservation.PropertyId),
+		CheckIn:    timestamppb.New(reservation.CheckIn),
+		CheckOut:   timestamppb.New(reservation.CheckOut),
+		Status:     string(reservation.ReservationStatus),
+	}
+}
+
+func mapToRefundTiers(refundTiers []*proto.RefundTier) []model.RefundTier {
+	var tiers []model.RefundTier
+	for _, tier := range refundTiers {
+		tiers = append(tiers, model.RefundTier{
+			DaysBefore:    tier.DaysBefore,
+			RefundPercent: tier.RefundPercent,
+		})
+	}
+	return tiers
+}
+
+func mapToProtoHoldResp(hold *model.Hold) *proto.HoldResp {
+	return &proto.HoldResp{
+		Token:      hold.Token,
+		PropertyId: uint32(hold.PropertyId),
+		CheckIn:    timestamppb.New(hold.CheckIn),
+		CheckOut:   timestamppb.New(hold.CheckOut),
+		ExpiresAt:  timestamppb.New(hold.ExpiresAt),
+	}
+}
+
+func mapToProtoWaitlistEntryResp(waitlistEntry *model.WaitlistEntry) *proto.WaitlistEntryResp {
+	resp := &proto.WaitlistEntryResp{
+		Id:           uint32(waitlistEntry.ID),
+		PropertyId:   uint32(waitlistEntry.PropertyId),
+		CustomerName: waitlistEntry.CustomerName,
+		CheckIn:      timestamppb.New(waitlistEntry.CheckIn),
+		CheckOut:     timestamppb.New(waitlistEntry.CheckOut),
+		Status:       string(waitlistEntry.WaitlistStatus),
+		CreatedAt:    timestamppb.New(waitlistEntry.CreatedAt),
+	}
+	if waitlistEntry.OfferExpiresAt != nil {
+		resp.OfferExpiresAt = timestamppb.New(*waitlistEntry.OfferExpiresAt)
+	}
+	return resp
+}
+
+func mapToProtoWaitlistEntry(waitlistEntry *model.WaitlistEntry) *proto.WaitlistEntry {
+	entry := &proto.WaitlistEntry{
+		Id:           uint32(waitlistEntry.ID),
+		PropertyId:   uint32(waitlistEntry.PropertyId),
+		CustomerName: waitlistEntry.CustomerName,
+		CheckIn:      timestamppb.New(waitlistEntry.CheckIn),
+		CheckOut:     timestamppb.New(waitlistEntry.CheckOut),
+		Status:       string(waitlistEntry.WaitlistStatus),
+		HoldToken:    waitlistEntry.HoldToken,
+		CreatedAt:    timestamppb.New(waitlistEntry.CreatedAt),
+	}
+	if waitlistEntry.OfferExpiresAt != nil {
+		entry.OfferExpiresAt = timestamppb.New(*waitlistEntry.OfferExpiresAt)
+	}
+	return entry
+}
+
+func mapToProtoStayQuote(quote *model.Quote) *proto.StayQuote {
+	return &proto.StayQuote{
+		Nights:      quote.Nights,
+		NightlyRate: quote.NightlyRate,
+		CleaningFee: quote.CleaningFee,
+		Subtotal:    quote.Subtotal,
+		Tax:         quote.Tax,
+		Total:       quote.Total,
+		Currency:    quote.Currency,
+	}
+}
+
+// mapCapacityError returns an InvalidArgument status that lists the violations as details
+// so that clients can tell which fields of the booking to correct
+func mapCapacityError(capacityError *model.CapacityError) error {
+	badRequest := new(errdetails.BadRequest)
+	for _, violation := range capacityError.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.Field,
+			Description: violation.Description,
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, capacityError.Error())
+	detailedStatus, err := st.WithDetails(badRequest)
+	if err != nil {
+		return st.Err()
+	}
+	return detailedStatus.Err()
+}
+
+// ifMatchHeader is the gRPC metadata key to which the proxy forwards the If-Match HTTP header
+const ifMatchHeader = "if-match"
+
+// getExpectedVersion parses the ETag sent via If-Match, 0 means that the client did not expect a version
+// NOTE: Quotes are optional, so that gRPC clients can send the etag of the response as is
+func getExpectedVersion(ctx context.Context) (uint, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(ifMatchHeader)) == 0 {
+		return 0, nil
+	}
+	etag := strings.TrimSpace(md.Get(ifMatchHeader)[0])
+	if etag == "*" {
+		return 0, nil
+	}
+	version, err := strconv.ParseUint(strings.Trim(etag, `"`), 10, 32)
+	if err != nil || version == 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "Invalid If-Match %s, expected the etag of the property", etag)
+	}
+	return uint(version), nil
+}
+
+func mapToPostalAddress(address *proto.PostalAddress) model.PostalAddress {
+	if address == nil {
+		return model.PostalAddress{}
+	}
+	return model.PostalAddress{
+		Street:     address.Street,
+		PostalCode: address.PostalCode,
+		City:       address.City,
+		Country:    address.Country,
+	}
+}
+
+func mapToProtoAmenityResp(amenity *model.Amenity) *proto.AmenityResp {
+	return &proto.AmenityResp{Code: amenity.Code, Name: amenity.Name}
+}
+
+func mapToProtoFacetCounts(counts []model.FacetCount) []*proto.FacetCount {
+	var protoCounts []*proto.FacetCount
+	for _, count := range counts {
+		protoCounts = append(protoCounts, &proto.FacetCount{Value: count.Value, Name: count.Name, Count: uint32(count.Count)})
+	}
+	return protoCounts
+}
+
+func mapToProtoPhotoResp(photo *model.Photo) *proto.PhotoResp {
+	url := fmt.Sprintf("/properties/%d/photos/%d", photo.PropertyId, photo.ID)
+	return &proto.PhotoResp{
+		Id:           uint32(photo.ID),
+		PropertyId:   uint32(photo.PropertyId),
+		Position:     photo.Position,
+		Cover:        photo.Cover,
+		ContentType:  photo.ContentType,
+		Size:         photo.Size,
+		Width:        photo.Width,
+		Height:       photo.Height,
+		Url:          url,
+		ThumbnailUrl: url + "?size=thumbnail",
+		CreatedAt:    timestamppb.New(photo.CreatedAt),
+	}
+}
+
+func mapToProtoPhotoResps(photos []model.Photo) []*proto.PhotoResp {
+	var protoPhotos []*proto.PhotoResp
+	for _, photo := range photos {
+		protoPhotos = append(protoPhotos, mapToProtoPhotoResp(&photo))
+	}
+	return protoPhotos
+}
+
+func mapToProtoReviewResp(review *model.Review) *proto.ReviewResp {
+	protoReview := &proto.ReviewResp{
+		Id:           uint32(review.ID),
+		PropertyId:   uint32(review.PropertyId),
+		BookingId:    uint32(review.BookingId),
+		CustomerName: review.CustomerName,
+		CustomerId:   uint32(review.CustomerId),
+		Rating:       review.Rating,
+		Text:         review.Text,
+		CreatedAt:    timestamppb.New(review.CreatedAt),
+		Reply:        review.Reply,
+	}
+	if review.HasReply() {
+		protoReview.RepliedAt = timestamppb.New(*review.RepliedAt)
 	}
+	return protoReview
 }
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/service"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (h *PropertyHandler) JoinWaitlist(_ context.Context, req *proto.JoinWaitlistReq) (*proto.WaitlistEntryResp, error) {
+	waitlistEntry, err := joinWaitlist(req.PropertyId, req.CustomerName, req.CheckIn, req.CheckOut)
+	if err != nil {
+		return nil, err
+	}
+	// the hold token is only passed to the customer the entry belongs to, never in listings
+	resp := mapToProtoWaitlistEntryResp(waitlistEntry)
+	resp.HoldToken = waitlistEntry.HoldToken
+	return resp, nil
+}
+
+func (h *PropertyHandler) LeaveWaitlist(_ context.Context, req *proto.LeaveWaitlistReq) (*emptypb.Empty, error) {
+	if err := leaveWaitlist(req.PropertyId, req.Id, req.CustomerName); err != nil {
+		return nil, err
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (h *PropertyHandler) ListWaitlist(_ context.Context, req *proto.PropertyWaitlistReq) (*proto.ListWaitlistResp, error) {
+	waitlist, err := service.GetWaitlist(uint(req.PropertyId), "")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	var entries []*proto.WaitlistEntryResp
+	for _, waitlistEntry := range waitlist {
+		entries = append(entries, mapToProtoWaitlistEntryResp(&waitlistEntry))
+	}
+	return &proto.ListWaitlistResp{Entries: entries}, nil
+}
+
+func (h *PropertyHandler) AddToWaitlist(_ context.Context, req *proto.WaitlistReq) (*proto.WaitlistEntry, error) {
+	log.Infof("Received waitlist request: %v", req)
+
+	waitlistEntry, err := joinWaitlist(req.PropertyId, req.CustomerName, req.CheckIn, req.CheckOut)
+	if err != nil {
+		return nil, err
+	}
+	return mapToProtoWaitlistEntry(waitlistEntry), nil
+}
+
+func (h *PropertyHandler) RemoveFromWaitlist(_ context.Context, req *proto.WaitlistReq) (*emptypb.Empty, error) {
+	log.Infof("Received waitlist removal request: %v", req)
+
+	if err := leaveWaitlist(req.PropertyId, req.Id, req.CustomerName); err != nil {
+		return nil, err
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (h *PropertyHandler) GetWaitlist(_ context.Context, req *proto.WaitlistReq) (*proto.Waitlist, error) {
+	waitlist, err := service.GetWaitlist(uint(req.PropertyId), req.CustomerName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	var entries []*proto.WaitlistEntry
+	for _, waitlistEntry := range waitlist {
+		entries = append(entries, mapToProtoWaitlistEntry(&waitlistEntry))
+	}
+	return &proto.Waitlist{Entries: entries}, nil
+}
+
+// joinWaitlist adds the given customer to the waitlist of the property matching the given id
+func joinWaitlist(propertyId uint32, customerName string, checkIn *timestamppb.Timestamp, checkOut *timestamppb.Timestamp) (*model.WaitlistEntry, error) {
+	if checkIn == nil || checkOut == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Check-in and check-out are required")
+	}
+
+	existingProperty, err := service.GetProperty(uint(propertyId))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if existingProperty == nil {
+		return nil, status.Errorf(codes.NotFound, "Property not found")
+	}
+
+	waitlistEntry, err := service.JoinWaitlist(existingProperty, customerName, checkIn.AsTime(), checkOut.AsTime())
+	if err != nil {
+		log.Errorf("Error calling service JoinWaitlist with ID %v: %v", propertyId, err)
+		return nil, mapWaitlistError(err)
+	}
+	return waitlistEntry, nil
+}
+
+// leaveWaitlist removes the waitlist entry matching the given id on behalf of the given customer
+func leaveWaitlist(propertyId uint32, id uint32, customerName string) error {
+	existingProperty, err := service.GetProperty(uint(propertyId))
+	if err != nil {
+		return status.Errorf(codes.Internal, err.Error())
+	}
+	if existingProperty == nil {
+		return status.Errorf(codes.NotFound, "Property not found")
+	}
+
+	err = service.LeaveWaitlist(existingProperty, uint(id), customerName)
+	if err != nil {
+		log.Errorf("Error calling service LeaveWaitlist with ID %v: %v", propertyId, err)
+		return mapWaitlistError(err)
+	}
+	return nil
+}
+
+func mapWaitlistError(err error) error {
+	var permissionError *model.PermissionError
+	if errors.As(err, &permissionError) {
+		return status.Errorf(codes.PermissionDenied, permissionError.Error())
+	}
+	var propertyError *model.PropertyError
+	if errors.As(err, &propertyError) {
+		return status.Errorf(codes.InvalidArgument, propertyError.Error())
+	}
+	return status.Errorf(codes.Internal, err.Error())
+}
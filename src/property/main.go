@@ -5,6 +5,8 @@ import (
 	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/handler"
 	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/service"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/storage"
 	"google.golang.org/grpc"
 	"net"
 	"os"
@@ -15,6 +17,7 @@ import (
 func init() {
 	// ensure that logger is initialized before connecting to DB
 	defer db.Init()
+	defer storage.Init()
 	// init logger
 	log.SetFormatter(&log.TextFormatter{})
 	log.SetReportCaller(true)
@@ -30,13 +33,30 @@ func init() {
 var port = os.Getenv("PORT")
 
 // main creates a gRPC server for all requests related to properties
+// NOTE: `property reindex` rebuilds the full-text index of the existing properties instead,
+// `property migrate-users` links the properties and reviews of earlier versions to user accounts
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		os.Exit(runReindex())
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-users" {
+		os.Exit(runMigrateUsers())
+	}
+
 	log.Info("Starting goBooking property gRPC server")
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
 		log.Fatalf("Failed to listen on grpc port %s: %v", port, err)
 	}
-	grpcServer := grpc.NewServer()
+	stopHoldReaper := service.StartHoldReaper()
+	defer stopHoldReaper()
+
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(handler.IdempotencyInterceptor),
+		// photos are uploaded as a whole
+		grpc.MaxRecvMsgSize(handler.MaxMessageSize),
+		grpc.MaxSendMsgSize(handler.MaxMessageSize),
+	)
 	propertyHandler := new(handler.PropertyHandler)
 	proto.RegisterPropertyExternalServer(grpcServer, propertyHandler)
 	proto.RegisterPropertyInternalServer(grpcServer, propertyHandler)
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/service"
+	log "github.com/sirupsen/logrus"
+)
+
+// runMigrateUsers links the properties and reviews of earlier versions to the accounts of the user service
+// and returns the exit code, 1 if the migration failed, 0 otherwise
+func runMigrateUsers() int {
+	count, err := service.MigrateUsers()
+	if err != nil {
+		log.Errorf("Error migrating users: %v", err)
+		return 1
+	}
+	fmt.Printf("Linked %d rows to users\n", count)
+	return 0
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	maxTags      = 20
+	maxTagLength = 40
+)
+
+// Amenity is an entry of the managed catalogue of amenities properties can offer
+type Amenity struct {
+	ID uint `gorm:"primarykey"`
+	// stable identifier used by clients, e.g. wifi
+	Code string `gorm:"notNull;size:40;uniqueIndex"`
+	// display name, e.g. Wi-Fi
+	Name string `gorm:"notNull;size:60"`
+}
+
+// Tag is a free label of properties, created on first use
+type Tag struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"notNull;size:40;uniqueIndex"`
+}
+
+// DefaultAmenities are added to the catalogue on startup if missing
+var DefaultAmenities = []Amenity{
+	{Code: "wifi", Name: "Wi-Fi"},
+	{Code: "pool", Name: "Pool"},
+	{Code: "parking", Name: "Parking"},
+	{Code: "wheelchair_access", Name: "Wheelchair access"},
+	{Code: "air_conditioning", Name: "Air conditioning"},
+	{Code: "heating", Name: "Heating"},
+	{Code: "kitchen", Name: "Kitchen"},
+	{Code: "washing_machine", Name: "Washing machine"},
+	{Code: "tv", Name: "TV"},
+	{Code: "balcony", Name: "Balcony"},
+}
+
+// FacetCount is the number of properties of a list having an amenity or tag
+type FacetCount struct {
+	// code of the amenity or name of the tag
+	Value string
+	// display name, the name of the tag for tags
+	Name  string
+	Count int64
+}
+
+// Facets count the amenities and tags of the properties matching a filter
+type Facets struct {
+	Amenities []FacetCount
+	Tags      []FacetCount
+}
+
+// NewAmenity returns a validated amenity of the catalogue
+func NewAmenity(code string, name string) (*Amenity, error) {
+	if !isAmenityCode(code) {
+		return nil, &PropertyError{Message: fmt.Sprintf("Invalid amenity code %q, expected up to 40 lower case letters, digits and underscores starting with a letter", code)}
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > 60 {
+		return nil, &PropertyError{Message: "Amenity name must contain 1 to 60 characters"}
+	}
+	return &Amenity{Code: code, Name: name}, nil
+}
+
+// SetAmenities sets the amenities with the given codes, which are resolved against the catalogue when storing the property
+func (property *Property) SetAmenities(codes []string) {
+	seen := make(map[string]bool)
+	property.Amenities = nil
+	for _, code := range codes {
+		if !seen[code] {
+			seen[code] = true
+			property.Amenities = append(property.Amenities, Amenity{Code: code})
+		}
+	}
+}
+
+// SetTags sets the given tags, which are trimmed, converted to lower case and deduplicated
+func (property *Property) SetTags(names []string) error {
+	seen := make(map[string]bool)
+	property.Tags = nil
+	for _, name := range names {
+		name = NormalizeTag(name)
+		if name == "" || len([]rune(name)) > maxTagLength {
+			return &PropertyError{Message: fmt.Sprintf("Tags must contain 1 to %d characters", maxTagLength)}
+		}
+		if !seen[name] {
+			seen[name] = true
+			property.Tags = append(property.Tags, Tag{Name: name})
+		}
+	}
+	if len(property.Tags) > maxTags {
+		return &PropertyError{Message: fmt.Sprintf("A property must not have more than %d tags", maxTags)}
+	}
+	return nil
+}
+
+// NormalizeTag returns the name tags are stored and filtered by
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// isAmenityCode checks whether the given code consists of up to 40 lower case letters, digits and underscores
+// starting with a letter
+func isAmenityCode(code string) bool {
+	if len(code) == 0 || len(code) > 40 || code[0] < 'a' || code[0] > 'z' {
+		return false
+	}
+	for _, c := range code {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
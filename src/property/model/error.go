@@ -1,6 +1,9 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type PropertyError struct {
 	Message string
@@ -9,3 +12,41 @@ type PropertyError struct {
 func (e *PropertyError) Error() string {
 	return fmt.Sprintf("%s", e.Message)
 }
+
+// CapacityError signals that the guests of a booking do not fit the property
+// NOTE: Each violation names the field of the booking request that caused it
+type CapacityError struct {
+	Violations []Violation
+}
+
+type Violation struct {
+	Field       string
+	Description string
+}
+
+func (e *CapacityError) Error() string {
+	descriptions := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		descriptions[i] = violation.Description
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// PermissionError signals that the requester is not allowed to act on behalf of the owner of a property
+type PermissionError struct {
+	Message string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%s", e.Message)
+}
+
+// VersionConflictError signals that a property was modified since the client retrieved the expected version
+type VersionConflictError struct {
+	Id              uint
+	ExpectedVersion uint
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("Property %d was modified, it no longer has version %d", e.Id, e.ExpectedVersion)
+}
@@ -0,0 +1,43 @@
+package model
+
+import "fmt"
+
+// Guests counts the people and pets coming for a stay
+type Guests struct {
+	Adults   uint32
+	Children uint32
+	Pets     uint32
+}
+
+// adultsPerBedroom is the number of adults a bedroom sleeps
+const adultsPerBedroom = 2
+
+// CheckGuests checks whether the given guests fit the capacity and bedrooms of the property and its pets policy
+func (property *Property) CheckGuests(guests Guests) error {
+	var violations []Violation
+	if property.MaxGuests > 0 && guests.Adults+guests.Children > property.MaxGuests {
+		violations = append(violations, Violation{
+			Field: "guests",
+			Description: fmt.Sprintf("%d adults and %d children exceed the capacity of property %s (ID: %d) of %d guests",
+				guests.Adults, guests.Children, property.Name, property.ID, property.MaxGuests),
+		})
+	}
+	if property.Bedrooms > 0 && guests.Adults > property.Bedrooms*adultsPerBedroom {
+		violations = append(violations, Violation{
+			Field: "adults",
+			Description: fmt.Sprintf("%d adults exceed the %d bedrooms of property %s (ID: %d) sleeping %d adults each",
+				guests.Adults, property.Bedrooms, property.Name, property.ID, adultsPerBedroom),
+		})
+	}
+	if property.NoPets && guests.Pets > 0 {
+		violations = append(violations, Violation{
+			Field:       "pets",
+			Description: fmt.Sprintf("Property %s (ID: %d) does not allow pets", property.Name, property.ID),
+		})
+	}
+
+	if len(violations) > 0 {
+		return &CapacityError{Violations: violations}
+	}
+	return nil
+}
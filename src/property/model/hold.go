@@ -0,0 +1,25 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Hold temporarily blocks a property for a stay until it expires or a booking presents its token
+type Hold struct {
+	gorm.Model
+	Token      string    `gorm:"notNull;size:32;uniqueIndex"`
+	PropertyId uint      `gorm:"notNull;index"`
+	CheckIn    time.Time `gorm:"notNull"`
+	CheckOut   time.Time `gorm:"notNull"`
+	ExpiresAt  time.Time `gorm:"notNull;index"`
+}
+
+func (hold *Hold) IsExpiredAt(t time.Time) bool {
+	return !hold.ExpiresAt.After(t)
+}
+
+// Covers checks whether the hold blocks at least the range from checkIn to checkOut
+func (hold *Hold) Covers(checkIn time.Time, checkOut time.Time) bool {
+	return !hold.CheckIn.After(checkIn) && !hold.CheckOut.Before(checkOut)
+}
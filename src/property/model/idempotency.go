@@ -0,0 +1,37 @@
+package model
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// IdempotencyRecord stores the response of a request under the Idempotency-Key sent by the client,
+// so that retries of the request return the original response instead of repeating it
+// NOTE: Records without response belong to requests that are still in progress
+type IdempotencyRecord struct {
+	gorm.Model
+	IdempotencyKey string    `gorm:"notNull;size:255;uniqueIndex:idx_idempotency_key_method"`
+	Method         string    `gorm:"notNull;size:255;uniqueIndex:idx_idempotency_key_method"`
+	RequestHash    string    `gorm:"notNull;size:64"`
+	Response       []byte    `gorm:"type:mediumblob"`
+	ExpiresAt      time.Time `gorm:"notNull;index"`
+}
+
+func (record *IdempotencyRecord) IsCompleted() bool {
+	return record.Response != nil
+}
+
+// IdempotencyError signals that an Idempotency-Key cannot be used for a request
+type IdempotencyError struct {
+	Key string
+	// set if the first request with the key has not finished yet, otherwise the key belongs to a different request
+	InProgress bool
+}
+
+func (e *IdempotencyError) Error() string {
+	if e.InProgress {
+		return fmt.Sprintf("A request with Idempotency-Key %s is still in progress", e.Key)
+	}
+	return fmt.Sprintf("Idempotency-Key %s was already used for a different request", e.Key)
+}
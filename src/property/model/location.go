@@ -0,0 +1,101 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// earthRadiusKm is the mean radius of the earth
+const earthRadiusKm = 6371.0088
+
+// PostalAddress is the structured address of a property, the free-text Address is kept for display
+type PostalAddress struct {
+	Street     string `gorm:"notNull;size:100;default:''"`
+	PostalCode string `gorm:"notNull;size:20;default:''"`
+	City       string `gorm:"notNull;size:60;default:''"`
+	// ISO 3166-1 alpha-2 code, e.g. US
+	Country string `gorm:"notNull;size:2;default:''"`
+}
+
+// NearbyProperty is a property within the radius of a radius search
+type NearbyProperty struct {
+	Property   Property
+	DistanceKm float64
+}
+
+// SetPostalAddress sets the given address, its country code is converted to upper case
+func (property *Property) SetPostalAddress(address PostalAddress) error {
+	address.Country = strings.ToUpper(address.Country)
+	if address.Country != "" && !isCountryCode(address.Country) {
+		return &PropertyError{Message: fmt.Sprintf("Unknown country %s, expected an ISO 3166-1 alpha-2 code like US", address.Country)}
+	}
+	property.PostalAddress = address
+	return nil
+}
+
+// SetLocation sets the given coordinates in degrees
+func (property *Property) SetLocation(latitude float64, longitude float64) error {
+	if err := ValidateCoordinates(latitude, longitude); err != nil {
+		return err
+	}
+	property.Latitude = &latitude
+	property.Longitude = &longitude
+	return nil
+}
+
+// HasLocation checks whether the coordinates of the property are known
+func (property *Property) HasLocation() bool {
+	return property.Latitude != nil && property.Longitude != nil
+}
+
+// ValidateCoordinates checks that the given latitude and longitude in degrees are on the earth
+func ValidateCoordinates(latitude float64, longitude float64) error {
+	if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return &PropertyError{Message: "Latitude must be between -90 and 90 degrees"}
+	}
+	if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return &PropertyError{Message: "Longitude must be between -180 and 180 degrees"}
+	}
+	return nil
+}
+
+// DistanceKm returns the great-circle distance between the given coordinates in degrees using the haversine formula
+func DistanceKm(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	phi1, phi2 := latitude1*math.Pi/180, latitude2*math.Pi/180
+	deltaPhi := (latitude2 - latitude1) * math.Pi / 180
+	deltaLambda := (longitude2 - longitude1) * math.Pi / 180
+
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BoundingBox returns the latitude and longitude ranges in degrees containing all points within the given radius
+// of the given coordinates
+// NOTE: The longitude range exceeds -180 or 180 if the box crosses the antimeridian,
+// it covers all longitudes if the box contains a pole.
+func BoundingBox(latitude float64, longitude float64, radiusKm float64) (minLatitude float64, maxLatitude float64, minLongitude float64, maxLongitude float64) {
+	deltaLatitude := radiusKm / earthRadiusKm * 180 / math.Pi
+	minLatitude, maxLatitude = latitude-deltaLatitude, latitude+deltaLatitude
+	if minLatitude <= -90 || maxLatitude >= 90 {
+		return math.Max(minLatitude, -90), math.Min(maxLatitude, 90), -180, 180
+	}
+
+	// the widest part of the circle lies closer to the pole than its center
+	deltaLongitude := math.Asin(math.Min(1, math.Sin(radiusKm/earthRadiusKm)/math.Cos(latitude*math.Pi/180))) * 180 / math.Pi
+	return minLatitude, maxLatitude, longitude - deltaLongitude, longitude + deltaLongitude
+}
+
+// isCountryCode checks whether the given code consists of two upper case letters
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// PageRequest selects a page of a list in the given order
+// NOTE: PageToken is empty for the first page and the token returned with the previous page otherwise,
+// OrderBy lists fields separated by commas, each optionally followed by "desc", e.g. "created_at desc,name"
+type PageRequest struct {
+	PageSize  uint32
+	PageToken string
+	OrderBy   string
+}
+
+// PropertyFilter restricts a list of properties, zero values do not restrict it
+// NOTE: CreatedAfter is inclusive, CreatedBefore is exclusive
+type PropertyFilter struct {
+	OwnerId       uint
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// codes of amenities the properties must all have
+	Amenities []string
+	// tags the properties must all have
+	Tags []string
+}
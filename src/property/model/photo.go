@@ -0,0 +1,64 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxPhotoSize limits uploaded photos to 5 MiB
+	MaxPhotoSize = 5 << 20
+	// MaxPhotos limits the photos of a property
+	MaxPhotos = 30
+	// maxPhotoPixels rejects images which would take too much memory to decode
+	maxPhotoPixels = 40_000_000
+)
+
+// photoContentTypes are the accepted content types of photos
+var photoContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Photo is an image of a property whose original and thumbnail are kept in the photo store
+type Photo struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	PropertyId uint `gorm:"notNull;index"`
+	// photos are shown in ascending order, starting at 0
+	Position uint32 `gorm:"notNull;default:0"`
+	// the cover photo represents the property in lists
+	Cover        bool   `gorm:"notNull;default:false"`
+	ContentType  string `gorm:"notNull;size:20"`
+	Size         int64  `gorm:"notNull"`
+	Width        uint32 `gorm:"notNull"`
+	Height       uint32 `gorm:"notNull"`
+	StorageKey   string `gorm:"notNull;size:100"`
+	ThumbnailKey string `gorm:"notNull;size:100"`
+}
+
+// DetectPhotoContentType returns the content type of the given photo sniffed from its content,
+// photos have to be JPEG, PNG or GIF images of at most MaxPhotoSize
+func DetectPhotoContentType(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", &PropertyError{Message: "The photo is empty"}
+	}
+	if len(data) > MaxPhotoSize {
+		return "", &PropertyError{Message: fmt.Sprintf("The photo must not be larger than %d MiB", MaxPhotoSize>>20)}
+	}
+	contentType := http.DetectContentType(data)
+	if !photoContentTypes[contentType] {
+		return "", &PropertyError{Message: fmt.Sprintf("Unsupported content type %s, expected image/jpeg, image/png or image/gif", contentType)}
+	}
+	return contentType, nil
+}
+
+// ValidatePhotoDimensions checks that the decoded photo will fit in memory
+func ValidatePhotoDimensions(width int, height int) error {
+	if width <= 0 || height <= 0 || width*height > maxPhotoPixels {
+		return &PropertyError{Message: fmt.Sprintf("The photo must have between 1 and %d pixels", maxPhotoPixels)}
+	}
+	return nil
+}
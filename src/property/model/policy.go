@@ -0,0 +1,79 @@
+package model
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+)
+
+// CancellationPolicy decides how much of the price is refunded if a booking is cancelled
+type CancellationPolicy string
+
+const (
+	FLEXIBLE CancellationPolicy = "FLEXIBLE"
+	MODERATE CancellationPolicy = "MODERATE"
+	STRICT   CancellationPolicy = "STRICT"
+	CUSTOM   CancellationPolicy = "CUSTOM"
+)
+
+// RefundTier refunds RefundPercent of the price if a booking is cancelled at least DaysBefore days before check-in
+type RefundTier struct {
+	gorm.Model
+	PropertyId    uint   `gorm:"notNull;index"`
+	DaysBefore    uint32 `gorm:"notNull"`
+	RefundPercent uint32 `gorm:"notNull"`
+}
+
+// predefinedTiers lists the tiers of the policies that cannot be customized
+var predefinedTiers = map[CancellationPolicy][]RefundTier{
+	FLEXIBLE: {{DaysBefore: 1, RefundPercent: 100}},
+	MODERATE: {{DaysBefore: 5, RefundPercent: 100}, {DaysBefore: 0, RefundPercent: 50}},
+	STRICT:   {{DaysBefore: 14, RefundPercent: 100}, {DaysBefore: 7, RefundPercent: 50}},
+}
+
+// SetCancellationPolicy sets the given policy, an empty policy defaults to FLEXIBLE
+// NOTE: Tiers are only allowed for CUSTOM policies, which need at least one
+func (property *Property) SetCancellationPolicy(policy string, tiers []RefundTier) error {
+	switch CancellationPolicy(policy) {
+	case "", FLEXIBLE, MODERATE, STRICT:
+		if len(tiers) > 0 {
+			return &PropertyError{Message: "Refund tiers can only be set for CUSTOM cancellation policies"}
+		}
+		property.CancellationPolicy = CancellationPolicy(policy)
+		if policy == "" {
+			property.CancellationPolicy = FLEXIBLE
+		}
+	case CUSTOM:
+		if len(tiers) == 0 {
+			return &PropertyError{Message: "CUSTOM cancellation policies need at least one refund tier"}
+		}
+		seen := make(map[uint32]bool)
+		for _, tier := range tiers {
+			if tier.RefundPercent > 100 {
+				return &PropertyError{Message: fmt.Sprintf("Refund of %d%% exceeds 100%%", tier.RefundPercent)}
+			}
+			if seen[tier.DaysBefore] {
+				return &PropertyError{Message: fmt.Sprintf("More than one refund tier for %d days before check-in", tier.DaysBefore)}
+			}
+			seen[tier.DaysBefore] = true
+		}
+		property.CancellationPolicy = CUSTOM
+	default:
+		return &PropertyError{Message: fmt.Sprintf("Unknown cancellation policy %s, expected FLEXIBLE, MODERATE, STRICT or CUSTOM", policy)}
+	}
+	property.RefundTiers = tiers
+	return nil
+}
+
+// EffectiveRefundTiers returns the tiers of the cancellation policy ordered from the earliest cancellation to the latest
+func (property *Property) EffectiveRefundTiers() []RefundTier {
+	// the tiers are copied, as sorting the shared predefined tiers in place would race with concurrent requests
+	tiers := append([]RefundTier(nil), predefinedTiers[property.CancellationPolicy]...)
+	if property.CancellationPolicy == CUSTOM {
+		tiers = append([]RefundTier(nil), property.RefundTiers...)
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].DaysBefore > tiers[j].DaysBefore
+	})
+	return tiers
+}
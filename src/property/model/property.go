@@ -1,6 +1,10 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
 
 type Status string
 
@@ -9,24 +13,104 @@ const (
 	BOOKED Status = "BOOKED"
 )
 
+// BookingMode decides whether bookings are reserved instantly or require the approval of the owner
+type BookingMode string
+
+const (
+	INSTANT BookingMode = "INSTANT"
+	REQUEST BookingMode = "REQUEST"
+)
+
 type Property struct {
 	gorm.Model
 	Name        string `gorm:"notNull;size:60"`
 	Description string `gorm:"notNull;size:100"`
-	OwnerName   string `gorm:"notNull;size:60"`
-	Address     string `gorm:"notNull;size:100"`
-	BookingId   uint
-	Status      `gorm:"notNull;type:ENUM('FREE', 'BOOKED')"`
+	// account of the owner in the user service, 0 until properties of earlier versions are migrated
+	OwnerId uint `gorm:"notNull;default:0;index"`
+	// name of the account of the owner
+	OwnerName string `gorm:"notNull;size:60"`
+	Address   string `gorm:"notNull;size:100"`
+	// prefixed columns like address_city
+	PostalAddress PostalAddress `gorm:"embedded;embeddedPrefix:address_"`
+	// in degrees, nil if unknown, such properties are never found by radius searches
+	Latitude     *float64 `gorm:"index:idx_property_location"`
+	Longitude    *float64 `gorm:"index:idx_property_location"`
+	BookingMode  `gorm:"notNull;type:ENUM('INSTANT', 'REQUEST');default:INSTANT"`
+	Reservations []Reservation
+	// amounts in minor units of the currency, e.g. cents
+	NightlyRate int64  `gorm:"notNull;default:0"`
+	CleaningFee int64  `gorm:"notNull;default:0"`
+	Currency    string `gorm:"notNull;size:3;default:EUR"`
+	// tax rate in basis points, e.g. 1900 for 19%
+	TaxRate uint32 `gorm:"notNull;default:0"`
+	// maximum number of adults and children, 0 means unlimited
+	MaxGuests uint32 `gorm:"notNull;default:0"`
+	// each bedroom sleeps 2 adults, 0 means unlimited
+	Bedrooms uint32 `gorm:"notNull;default:0"`
+	NoPets   bool   `gorm:"notNull;default:false"`
+	// refund tiers are only stored for CUSTOM policies
+	CancellationPolicy `gorm:"notNull;type:ENUM('FLEXIBLE', 'MODERATE', 'STRICT', 'CUSTOM');default:FLEXIBLE"`
+	RefundTiers        []RefundTier
+	Amenities          []Amenity `gorm:"many2many:property_amenities"`
+	Tags               []Tag     `gorm:"many2many:property_tags"`
+	Photos             []Photo
+	// maintained with every review, so that lists need not aggregate the reviews
+	ReviewCount uint32 `gorm:"notNull;default:0"`
+	RatingTotal uint32 `gorm:"notNull;default:0"`
+	// incremented by every update, exposed as ETag
+	Version uint `gorm:"notNull;default:1"`
+}
+
+// SetBookingMode sets the given booking mode, an empty mode defaults to INSTANT
+func (property *Property) SetBookingMode(mode string) error {
+	switch BookingMode(mode) {
+	case "", INSTANT:
+		property.BookingMode = INSTANT
+	case REQUEST:
+		property.BookingMode = REQUEST
+	default:
+		return &PropertyError{Message: fmt.Sprintf("Unknown booking mode %s, expected INSTANT or REQUEST", mode)}
+	}
+	return nil
+}
+
+// SetPricing sets the given prices, an empty currency defaults to EUR
+func (property *Property) SetPricing(nightlyRate int64, cleaningFee int64, currency string, taxRate uint32) error {
+	if nightlyRate < 0 || cleaningFee < 0 {
+		return &PropertyError{Message: "Nightly rate and cleaning fee must not be negative"}
+	}
+	if currency == "" {
+		currency = "EUR"
+	}
+	if !isCurrencyCode(currency) {
+		return &PropertyError{Message: fmt.Sprintf("Unknown currency %s, expected an ISO 4217 code like EUR", currency)}
+	}
+	if taxRate > 10000 {
+		return &PropertyError{Message: "Tax rate must be given in basis points between 0 and 10000"}
+	}
+
+	property.NightlyRate = nightlyRate
+	property.CleaningFee = cleaningFee
+	property.Currency = currency
+	property.TaxRate = taxRate
+	return nil
 }
 
-func (property *Property) SetStatusFree() {
-	property.Status = FREE
+func (property *Property) RequiresApproval() bool {
+	return property.BookingMode == REQUEST
 }
 
-func (property *Property) SetStatusBooked() {
-	property.Status = BOOKED
+// IsOwnedBy checks whether the given account owns the property, never for properties that are not migrated yet
+func (property *Property) IsOwnedBy(userId uint) bool {
+	return userId != 0 && property.OwnerId == userId
 }
 
-func (property *Property) IsStatusBooked() bool {
-	return property.Status == BOOKED
+// StatusAt returns BOOKED if one of the loaded reservations covers the given point in time
+func (property *Property) StatusAt(t time.Time) Status {
+	for _, reservation := range property.Reservations {
+		if reservation.Overlaps(t, t.Add(time.Nanosecond)) {
+			return BOOKED
+		}
+	}
+	return FREE
 }
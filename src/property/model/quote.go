@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+)
+
+// Quote is the price of a stay at a property, all amounts are in minor units of the currency
+type Quote struct {
+	Nights      int64
+	NightlyRate int64
+	CleaningFee int64
+	// nights × nightly rate plus cleaning fee
+	Subtotal int64
+	Tax      int64
+	Total    int64
+	Currency string
+}
+
+// QuoteStay computes the price of the stay from checkIn to checkOut with the current prices of the property
+// NOTE: Taxes are rounded half up to whole minor units
+func (property *Property) QuoteStay(checkIn time.Time, checkOut time.Time) (*Quote, error) {
+	checkIn, checkOut = TruncateToDay(checkIn), TruncateToDay(checkOut)
+	if !checkOut.After(checkIn) {
+		return nil, &PropertyError{Message: "Check-out must be at least one day after check-in"}
+	}
+
+	nights := int64(checkOut.Sub(checkIn).Hours() / 24)
+	subtotal := nights*property.NightlyRate + property.CleaningFee
+	tax := (subtotal*int64(property.TaxRate) + 5000) / 10000
+	return &Quote{
+		Nights:      nights,
+		NightlyRate: property.NightlyRate,
+		CleaningFee: property.CleaningFee,
+		Subtotal:    subtotal,
+		Tax:         tax,
+		Total:       subtotal + tax,
+		Currency:    property.Currency,
+	}, nil
+}
+
+// isCurrencyCode checks whether the given code consists of three upper case letters
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
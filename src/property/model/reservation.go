@@ -0,0 +1,40 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type ReservationStatus string
+
+const (
+	CONFIRMED        ReservationStatus = "CONFIRMED"
+	PENDING_APPROVAL ReservationStatus = "PENDING_APPROVAL"
+)
+
+// Reservation blocks a property from CheckIn (inclusive) to CheckOut (exclusive) for a booking
+// NOTE: CheckOut is exclusive, so a new stay may start on the day another one ends.
+// Reservations pending approval of the owner block the property as well.
+type Reservation struct {
+	gorm.Model
+	PropertyId        uint      `gorm:"notNull;index"`
+	BookingId         uint      `gorm:"notNull;index"`
+	CheckIn           time.Time `gorm:"notNull"`
+	CheckOut          time.Time `gorm:"notNull"`
+	ReservationStatus `gorm:"notNull;type:ENUM('CONFIRMED', 'PENDING_APPROVAL');default:CONFIRMED"`
+}
+
+func (reservation *Reservation) IsPendingApproval() bool {
+	return reservation.ReservationStatus == PENDING_APPROVAL
+}
+
+// Overlaps checks whether the reservation intersects the range from checkIn to checkOut
+func (reservation *Reservation) Overlaps(checkIn time.Time, checkOut time.Time) bool {
+	return reservation.CheckIn.Before(checkOut) && checkIn.Before(reservation.CheckOut)
+}
+
+// TruncateToDay returns midnight UTC of the day the given time falls on
+func TruncateToDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const maxReviewLength = 2000
+
+// Review is the rating of a property by a customer after a completed stay
+// NOTE: Every customer can review a property once, its owner can reply once.
+type Review struct {
+	gorm.Model
+	PropertyId uint `gorm:"notNull;uniqueIndex:idx_review_property_customer"`
+	// account of the customer in the user service, 0 until reviews of earlier versions are migrated
+	CustomerId uint `gorm:"notNull;default:0;index"`
+	// name of the account of the customer, unique per property as well since account names are unique
+	CustomerName string `gorm:"notNull;size:60;uniqueIndex:idx_review_property_customer"`
+	// the completed booking proving the stay
+	BookingId uint `gorm:"notNull;index"`
+	// stars from 1 to 5
+	Rating    uint32 `gorm:"notNull"`
+	Text      string `gorm:"notNull;size:2000"`
+	Reply     string `gorm:"notNull;size:2000;default:''"`
+	RepliedAt *time.Time
+}
+
+// NewReview returns a validated review of the given property
+func NewReview(propertyId uint, bookingId uint, customerId uint, rating uint32, text string) (*Review, error) {
+	if bookingId == 0 || customerId == 0 {
+		return nil, &PropertyError{Message: "A review requires the booking and the id of the customer"}
+	}
+	if rating < 1 || rating > 5 {
+		return nil, &PropertyError{Message: "Rating must be between 1 and 5 stars"}
+	}
+	text = strings.TrimSpace(text)
+	if len([]rune(text)) > maxReviewLength {
+		return nil, &PropertyError{Message: fmt.Sprintf("Review must not be longer than %d characters", maxReviewLength)}
+	}
+	return &Review{PropertyId: propertyId, BookingId: bookingId, CustomerId: customerId, Rating: rating, Text: text}, nil
+}
+
+// ValidateReply checks the reply of an owner to a review
+func ValidateReply(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || len([]rune(text)) > maxReviewLength {
+		return "", &PropertyError{Message: fmt.Sprintf("Reply must contain 1 to %d characters", maxReviewLength)}
+	}
+	return text, nil
+}
+
+func (review *Review) HasReply() bool {
+	return review.RepliedAt != nil
+}
+
+// AverageRating returns the mean rating of the reviews of the property, 0 if there are none
+func (property *Property) AverageRating() float64 {
+	if property.ReviewCount == 0 {
+		return 0
+	}
+	return float64(property.RatingTotal) / float64(property.ReviewCount)
+}
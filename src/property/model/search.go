@@ -0,0 +1,61 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchField is a text field of a property covered by the full-text search
+type SearchField string
+
+const (
+	NAME        SearchField = "NAME"
+	DESCRIPTION SearchField = "DESCRIPTION"
+	ADDRESS     SearchField = "ADDRESS"
+)
+
+// SearchTerm is an entry of the full-text index, one per distinct term of a field of a property
+type SearchTerm struct {
+	ID         uint        `gorm:"primarykey"`
+	PropertyId uint        `gorm:"notNull;index"`
+	Field      SearchField `gorm:"notNull;type:ENUM('NAME', 'DESCRIPTION', 'ADDRESS')"`
+	Term       string      `gorm:"notNull;size:100;index"`
+	// number of occurrences of the term in the field
+	Occurrences uint32 `gorm:"notNull;default:1"`
+}
+
+// SearchFields are the fields covered by the full-text search in the order of their snippets
+var SearchFields = []SearchField{NAME, DESCRIPTION, ADDRESS}
+
+// SearchText returns the text of the given field of the property
+func (property *Property) SearchText(field SearchField) string {
+	switch field {
+	case NAME:
+		return property.Name
+	case DESCRIPTION:
+		return property.Description
+	case ADDRESS:
+		return property.Address
+	}
+	return ""
+}
+
+// SearchResult is a property matching a full-text query
+type SearchResult struct {
+	Property Property
+	Score    float64
+	Snippets []Snippet
+}
+
+// Snippet is the text of a matching field with the matching words highlighted
+type Snippet struct {
+	Field SearchField
+	Text  string
+}
+
+// Tokenize splits the given text into lowercase words of letters and digits
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
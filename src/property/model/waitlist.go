@@ -0,0 +1,32 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type WaitlistStatus string
+
+const (
+	WAITING WaitlistStatus = "WAITING"
+	OFFERED WaitlistStatus = "OFFERED"
+)
+
+// WaitlistEntry queues a customer for a stay at a property that is already booked
+// NOTE: Once the property is freed, the first waiting customer whose stay fits is offered a hold.
+// The entry is removed when the customer books with the token of the hold or the offer expires.
+type WaitlistEntry struct {
+	gorm.Model
+	PropertyId     uint      `gorm:"notNull;index"`
+	CustomerName   string    `gorm:"notNull;size:60"`
+	CheckIn        time.Time `gorm:"notNull"`
+	CheckOut       time.Time `gorm:"notNull"`
+	WaitlistStatus `gorm:"notNull;type:ENUM('WAITING', 'OFFERED');default:WAITING"`
+	// token of the hold offered to the customer
+	HoldToken      string `gorm:"size:32;index"`
+	OfferExpiresAt *time.Time
+}
+
+func (entry *WaitlistEntry) IsOffered() bool {
+	return entry.WaitlistStatus == OFFERED
+}
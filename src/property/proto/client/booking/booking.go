@@ -0,0 +1,26 @@
+package client
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"os"
+)
+
+var (
+	bookingTarget = os.Getenv("BOOKING_CONNECT")
+)
+
+func GetBookingConnection(ctx context.Context) (*grpc.ClientConn, error) {
+	var err error
+	log.WithFields(log.Fields{
+		"target": bookingTarget,
+	}).Infoln("Connecting to booking service")
+	var conn *grpc.ClientConn
+	conn, err = grpc.DialContext(ctx, bookingTarget, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		return nil, err
+	}
+	return conn, err
+}
@@ -0,0 +1,26 @@
+package client
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"os"
+)
+
+var (
+	userTarget = os.Getenv("USER_CONNECT")
+)
+
+func GetUserConnection(ctx context.Context) (*grpc.ClientConn, error) {
+	var err error
+	log.WithFields(log.Fields{
+		"target": userTarget,
+	}).Infoln("Connecting to user service")
+	var conn *grpc.ClientConn
+	conn, err = grpc.DialContext(ctx, userTarget, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		return nil, err
+	}
+	return conn, err
+}
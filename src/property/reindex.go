@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/service"
+	log "github.com/sirupsen/logrus"
+)
+
+// runReindex rebuilds the full-text index of the existing properties and returns the exit code,
+// 1 if the rebuild failed, 0 otherwise
+func runReindex() int {
+	count, err := service.RebuildSearchIndex()
+	if err != nil {
+		log.Errorf("Error rebuilding search index: %v", err)
+		return 1
+	}
+	fmt.Printf("Indexed %d properties\n", count)
+	return 0
+}
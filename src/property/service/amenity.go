@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// maxTagFacets limits the tags counted for a list of properties to the most frequent ones
+const maxTagFacets = 50
+
+// GetAmenities retrieves the catalogue of amenities ordered by name
+func GetAmenities() ([]model.Amenity, error) {
+	var amenities []model.Amenity
+	result := db.DB.Order("name").Find(&amenities)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	log.Tracef("Retrieved: %v", amenities)
+	return amenities, nil
+}
+
+// CreateAmenity adds the given amenity to the catalogue
+func CreateAmenity(amenity *model.Amenity) error {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("code = ?", amenity.Code).First(new(model.Amenity))
+		if result.Error == nil {
+			return &model.PropertyError{Message: fmt.Sprintf("Amenity %s already exists", amenity.Code)}
+		}
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+		return tx.Create(amenity).Error
+	})
+	if err != nil {
+		return err
+	}
+	entry := log.WithField("ID", amenity.ID)
+	entry.Info("Successfully stored new amenity in database.")
+	entry.Tracef("Stored: %v", amenity)
+	return nil
+}
+
+// GetPropertyFacets counts the amenities and tags of the properties matching the given filter
+// NOTE: All amenities of the catalogue are counted, so that they can be offered as filters,
+// but only the most frequent tags.
+func GetPropertyFacets(filter model.PropertyFilter) (*model.Facets, error) {
+	facets := new(model.Facets)
+	ids := filterProperties(filter).Select("id")
+	result := db.DB.Table("amenities").
+		Select("amenities.code AS value, amenities.name AS name, COUNT(property_amenities.property_id) AS count").
+		Joins("LEFT JOIN property_amenities ON property_amenities.amenity_id = amenities.id AND property_amenities.property_id IN (?)", ids).
+		Group("amenities.id, amenities.code, amenities.name").
+		Order("amenities.name").
+		Scan(&facets.Amenities)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	ids = filterProperties(filter).Select("id")
+	result = db.DB.Table("tags").
+		Select("tags.name AS value, tags.name AS name, COUNT(*) AS count").
+		Joins("JOIN property_tags ON property_tags.tag_id = tags.id").
+		Where("property_tags.property_id IN (?)", ids).
+		Group("tags.id, tags.name").
+		Order("count DESC, tags.name").
+		Limit(maxTagFacets).
+		Scan(&facets.Tags)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	log.Tracef("Retrieved: %v", facets)
+	return facets, nil
+}
+
+// resolveAmenities retrieves the amenities of the catalogue matching the codes of the given amenities
+func resolveAmenities(tx *gorm.DB, amenities []model.Amenity) ([]model.Amenity, error) {
+	if len(amenities) == 0 {
+		return nil, nil
+	}
+	codes := make([]string, len(amenities))
+	for i, amenity := range amenities {
+		codes[i] = amenity.Code
+	}
+
+	var resolved []model.Amenity
+	if err := tx.Where("code IN ?", codes).Find(&resolved).Error; err != nil {
+		return nil, err
+	}
+	if len(resolved) < len(codes) {
+		known := make(map[string]bool, len(resolved))
+		for _, amenity := range resolved {
+			known[amenity.Code] = true
+		}
+		var unknown []string
+		for _, code := range codes {
+			if !known[code] {
+				unknown = append(unknown, code)
+			}
+		}
+		return nil, &model.PropertyError{Message: fmt.Sprintf("Unknown amenities %s, see the catalogue of amenities", strings.Join(unknown, ", "))}
+	}
+	return resolved, nil
+}
+
+// resolveTags retrieves the tags matching the names of the given tags, missing ones are created
+func resolveTags(tx *gorm.DB, tags []model.Tag) ([]model.Tag, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	names := make([]string, len(tags))
+	missing := make([]model.Tag, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+		missing[i] = model.Tag{Name: tag.Name}
+	}
+
+	// tags created concurrently by other properties are kept
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+		return nil, err
+	}
+	var resolved []model.Tag
+	if err := tx.Where("name IN ?", names).Find(&resolved).Error; err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
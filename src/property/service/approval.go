@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto/client/booking"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ApproveReservation confirms the reservation that the given property tentatively holds for the given booking
+// NOTE: The booking service has to accept the approval first, so both services stay consistent if it fails
+func ApproveReservation(existingProperty *model.Property, bookingId uint, ownerId uint) error {
+	reservation, err := getPendingReservation(existingProperty, bookingId, ownerId)
+	if err != nil {
+		return err
+	}
+
+	err = decideBooking(&proto.BookingDecisionReq{BookingId: uint32(bookingId), Actor: existingProperty.OwnerName}, true)
+	if err != nil {
+		return err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(reservation).Update("reservation_status", model.CONFIRMED).Error; err != nil {
+			return err
+		}
+		return touchProperty(tx, existingProperty.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	entry := log.WithField("ID", existingProperty.ID)
+	entry.Infof("Successfully approved booking %d.", bookingId)
+	return nil
+}
+
+// DeclineReservation releases the reservation that the given property tentatively holds for the given booking
+// NOTE: The reservation is deleted before the booking service is asked to decline the booking.
+// If the booking service fails, the reservation is restored, so that the owner can retry the decline.
+func DeclineReservation(existingProperty *model.Property, bookingId uint, ownerId uint, reason string) error {
+	reservation, err := getPendingReservation(existingProperty, bookingId, ownerId)
+	if err != nil {
+		return err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, existingProperty.ID); err != nil {
+			return err
+		}
+		result := tx.Where("reservation_status = ?", model.PENDING_APPROVAL).Delete(reservation)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			message := fmt.Sprintf("Booking %d of property %s (ID: %d) is not awaiting approval", bookingId, existingProperty.Name, existingProperty.ID)
+			return &model.PropertyError{Message: message}
+		}
+		return touchProperty(tx, existingProperty.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = decideBooking(&proto.BookingDecisionReq{BookingId: uint32(bookingId), Actor: existingProperty.OwnerName, Reason: reason}, false)
+	if err != nil {
+		if restoreErr := restoreReservation(reservation); restoreErr != nil {
+			log.Errorf("Error restoring reservation of booking %d at property %d: %v", bookingId, existingProperty.ID, restoreErr)
+			return errors.Join(err, restoreErr)
+		}
+		return err
+	}
+
+	entry := log.WithField("ID", existingProperty.ID)
+	entry.Infof("Successfully declined booking %d.", bookingId)
+
+	offerToWaitlist(existingProperty.ID)
+	return nil
+}
+
+// restoreReservation undoes the deletion of the given reservation after the booking service failed to decline its booking
+// NOTE: If the range has been reserved in the meantime, the reservation cannot be restored.
+// The booking is then left without reservation, which is reported by the reconciliation of the booking service.
+func restoreReservation(reservation *model.Reservation) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, reservation.PropertyId); err != nil {
+			return err
+		}
+		conflicts, err := countConflicts(tx, reservation.PropertyId, reservation.CheckIn, reservation.CheckOut, "")
+		if err != nil {
+			return err
+		}
+		if conflicts > 0 {
+			return &model.PropertyError{Message: fmt.Sprintf("The stay of booking %d has been reserved by another booking in the meantime", reservation.BookingId)}
+		}
+		if err := tx.Unscoped().Model(reservation).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return touchProperty(tx, reservation.PropertyId)
+	})
+}
+
+// getPendingReservation retrieves the reservation of the given property for the given booking
+// if it is still awaiting approval and the given owner is allowed to decide about it
+func getPendingReservation(existingProperty *model.Property, bookingId uint, ownerId uint) (*model.Reservation, error) {
+	if !existingProperty.IsOwnedBy(ownerId) {
+		message := fmt.Sprintf("Only the owner of property %s (ID: %d) can decide about its bookings", existingProperty.Name, existingProperty.ID)
+		return nil, &model.PermissionError{Message: message}
+	}
+
+	for _, reservation := range existingProperty.Reservations {
+		if reservation.BookingId != bookingId {
+			continue
+		}
+		if !reservation.IsPendingApproval() {
+			message := fmt.Sprintf("Booking %d of property %s (ID: %d) is not awaiting approval", bookingId, existingProperty.Name, existingProperty.ID)
+			return nil, &model.PropertyError{Message: message}
+		}
+		return &reservation, nil
+	}
+
+	message := fmt.Sprintf("Whoops! It seems as if the property %s (ID: %d) has no reservation for booking %d.",
+		existingProperty.Name, existingProperty.ID, bookingId)
+	return nil, &model.PropertyError{Message: message}
+}
+
+// decideBooking connects to the booking service via gRPC and approves or declines the given booking
+func decideBooking(req *proto.BookingDecisionReq, approve bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	conn, err := client.GetBookingConnection(ctx)
+	if err != nil {
+		log.Errorf("Error connecting to booking service: %v", err)
+		return err
+	}
+
+	defer func(conn *grpc.ClientConn) {
+		err := conn.Close()
+		if err != nil {
+			log.Errorf("Error closing connection: %s", err)
+		}
+	}(conn)
+
+	bookingClient := proto.NewBookingInternalClient(conn)
+	if approve {
+		_, err = bookingClient.ApproveBooking(ctx, req)
+	} else {
+		_, err = bookingClient.DeclineBooking(ctx, req)
+	}
+	if err != nil {
+		log.Errorf("Error calling booking service: %v", err)
+		return err
+	}
+
+	return nil
+}
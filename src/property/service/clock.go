@@ -0,0 +1,25 @@
+package service
+
+import "time"
+
+// Clock provides the current time, so that tests can control when holds expire
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+var clock Clock = systemClock{}
+
+// SetClock replaces the clock of the service and returns a function that restores the previous one
+func SetClock(c Clock) func() {
+	previous := clock
+	clock = c
+	return func() {
+		clock = previous
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"os"
+	"time"
+)
+
+var (
+	defaultHoldTTL     = getDurationEnv("HOLD_TTL", 15*time.Minute)
+	maxHoldTTL         = getDurationEnv("HOLD_MAX_TTL", time.Hour)
+	holdReaperInterval = getDurationEnv("HOLD_REAPER_INTERVAL", time.Minute)
+)
+
+// HoldProperty blocks the given property from checkIn to checkOut for the given ttl
+// and returns a hold whose token can be used to book the held range
+// NOTE: A ttl of 0 uses the default ttl
+func HoldProperty(existingProperty *model.Property, checkIn time.Time, checkOut time.Time, ttl time.Duration) (*model.Hold, error) {
+	checkIn, checkOut = model.TruncateToDay(checkIn), model.TruncateToDay(checkOut)
+	if !checkOut.After(checkIn) {
+		return nil, &model.PropertyError{Message: "Check-out must be at least one day after check-in"}
+	}
+	if ttl == 0 {
+		ttl = defaultHoldTTL
+	}
+	if ttl < 0 || ttl > maxHoldTTL {
+		return nil, &model.PropertyError{Message: fmt.Sprintf("Holds must expire within %s", maxHoldTTL)}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	hold := model.Hold{
+		Token:      token,
+		PropertyId: existingProperty.ID,
+		CheckIn:    checkIn,
+		CheckOut:   checkOut,
+		ExpiresAt:  clock.Now().Add(ttl),
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, existingProperty.ID); err != nil {
+			return err
+		}
+		conflicts, err := countConflicts(tx, existingProperty.ID, checkIn, checkOut, "")
+		if err != nil {
+			return err
+		}
+		if conflicts > 0 {
+			message := fmt.Sprintf("Sorry, property %s (ID: %d) is already booked between %s and %s",
+				existingProperty.Name, existingProperty.ID, checkIn.Format(time.DateOnly), checkOut.Format(time.DateOnly))
+			return &model.PropertyError{Message: message}
+		}
+		return tx.Create(&hold).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := log.WithField("ID", existingProperty.ID)
+	entry.Infof("Successfully held property until %s.", hold.ExpiresAt)
+	entry.Tracef("Held: %v", hold)
+	return &hold, nil
+}
+
+// ReleaseExpiredHolds deletes all holds that expired according to the clock of the service
+// and offers the released ranges to the waitlists of their properties
+func ReleaseExpiredHolds() (int64, error) {
+	if _, err := ExpireWaitlistOffers(); err != nil {
+		return 0, err
+	}
+
+	var expired []model.Hold
+	result := db.DB.Where("expires_at <= ?", clock.Now()).Find(&expired)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	result = db.DB.Delete(&expired)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	log.Infof("Released %d expired holds.", result.RowsAffected)
+
+	propertyIds := make(map[uint]bool)
+	for _, hold := range expired {
+		if !propertyIds[hold.PropertyId] {
+			propertyIds[hold.PropertyId] = true
+			offerToWaitlist(hold.PropertyId)
+		}
+	}
+	return result.RowsAffected, nil
+}
+
+// StartHoldReaper periodically releases expired holds in the background until the returned function is called
+func StartHoldReaper() func() {
+	ticker := time.NewTicker(holdReaperInterval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := ReleaseExpiredHolds(); err != nil {
+					log.Errorf("Error releasing expired holds: %v", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	log.Infof("Started hold reaper with interval %s", holdReaperInterval)
+	return func() {
+		close(done)
+	}
+}
+
+// getValidHold retrieves the hold with the given token
+// if it belongs to the given property, has not expired yet and covers the range from checkIn to checkOut
+func getValidHold(tx *gorm.DB, propertyId uint, token string, checkIn time.Time, checkOut time.Time) (*model.Hold, error) {
+	hold := new(model.Hold)
+	result := tx.Where("token = ? AND property_id = ?", token, propertyId).First(hold)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) || hold.IsExpiredAt(clock.Now()) || !hold.Covers(checkIn, checkOut) {
+		message := fmt.Sprintf("Hold %s is expired or does not cover the stay from %s to %s",
+			token, checkIn.Format(time.DateOnly), checkOut.Format(time.DateOnly))
+		return nil, &model.PropertyError{Message: message}
+	}
+	return hold, nil
+}
+
+// newToken returns a random hex token of 32 characters
+func newToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// getDurationEnv parses the env variable with the given key as duration, e.g. "15m"
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
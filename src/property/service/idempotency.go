@@ -0,0 +1,91 @@
+package service
+
+import (
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	idempotencyTTL = getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour)
+	// requests that did not finish within this time are assumed to be lost, e.g. due to a restart
+	idempotencyLockTimeout = getDurationEnv("IDEMPOTENCY_LOCK_TIMEOUT", time.Minute)
+)
+
+// StartIdempotentRequest returns the record of an earlier request with the same key and method
+// or creates a new one which marks the request as in progress
+// NOTE: Records are kept for the retention window IDEMPOTENCY_TTL, expired records are purged lazily.
+// The caller has to replay the response of a completed record instead of handling the request again.
+func StartIdempotentRequest(key string, method string, requestHash string) (*model.IdempotencyRecord, error) {
+	now := clock.Now()
+	if err := db.DB.Unscoped().Where("expires_at <= ?", now).Delete(new(model.IdempotencyRecord)).Error; err != nil {
+		return nil, err
+	}
+
+	record, err := findIdempotencyRecord(key, method)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		record = &model.IdempotencyRecord{
+			IdempotencyKey: key,
+			Method:         method,
+			RequestHash:    requestHash,
+			ExpiresAt:      now.Add(idempotencyTTL),
+		}
+		if err := db.DB.Create(record).Error; err != nil {
+			// a concurrent request with the same key was faster
+			if existing, findErr := findIdempotencyRecord(key, method); findErr == nil && existing != nil {
+				return nil, &model.IdempotencyError{Key: key, InProgress: true}
+			}
+			return nil, err
+		}
+		return record, nil
+	}
+
+	if record.RequestHash != requestHash {
+		return nil, &model.IdempotencyError{Key: key}
+	}
+	if record.IsCompleted() {
+		entry := log.WithField("idempotencyKey", key)
+		entry.Infof("Replaying response of %s", method)
+		return record, nil
+	}
+	if record.UpdatedAt.After(now.Add(-idempotencyLockTimeout)) {
+		return nil, &model.IdempotencyError{Key: key, InProgress: true}
+	}
+
+	// take over the lost request, the update only succeeds for one of several concurrent retries
+	result := db.DB.Model(record).Where("updated_at = ?", record.UpdatedAt).Update("updated_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, &model.IdempotencyError{Key: key, InProgress: true}
+	}
+	return record, nil
+}
+
+// CompleteIdempotentRequest stores the response of the request of the given record
+func CompleteIdempotentRequest(record *model.IdempotencyRecord, response []byte) error {
+	record.Response = response
+	return db.DB.Model(record).Update("response", response).Error
+}
+
+// AbortIdempotentRequest deletes the record of a failed request, so that the client can retry it with the same key
+func AbortIdempotentRequest(record *model.IdempotencyRecord) error {
+	return db.DB.Unscoped().Delete(record).Error
+}
+
+func findIdempotencyRecord(key string, method string) (*model.IdempotencyRecord, error) {
+	record := new(model.IdempotencyRecord)
+	result := db.DB.Where("idempotency_key = ? AND method = ?", key, method).Limit(1).Find(record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return record, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+// maxRadiusKm limits radius searches, so that the bounding box stays selective
+const maxRadiusKm = 500
+
+// GetNearbyProperties retrieves the page of the properties within the given radius of the given coordinates
+// ordered by increasing distance and returns the token of the next page, which is empty for the last page
+// NOTE: Candidates are preselected by the bounding box of the circle, which can use the location index,
+// their exact distance is calculated with the haversine formula afterwards.
+func GetNearbyProperties(latitude float64, longitude float64, radiusKm float64, page model.PageRequest) ([]model.NearbyProperty, string, error) {
+	if err := model.ValidateCoordinates(latitude, longitude); err != nil {
+		return nil, "", err
+	}
+	if !(radiusKm > 0 && radiusKm <= maxRadiusKm) {
+		return nil, "", &model.PropertyError{Message: fmt.Sprintf("Radius must be greater than 0 and at most %d km", maxRadiusKm)}
+	}
+
+	minLatitude, maxLatitude, minLongitude, maxLongitude := model.BoundingBox(latitude, longitude, radiusKm)
+	query := db.DB.Model(new(model.Property)).Select("id", "latitude", "longitude").
+		Where("latitude BETWEEN ? AND ?", minLatitude, maxLatitude)
+	switch {
+	case minLongitude < -180:
+		query = query.Where("longitude >= ? OR longitude <= ?", minLongitude+360, maxLongitude)
+	case maxLongitude > 180:
+		query = query.Where("longitude >= ? OR longitude <= ?", minLongitude, maxLongitude-360)
+	default:
+		query = query.Where("longitude BETWEEN ? AND ?", minLongitude, maxLongitude)
+	}
+	var candidates []model.Property
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, "", err
+	}
+
+	distances := make(map[uint]float64)
+	var ids []uint
+	for _, candidate := range candidates {
+		if !candidate.HasLocation() {
+			continue
+		}
+		distance := model.DistanceKm(latitude, longitude, *candidate.Latitude, *candidate.Longitude)
+		if distance <= radiusKm {
+			distances[candidate.ID] = distance
+			ids = append(ids, candidate.ID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if distances[ids[i]] != distances[ids[j]] {
+			return distances[ids[i]] < distances[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	fingerprint, err := fingerprintQuery([]float64{latitude, longitude, radiusKm}, "distance")
+	if err != nil {
+		return nil, "", err
+	}
+	start, end, next, err := slicePage(len(ids), page, fingerprint)
+	if err != nil {
+		return nil, "", err
+	}
+	ids = ids[start:end]
+	if len(ids) == 0 {
+		return nil, "", nil
+	}
+
+	var properties []model.Property
+	if err := preloadDetails(db.DB).Find(&properties, ids).Error; err != nil {
+		return nil, "", err
+	}
+	propertiesById := make(map[uint]model.Property, len(properties))
+	for _, property := range properties {
+		propertiesById[property.ID] = property
+	}
+
+	nearby := make([]model.NearbyProperty, 0, len(ids))
+	for _, id := range ids {
+		if property, ok := propertiesById[id]; ok {
+			nearby = append(nearby, model.NearbyProperty{Property: property, DistanceKm: distances[id]})
+		}
+	}
+	log.Tracef("Retrieved: %v", nearby)
+	return nearby, next, nil
+}
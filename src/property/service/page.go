@@ -0,0 +1,163 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+)
+
+// NOTE: This file is identical in the property and the booking service apart from the imports and the error type,
+// changes have to be made to both copies.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pageToken is the content of the opaque page tokens handed out to clients
+// NOTE: The fingerprint binds a token to the filter and order of the request that produced it
+type pageToken struct {
+	Offset      int    `json:"o"`
+	Fingerprint string `json:"f"`
+}
+
+// paginate retrieves the page of the given query selected by the given page request
+// and returns the token of the next page, which is empty for the last page
+func paginate[T any](query *gorm.DB, page model.PageRequest, filter interface{}, sortable map[string]string) ([]T, string, error) {
+	order, err := parseOrderBy(page.OrderBy, sortable)
+	if err != nil {
+		return nil, "", err
+	}
+	fingerprint, err := fingerprintQuery(filter, order)
+	if err != nil {
+		return nil, "", err
+	}
+
+	offset, size, err := resolvePage(page, fingerprint)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// one more row tells whether there is a next page
+	var items []T
+	if err := query.Order(order).Offset(offset).Limit(size + 1).Find(&items).Error; err != nil {
+		return nil, "", err
+	}
+	if len(items) <= size {
+		return items, "", nil
+	}
+	next, err := encodePageToken(pageToken{Offset: offset + size, Fingerprint: fingerprint})
+	if err != nil {
+		return nil, "", err
+	}
+	return items[:size], next, nil
+}
+
+// slicePage returns the bounds of the page selected by the given page request within a list of the given length
+// ranked in memory and the token of the next page, which is empty for the last page
+func slicePage(length int, page model.PageRequest, fingerprint string) (int, int, string, error) {
+	offset, size, err := resolvePage(page, fingerprint)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if offset >= length {
+		return length, length, "", nil
+	}
+	if offset+size >= length {
+		return offset, length, "", nil
+	}
+	next, err := encodePageToken(pageToken{Offset: offset + size, Fingerprint: fingerprint})
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return offset, offset + size, next, nil
+}
+
+// resolvePage returns the offset and size of the given page request, whose token has to match the given fingerprint
+func resolvePage(page model.PageRequest, fingerprint string) (int, int, error) {
+	offset := 0
+	if page.PageToken != "" {
+		token, err := decodePageToken(page.PageToken)
+		if err != nil || token.Fingerprint != fingerprint || token.Offset < 0 {
+			return 0, 0, &model.PropertyError{Message: "Invalid page token, it has to be used with the same filters and order"}
+		}
+		offset = token.Offset
+	}
+	size := int(page.PageSize)
+	if size == 0 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	return offset, size, nil
+}
+
+// parseOrderBy translates the given order into an ORDER BY clause of the given sortable columns
+// NOTE: The id is always added as last column, so that the order and thus the pages are stable
+func parseOrderBy(orderBy string, sortable map[string]string) (string, error) {
+	var columns []string
+	hasId := false
+	for _, part := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		column, ok := sortable[fields[0]]
+		if !ok || len(fields) > 2 || (len(fields) == 2 && fields[1] != "asc" && fields[1] != "desc") {
+			names := make([]string, 0, len(sortable))
+			for name := range sortable {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			message := fmt.Sprintf("Cannot order by %q, expected one of %s optionally followed by asc or desc",
+				strings.TrimSpace(part), strings.Join(names, ", "))
+			return "", &model.PropertyError{Message: message}
+		}
+		if column == "id" {
+			hasId = true
+		}
+		if len(fields) == 2 && fields[1] == "desc" {
+			column += " DESC"
+		}
+		columns = append(columns, column)
+	}
+	if !hasId {
+		columns = append(columns, "id")
+	}
+	return strings.Join(columns, ", "), nil
+}
+
+func fingerprintQuery(filter interface{}, order string) (string, error) {
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(append(data, order...))
+	return hex.EncodeToString(hash[:8]), nil
+}
+
+func encodePageToken(token pageToken) (string, error) {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodePageToken(encoded string) (*pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	token := new(pageToken)
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/storage"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+// thumbnailSize is the maximum width and height of thumbnails in pixels
+const thumbnailSize = 320
+
+var photoExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// UploadPhoto adds the given image as last photo of the property matching the given id,
+// the first photo of a property becomes its cover
+// NOTE: The original and a JPEG thumbnail are put into the photo store before the photo is stored in the database
+// and are deleted again if that fails, so that the database never refers to missing blobs.
+func UploadPhoto(propertyId uint, data []byte) (*model.Photo, error) {
+	result := db.DB.Select("id").Limit(1).Find(new(model.Property), propertyId)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	contentType, err := model.DetectPhotoContentType(data)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &model.PropertyError{Message: fmt.Sprintf("The photo is no valid %s image", contentType)}
+	}
+	if err := model.ValidatePhotoDimensions(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &model.PropertyError{Message: fmt.Sprintf("The photo is no valid %s image", contentType)}
+	}
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, scaleDown(img, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	photo := &model.Photo{
+		PropertyId:   propertyId,
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		Width:        uint32(config.Width),
+		Height:       uint32(config.Height),
+		StorageKey:   fmt.Sprintf("properties/%d/photos/%s%s", propertyId, token, photoExtensions[contentType]),
+		ThumbnailKey: fmt.Sprintf("properties/%d/photos/%s_thumb.jpg", propertyId, token),
+	}
+	if err := storage.Photos.Put(photo.StorageKey, data); err != nil {
+		return nil, err
+	}
+	if err := storage.Photos.Put(photo.ThumbnailKey, thumbnail.Bytes()); err != nil {
+		deletePhotoBlobs([]model.Photo{*photo})
+		return nil, err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// positions are assigned one upload at a time
+		if err := lockProperty(tx, propertyId); err != nil {
+			return err
+		}
+		var photos []model.Photo
+		if err := tx.Where("property_id = ?", propertyId).Order("position").Find(&photos).Error; err != nil {
+			return err
+		}
+		if len(photos) >= model.MaxPhotos {
+			return &model.PropertyError{Message: fmt.Sprintf("A property must not have more than %d photos", model.MaxPhotos)}
+		}
+		if len(photos) == 0 {
+			photo.Cover = true
+		} else {
+			photo.Position = photos[len(photos)-1].Position + 1
+		}
+		return tx.Create(photo).Error
+	})
+	if err != nil {
+		deletePhotoBlobs([]model.Photo{*photo})
+		return nil, err
+	}
+
+	entry := log.WithField("ID", photo.ID)
+	entry.Info("Successfully stored new photo.")
+	entry.Tracef("Stored: %v", photo)
+	return photo, nil
+}
+
+// GetPhotos retrieves the photos of the property matching the given id in their order
+func GetPhotos(propertyId uint) ([]model.Photo, error) {
+	var photos []model.Photo
+	result := db.DB.Where("property_id = ?", propertyId).Order("position, id").Find(&photos)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	log.Tracef("Retrieved: %v", photos)
+	return photos, nil
+}
+
+// GetPhotoContent retrieves the photo matching the given ids and its original or its thumbnail,
+// nil if there is no such photo
+func GetPhotoContent(propertyId uint, photoId uint, thumbnail bool) (*model.Photo, []byte, error) {
+	photo, err := getPhoto(db.DB, propertyId, photoId)
+	if photo == nil || err != nil {
+		return nil, nil, err
+	}
+	key := photo.StorageKey
+	if thumbnail {
+		key = photo.ThumbnailKey
+	}
+	data, err := storage.Photos.Get(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("photo %d: %w", photoId, err)
+	}
+	return photo, data, nil
+}
+
+// ReorderPhotos orders the photos of the property matching the given id as given by their ids
+// NOTE: The ids have to list every photo of the property exactly once.
+func ReorderPhotos(propertyId uint, photoIds []uint) ([]model.Photo, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, propertyId); err != nil {
+			return err
+		}
+		var photos []model.Photo
+		if err := tx.Where("property_id = ?", propertyId).Find(&photos).Error; err != nil {
+			return err
+		}
+
+		positions := make(map[uint]uint32, len(photoIds))
+		for i, id := range photoIds {
+			positions[id] = uint32(i)
+		}
+		if len(positions) != len(photoIds) || len(photoIds) != len(photos) {
+			return &model.PropertyError{Message: "The photo ids have to list every photo of the property exactly once"}
+		}
+		for _, photo := range photos {
+			position, ok := positions[photo.ID]
+			if !ok {
+				return &model.PropertyError{Message: "The photo ids have to list every photo of the property exactly once"}
+			}
+			if err := tx.Model(&photo).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("ID", propertyId).Info("Successfully reordered photos of property.")
+	return GetPhotos(propertyId)
+}
+
+// SetCoverPhoto makes the photo matching the given ids the cover of its property,
+// nil if there is no such photo
+func SetCoverPhoto(propertyId uint, photoId uint) ([]model.Photo, error) {
+	found := false
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, propertyId); err != nil {
+			return err
+		}
+		photo, err := getPhoto(tx, propertyId, photoId)
+		if photo == nil || err != nil {
+			return err
+		}
+		found = true
+		if err := tx.Model(new(model.Photo)).Where("property_id = ? AND id <> ?", propertyId, photoId).Update("cover", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(photo).Update("cover", true).Error
+	})
+	if !found || err != nil {
+		return nil, err
+	}
+	log.WithField("ID", photoId).Info("Successfully set cover photo.")
+	return GetPhotos(propertyId)
+}
+
+// DeletePhoto deletes the photo matching the given ids together with its blobs,
+// the next photo becomes the cover if it was the cover
+func DeletePhoto(propertyId uint, photoId uint) (*model.Photo, error) {
+	var photo *model.Photo
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, propertyId); err != nil {
+			return err
+		}
+		var err error
+		photo, err = getPhoto(tx, propertyId, photoId)
+		if photo == nil || err != nil {
+			return err
+		}
+		if err := tx.Delete(photo).Error; err != nil {
+			return err
+		}
+		if !photo.Cover {
+			return nil
+		}
+		var next []model.Photo
+		if err := tx.Where("property_id = ?", propertyId).Order("position, id").Limit(1).Find(&next).Error; err != nil {
+			return err
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		return tx.Model(&next[0]).Update("cover", true).Error
+	})
+	if photo == nil || err != nil {
+		return nil, err
+	}
+	deletePhotoBlobs([]model.Photo{*photo})
+
+	entry := log.WithField("ID", photoId)
+	entry.Info("Successfully deleted photo.")
+	entry.Tracef("Deleted: %v", photo)
+	return photo, nil
+}
+
+// deletePropertyPhotos deletes the photos of the property matching the given id from the database
+// and returns them, so that their blobs can be deleted once the transaction is committed
+func deletePropertyPhotos(tx *gorm.DB, propertyId uint) ([]model.Photo, error) {
+	var photos []model.Photo
+	if err := tx.Where("property_id = ?", propertyId).Find(&photos).Error; err != nil {
+		return nil, err
+	}
+	if len(photos) == 0 {
+		return nil, nil
+	}
+	if err := tx.Delete(&photos).Error; err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// deletePhotoBlobs deletes the originals and thumbnails of the given photos from the photo store
+// NOTE: Failures are only logged, the photos are already gone from the database at this point.
+func deletePhotoBlobs(photos []model.Photo) {
+	for _, photo := range photos {
+		for _, key := range []string{photo.StorageKey, photo.ThumbnailKey} {
+			if err := storage.Photos.Delete(key); err != nil {
+				log.WithField("ID", photo.ID).Warnf("Failed to delete blob %s of photo: %v", key, err)
+			}
+		}
+	}
+}
+
+func getPhoto(tx *gorm.DB, propertyId uint, photoId uint) (*model.Photo, error) {
+	photo := new(model.Photo)
+	result := tx.Where("property_id = ?", propertyId).First(photo, photoId)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return photo, nil
+}
+
+// scaleDown returns the given image scaled down to fit into a square of the given size on a white background,
+// every pixel averages a grid of up to 4x4 pixels of the area it covers
+func scaleDown(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	targetWidth, targetHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			targetWidth, targetHeight = size, maxInt(1, height*size/width)
+		} else {
+			targetWidth, targetHeight = maxInt(1, width*size/height), size
+		}
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	for y := 0; y < targetHeight; y++ {
+		y0, y1 := bounds.Min.Y+y*height/targetHeight, bounds.Min.Y+maxInt((y+1)*height/targetHeight, y*height/targetHeight+1)
+		for x := 0; x < targetWidth; x++ {
+			x0, x1 := bounds.Min.X+x*width/targetWidth, bounds.Min.X+maxInt((x+1)*width/targetWidth, x*width/targetWidth+1)
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy += maxInt(1, (y1-y0)/4) {
+				for sx := x0; sx < x1; sx += maxInt(1, (x1-x0)/4) {
+					// the colors are premultiplied by alpha, adding the missing coverage yields white
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, n = r+pr+0xffff-pa, g+pg+0xffff-pa, b+pb+0xffff-pa, n+1
+				}
+			}
+			scaled.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: 0xffff})
+		}
+	}
+	return scaled
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -7,15 +7,38 @@ import (
 	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
-// CreateProperty creates the given property with initial status FREE
+// CreateProperty creates the given property and adds it to the full-text index
+// NOTE: Its owner has to be an account with the role OWNER, whose name is stored with the property.
+// Its amenities have to exist in the catalogue, its tags are created if missing.
 func CreateProperty(property *model.Property) error {
-	property.SetStatusFree()
+	owner, err := getOwner(property.OwnerId)
+	if err != nil {
+		return err
+	}
+	property.OwnerName = owner.Name
 
-	result := db.DB.Create(property)
-	if result.Error != nil {
-		return result.Error
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		amenities, err := resolveAmenities(tx, property.Amenities)
+		if err != nil {
+			return err
+		}
+		tags, err := resolveTags(tx, property.Tags)
+		if err != nil {
+			return err
+		}
+		property.Amenities, property.Tags = amenities, tags
+
+		if err := tx.Create(property).Error; err != nil {
+			return err
+		}
+		return indexProperty(tx, property)
+	})
+	if err != nil {
+		return err
 	}
 	entry := log.WithField("ID", property.ID)
 	entry.Info("Successfully stored new property in database.")
@@ -23,10 +46,93 @@ func CreateProperty(property *model.Property) error {
 	return nil
 }
 
-// GetProperties retrieves all existing properties
-func GetProperties() ([]model.Property, error) {
+// sortableProperties maps the fields properties can be ordered by to their columns
+var sortableProperties = map[string]string{
+	"id":           "id",
+	"name":         "name",
+	"owner_name":   "owner_name",
+	"nightly_rate": "nightly_rate",
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+}
+
+// GetProperties retrieves the page of the properties matching the given filter selected by the given page request
+// and returns the token of the next page, which is empty for the last page
+func GetProperties(filter model.PropertyFilter, page model.PageRequest) ([]model.Property, string, error) {
+	query := preloadDetails(filterProperties(filter))
+	properties, nextPageToken, err := paginate[model.Property](query, page, filter, sortableProperties)
+	if err != nil {
+		return nil, "", err
+	}
+	log.Tracef("Retrieved: %v", properties)
+	return properties, nextPageToken, nil
+}
+
+// filterProperties returns a query of the properties matching the given filter
+func filterProperties(filter model.PropertyFilter) *gorm.DB {
+	query := db.DB.Model(new(model.Property))
+	if filter.OwnerId != 0 {
+		query = query.Where("owner_id = ?", filter.OwnerId)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedBefore)
+	}
+	for _, code := range filter.Amenities {
+		withAmenity := db.DB.Table("property_amenities").Select("property_id").
+			Joins("JOIN amenities ON amenities.id = property_amenities.amenity_id").
+			Where("amenities.code = ?", code)
+		query = query.Where("id IN (?)", withAmenity)
+	}
+	for _, tag := range filter.Tags {
+		withTag := db.DB.Table("property_tags").Select("property_id").
+			Joins("JOIN tags ON tags.id = property_tags.tag_id").
+			Where("tags.name = ?", model.NormalizeTag(tag))
+		query = query.Where("id IN (?)", withTag)
+	}
+	return query
+}
+
+// preloadDetails adds the associations returned with every property to the given query
+func preloadDetails(query *gorm.DB) *gorm.DB {
+	return query.Preload("Reservations").Preload("RefundTiers").Preload("Amenities").Preload("Tags").
+		Preload("Photos", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("position, id")
+		})
+}
+
+// GetReservations retrieves the reservations of all properties ending after the given time,
+// all reservations if the time is zero
+func GetReservations(checkOutAfter time.Time) ([]model.Reservation, error) {
+	var reservations []model.Reservation
+	result := db.DB.Where("check_out > ?", checkOutAfter).Order("id").Find(&reservations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	log.Tracef("Retrieved: %v", reservations)
+	return reservations, nil
+}
+
+// GetAvailableProperties retrieves all properties without a reservation overlapping the range from `from` to `to`
+func GetAvailableProperties(from time.Time, to time.Time) ([]model.Property, error) {
+	from, to = model.TruncateToDay(from), model.TruncateToDay(to)
+	if !to.After(from) {
+		return nil, &model.PropertyError{Message: "The end of the search window must be at least one day after its start"}
+	}
+
+	reserved := db.DB.Model(new(model.Reservation)).
+		Select("property_id").
+		Where("check_in < ? AND check_out > ?", to, from)
+	held := db.DB.Model(new(model.Hold)).
+		Select("property_id").
+		Where("check_in < ? AND check_out > ? AND expires_at > ?", to, from, clock.Now())
+
 	var properties []model.Property
-	result := db.DB.Find(&properties)
+	result := preloadDetails(db.DB).
+		Where("id NOT IN (?) AND id NOT IN (?)", reserved, held).
+		Find(&properties)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -37,7 +143,7 @@ func GetProperties() ([]model.Property, error) {
 // GetProperty retrieves the property matching the given id
 func GetProperty(id uint) (*model.Property, error) {
 	existingProperty := new(model.Property)
-	result := db.DB.First(existingProperty, id)
+	result := preloadDetails(db.DB).First(existingProperty, id)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -48,21 +154,85 @@ func GetProperty(id uint) (*model.Property, error) {
 	return existingProperty, nil
 }
 
-// UpdateProperty updates the property matching the given id
-func UpdateProperty(id uint, property *model.Property) (*model.Property, error) {
+// UpdateProperty updates the property matching the given id and its entries in the full-text index
+// NOTE: The update is rejected if the property no longer has the expected version,
+// 0 updates whatever version was read, which still detects concurrent updates.
+// An owner id of 0 keeps the current owner.
+func UpdateProperty(id uint, property *model.Property, expectedVersion uint) (*model.Property, error) {
 	existingProperty, err := GetProperty(id)
 	if existingProperty == nil || err != nil {
 		return existingProperty, err
 	}
+	if property.OwnerId != 0 && property.OwnerId != existingProperty.OwnerId {
+		owner, err := getOwner(property.OwnerId)
+		if err != nil {
+			return nil, err
+		}
+		existingProperty.OwnerId, existingProperty.OwnerName = property.OwnerId, owner.Name
+	}
+	if expectedVersion == 0 {
+		expectedVersion = existingProperty.Version
+	}
+	if existingProperty.Version != expectedVersion {
+		return nil, &model.VersionConflictError{Id: id, ExpectedVersion: expectedVersion}
+	}
 
 	existingProperty.Name = property.Name
 	existingProperty.Description = property.Description
-	existingProperty.OwnerName = property.OwnerName
 	existingProperty.Address = property.Address
+	existingProperty.PostalAddress = property.PostalAddress
+	existingProperty.Latitude = property.Latitude
+	existingProperty.Longitude = property.Longitude
+	existingProperty.BookingMode = property.BookingMode
+	existingProperty.NightlyRate = property.NightlyRate
+	existingProperty.CleaningFee = property.CleaningFee
+	existingProperty.Currency = property.Currency
+	existingProperty.TaxRate = property.TaxRate
+	existingProperty.MaxGuests = property.MaxGuests
+	existingProperty.Bedrooms = property.Bedrooms
+	existingProperty.NoPets = property.NoPets
+	existingProperty.CancellationPolicy = property.CancellationPolicy
+	existingProperty.RefundTiers = property.RefundTiers
 
-	result := db.DB.Save(existingProperty)
-	if result.Error != nil {
-		return nil, result.Error
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		incremented, err := incrementVersion(tx, new(model.Property), id, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if !incremented {
+			return &model.VersionConflictError{Id: id, ExpectedVersion: expectedVersion}
+		}
+		existingProperty.Version = expectedVersion + 1
+
+		amenities, err := resolveAmenities(tx, property.Amenities)
+		if err != nil {
+			return err
+		}
+		tags, err := resolveTags(tx, property.Tags)
+		if err != nil {
+			return err
+		}
+
+		// the new refund tiers replace the old ones
+		if err := tx.Unscoped().Where("property_id = ?", id).Delete(new(model.RefundTier)).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Amenities", "Tags", "Photos", "ReviewCount", "RatingTotal").Save(existingProperty).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(existingProperty).Association("Amenities").Replace(amenities); err != nil {
+			return err
+		}
+		if err := tx.Model(existingProperty).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+		if err := unindexProperty(tx, id); err != nil {
+			return err
+		}
+		return indexProperty(tx, existingProperty)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	entry := log.WithField("ID", id)
@@ -71,22 +241,42 @@ func UpdateProperty(id uint, property *model.Property) (*model.Property, error)
 	return existingProperty, nil
 }
 
-// DeleteProperty deletes the property matching the given id
-// NOTE: Deletion is only possible if the property is free
+// DeleteProperty deletes the property matching the given id together with its photos
+// and removes it from the full-text index
+// NOTE: Deletion is only possible if the property has no current or upcoming reservations or active holds.
+// These are counted while holding the lock on the property, so that no reservation is created concurrently,
+// see lockProperty.
 func DeleteProperty(id uint) (*model.Property, error) {
 	existingProperty, err := GetProperty(id)
 	if existingProperty == nil || err != nil {
 		return existingProperty, err
 	}
 
-	if existingProperty.IsStatusBooked() {
-		return nil, &model.PropertyError{Message: "Property cannot be deleted, because it is booked. Please, cancel the booking first."}
-	}
+	var photos []model.Photo
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, id); err != nil {
+			return err
+		}
+		booked, err := countUpcoming(tx, id)
+		if err != nil {
+			return err
+		}
+		if booked > 0 {
+			return &model.PropertyError{Message: "Property cannot be deleted, because it is booked. Please, cancel the bookings first."}
+		}
 
-	result := db.DB.Delete(existingProperty)
-	if result.Error != nil {
-		return nil, result.Error
+		if err := tx.Delete(existingProperty).Error; err != nil {
+			return err
+		}
+		if photos, err = deletePropertyPhotos(tx, id); err != nil {
+			return err
+		}
+		return unindexProperty(tx, id)
+	})
+	if err != nil {
+		return nil, err
 	}
+	deletePhotoBlobs(photos)
 
 	entry := log.WithField("ID", id)
 	entry.Info("Successfully deleted property.")
@@ -94,46 +284,200 @@ func DeleteProperty(id uint) (*model.Property, error) {
 	return existingProperty, nil
 }
 
-// BookProperty books the given property if it is not already booked
+// BookProperty reserves the given property from checkIn to checkOut if the stay does not overlap an existing reservation
+// or an active hold other than the one identified by holdToken, which is consumed by the booking
 // This is checked to prevent double-booking the property
-func BookProperty(existingProperty *model.Property, bookingId uint) error {
-	if existingProperty.IsStatusBooked() {
-		message := fmt.Sprintf("Sorry, property %s (ID: %d) is already booked", existingProperty.Name, existingProperty.ID)
-		return &model.PropertyError{Message: message}
+// The given guests have to fit the capacity and pets policy of the property.
+// NOTE: The reservation awaits the approval of the owner if the property is in request mode.
+// Repeated calls for the same booking return the existing reservation.
+// The check and the reservation happen in one transaction holding a lock on the property, see lockProperty.
+func BookProperty(existingProperty *model.Property, bookingId uint, checkIn time.Time, checkOut time.Time, guests model.Guests, holdToken string) (*model.Reservation, error) {
+	checkIn, checkOut = model.TruncateToDay(checkIn), model.TruncateToDay(checkOut)
+	if !checkOut.After(checkIn) {
+		return nil, &model.PropertyError{Message: "Check-out must be at least one day after check-in"}
 	}
 
-	existingProperty.SetStatusBooked()
-	existingProperty.BookingId = bookingId
+	var reservation *model.Reservation
+	var hold *model.Hold
+	alreadyReserved := false
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, existingProperty.ID); err != nil {
+			return err
+		}
 
-	result := db.DB.Save(existingProperty)
-	if result.Error != nil {
-		return result.Error
+		existingReservation := new(model.Reservation)
+		result := tx.Where("property_id = ? AND booking_id = ?", existingProperty.ID, bookingId).Limit(1).Find(existingReservation)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			reservation, alreadyReserved = existingReservation, true
+			return nil
+		}
+
+		if err := existingProperty.CheckGuests(guests); err != nil {
+			return err
+		}
+
+		if holdToken != "" {
+			var err error
+			hold, err = getValidHold(tx, existingProperty.ID, holdToken, checkIn, checkOut)
+			if err != nil {
+				return err
+			}
+		}
+
+		conflicts, err := countConflicts(tx, existingProperty.ID, checkIn, checkOut, holdToken)
+		if err != nil {
+			return err
+		}
+		if conflicts > 0 {
+			message := fmt.Sprintf("Sorry, property %s (ID: %d) is already booked between %s and %s",
+				existingProperty.Name, existingProperty.ID, checkIn.Format(time.DateOnly), checkOut.Format(time.DateOnly))
+			return &model.PropertyError{Message: message}
+		}
+
+		reservation = &model.Reservation{
+			PropertyId:        existingProperty.ID,
+			BookingId:         bookingId,
+			CheckIn:           checkIn,
+			CheckOut:          checkOut,
+			ReservationStatus: model.CONFIRMED,
+		}
+		if existingProperty.RequiresApproval() {
+			reservation.ReservationStatus = model.PENDING_APPROVAL
+		}
+		if err := tx.Create(reservation).Error; err != nil {
+			return err
+		}
+		if err := touchProperty(tx, existingProperty.ID); err != nil {
+			return err
+		}
+		if hold != nil {
+			// the reservation replaces the hold
+			return tx.Delete(hold).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if alreadyReserved {
+		log.WithField("ID", existingProperty.ID).Infof("Property is already reserved for booking %d.", bookingId)
+		return reservation, nil
+	}
+	if hold != nil {
+		if err := removeAcceptedOffer(hold.Token); err != nil {
+			return nil, err
+		}
 	}
 
 	entry := log.WithField("ID", existingProperty.ID)
 	entry.Info("Successfully booked property.")
-	entry.Tracef("Updated: %v", existingProperty)
+	entry.Tracef("Reserved: %v", reservation)
+	return reservation, nil
+}
+
+// lockProperty locks the row of the property matching the given id until the given transaction ends
+// NOTE: Every transaction that checks for conflicts before creating a reservation or hold takes this lock first,
+// so that concurrent requests for the same property are serialized and cannot both pass the check.
+// It has to be the first statement of the transaction, so that the following reads see the committed
+// changes of the transaction that held the lock before.
+func lockProperty(tx *gorm.DB, propertyId uint) error {
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		Where("id = ?", propertyId).Limit(1).Find(new(model.Property))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &model.PropertyError{Message: fmt.Sprintf("Property %d does not exist anymore", propertyId)}
+	}
 	return nil
 }
 
-// FreeProperty frees the given property if the given requestedBookingId matches the stored bookingId
-// This is checked to prevent someone from cancelling another person's booking
-func FreeProperty(existingProperty *model.Property, requestedBookingId uint) error {
-	if existingProperty.BookingId != requestedBookingId {
-		message := fmt.Sprintf("Whoops! It seems as if the property %s (ID: %d) is already booked.", existingProperty.Name, existingProperty.ID)
-		return &model.PropertyError{Message: message}
+// countConflicts counts the reservations and active holds of the given property that overlap the range from checkIn to checkOut
+// NOTE: The hold matching exceptHoldToken is ignored, so that its owner can book the held range
+func countConflicts(tx *gorm.DB, propertyId uint, checkIn time.Time, checkOut time.Time, exceptHoldToken string) (int64, error) {
+	var reservations int64
+	result := tx.Model(new(model.Reservation)).
+		Where("property_id = ? AND check_in < ? AND check_out > ?", propertyId, checkOut, checkIn).
+		Count(&reservations)
+	if result.Error != nil {
+		return 0, result.Error
 	}
 
-	existingProperty.SetStatusFree()
-	existingProperty.BookingId = 0
+	var holds int64
+	result = tx.Model(new(model.Hold)).
+		Where("property_id = ? AND check_in < ? AND check_out > ? AND expires_at > ? AND token <> ?",
+			propertyId, checkOut, checkIn, clock.Now(), exceptHoldToken).
+		Count(&holds)
+	if result.Error != nil {
+		return 0, result.Error
+	}
 
-	result := db.DB.Save(existingProperty)
+	return reservations + holds, nil
+}
+
+// countUpcoming counts the reservations and active holds of the given property that have not ended yet
+func countUpcoming(tx *gorm.DB, propertyId uint) (int64, error) {
+	now := clock.Now()
+	today := model.TruncateToDay(now)
+	var reservations int64
+	result := tx.Model(new(model.Reservation)).Where("property_id = ? AND check_out > ?", propertyId, today).Count(&reservations)
 	if result.Error != nil {
-		return result.Error
+		return 0, result.Error
+	}
+
+	var holds int64
+	result = tx.Model(new(model.Hold)).Where("property_id = ? AND check_out > ? AND expires_at > ?", propertyId, today, now).
+		Count(&holds)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return reservations + holds, nil
+}
+
+// FreeProperty removes the reservation of the given property that belongs to the given requestedBookingId
+// This is checked to prevent someone from cancelling another person's booking
+func FreeProperty(existingProperty *model.Property, requestedBookingId uint) error {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("property_id = ? AND booking_id = ?", existingProperty.ID, requestedBookingId).
+			Delete(new(model.Reservation))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			message := fmt.Sprintf("Whoops! It seems as if the property %s (ID: %d) has no reservation for booking %d.",
+				existingProperty.Name, existingProperty.ID, requestedBookingId)
+			return &model.PropertyError{Message: message}
+		}
+		return touchProperty(tx, existingProperty.ID)
+	})
+	if err != nil {
+		return err
 	}
 
 	entry := log.WithField("ID", existingProperty.ID)
 	entry.Info("Successfully freed property.")
-	entry.Tracef("Updated: %v", existingProperty)
+	entry.Tracef("Released reservation of booking: %d", requestedBookingId)
+
+	offerToWaitlist(existingProperty.ID)
 	return nil
 }
+
+// touchProperty increments the version of the property matching the given id within the given transaction
+// NOTE: The reservations are part of the property, so every change of them changes its version
+// and updates based on an earlier read are rejected
+func touchProperty(tx *gorm.DB, propertyId uint) error {
+	return tx.Model(new(model.Property)).Where("id = ?", propertyId).
+		UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// incrementVersion increments the version of the row with the given id if it still has the expected version
+// NOTE: The row stays locked until the transaction ends, so that checking the version and saving are atomic
+func incrementVersion(tx *gorm.DB, value interface{}, id uint, expectedVersion uint) (bool, error) {
+	result := tx.Model(value).Where("id = ? AND version = ?", id, expectedVersion).
+		Update("version", gorm.Expr("version + 1"))
+	return result.RowsAffected == 1, result.Error
+}
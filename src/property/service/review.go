@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto/client/booking"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"time"
+)
+
+// completedStatus is the status of bookings whose stay is over
+const completedStatus = "COMPLETED"
+
+// sortableReviews maps the fields reviews can be ordered by to their columns
+var sortableReviews = map[string]string{
+	"id":         "id",
+	"rating":     "rating",
+	"created_at": "created_at",
+}
+
+// CreateReview stores the given review and adds its rating to the property, nil if there is no such property
+// NOTE: The booking service has to confirm that the booking of the review is a completed stay
+// of the given customer at the property, so that every review belongs to a real stay.
+// This does not prove that the customer sent the review, as the customer id is taken from the request, see verifyStay.
+func CreateReview(review *model.Review) (*model.Review, error) {
+	existingProperty, err := GetProperty(review.PropertyId)
+	if existingProperty == nil || err != nil {
+		return nil, err
+	}
+	if err := verifyStay(review); err != nil {
+		return nil, err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockProperty(tx, review.PropertyId); err != nil {
+			return err
+		}
+		var count int64
+		result := tx.Model(new(model.Review)).
+			Where("property_id = ? AND customer_id = ?", review.PropertyId, review.CustomerId).
+			Count(&count)
+		if result.Error != nil {
+			return result.Error
+		}
+		if count > 0 {
+			message := fmt.Sprintf("%s already reviewed property %d", review.CustomerName, review.PropertyId)
+			return &model.PropertyError{Message: message}
+		}
+
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+		return tx.Model(new(model.Property)).Where("id = ?", review.PropertyId).UpdateColumns(map[string]interface{}{
+			"review_count": gorm.Expr("review_count + 1"),
+			"rating_total": gorm.Expr("rating_total + ?", review.Rating),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := log.WithField("ID", review.ID)
+	entry.Info("Successfully stored new review.")
+	entry.Tracef("Stored: %v", review)
+	return review, nil
+}
+
+// GetReviews retrieves the page of the reviews of the property matching the given id selected by the given page request
+// and returns the token of the next page, which is empty for the last page
+func GetReviews(propertyId uint, page model.PageRequest) ([]model.Review, string, error) {
+	query := db.DB.Where("property_id = ?", propertyId)
+	reviews, nextPageToken, err := paginate[model.Review](query, page, propertyId, sortableReviews)
+	if err != nil {
+		return nil, "", err
+	}
+	log.Tracef("Retrieved: %v", reviews)
+	return reviews, nextPageToken, nil
+}
+
+// ReplyToReview stores the reply of the owner of the property to the review matching the given ids,
+// nil if there is no such review
+func ReplyToReview(propertyId uint, reviewId uint, ownerId uint, reply string) (*model.Review, error) {
+	existingProperty, err := GetProperty(propertyId)
+	if existingProperty == nil || err != nil {
+		return nil, err
+	}
+	if !existingProperty.IsOwnedBy(ownerId) {
+		message := fmt.Sprintf("Only the owner of property %s (ID: %d) can reply to its reviews", existingProperty.Name, existingProperty.ID)
+		return nil, &model.PermissionError{Message: message}
+	}
+
+	review := new(model.Review)
+	result := db.DB.Where("property_id = ?", propertyId).Limit(1).Find(review, reviewId)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	// only the first of concurrent replies is stored
+	now := clock.Now()
+	result = db.DB.Model(review).Where("replied_at IS NULL").Updates(map[string]interface{}{"reply": reply, "replied_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, &model.PropertyError{Message: fmt.Sprintf("Review %d already has a reply", reviewId)}
+	}
+	review.Reply = reply
+	review.RepliedAt = &now
+
+	entry := log.WithField("ID", reviewId)
+	entry.Info("Successfully stored reply to review.")
+	entry.Tracef("Updated: %v", review)
+	return review, nil
+}
+
+// verifyStay asks the booking service whether the booking of the given review is a completed stay
+// of the given customer at the reviewed property and takes the name of the customer from it
+// NOTE: Requests are not authenticated and the ids of bookings and customers are public,
+// so anyone knowing them passes the check. Only an authentication in front of the proxy can tie it to the sender.
+func verifyStay(review *model.Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	conn, err := client.GetBookingConnection(ctx)
+	if err != nil {
+		log.Errorf("Error connecting to booking service: %v", err)
+		return err
+	}
+	defer func(conn *grpc.ClientConn) {
+		err := conn.Close()
+		if err != nil {
+			log.Errorf("Error closing connection: %s", err)
+		}
+	}(conn)
+
+	stay, err := proto.NewBookingInternalClient(conn).GetStay(ctx, &proto.StayReq{BookingId: uint32(review.BookingId)})
+	if status.Code(err) == codes.NotFound {
+		return &model.PermissionError{Message: fmt.Sprintf("Booking %d does not exist", review.BookingId)}
+	}
+	if err != nil {
+		log.Errorf("Error calling booking service: %v", err)
+		return err
+	}
+
+	if uint(stay.PropertyId) != review.PropertyId || uint(stay.CustomerId) != review.CustomerId {
+		message := fmt.Sprintf("Booking %d is no stay of user %d at property %d", review.BookingId, review.CustomerId, review.PropertyId)
+		return &model.PermissionError{Message: message}
+	}
+	if stay.Status != completedStatus {
+		message := fmt.Sprintf("Booking %d is %s, only completed stays can be reviewed", review.BookingId, stay.Status)
+		return &model.PermissionError{Message: message}
+	}
+	review.CustomerName = stay.CustomerName
+	return nil
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxQueryWords limits the words of a search query, every word requires a lookup in the index
+const maxQueryWords = 10
+
+// fieldWeights rank matches in the name above matches in the address above matches in the description
+var fieldWeights = map[model.SearchField]float64{
+	model.NAME:        3,
+	model.ADDRESS:     2,
+	model.DESCRIPTION: 1,
+}
+
+// SearchProperties retrieves the page of the properties matching the given free-text query ordered by relevance
+// and returns the token of the next page, which is empty for the last page
+// NOTE: A word of the query matches a term of the index exactly, as prefix of at least 3 letters
+// or with up to 1 typo (words of 4 to 7 letters) or 2 typos (longer words), in decreasing relevance.
+// Typos in the first letter are mostly not corrected, see findCandidateTerms.
+// The relevance of a property sums up the best match of every word weighted by field and rarity of the term.
+func SearchProperties(query string, page model.PageRequest) ([]model.SearchResult, string, error) {
+	words := uniqueWords(model.Tokenize(query))
+	if len(words) == 0 {
+		return nil, "", &model.PropertyError{Message: "The search query must contain at least one word"}
+	}
+	if len(words) > maxQueryWords {
+		return nil, "", &model.PropertyError{Message: "The search query must not contain more than 10 words"}
+	}
+
+	// relevance of the matching terms by word
+	matches := make([]map[string]float64, len(words))
+	var terms []string
+	for i, word := range words {
+		candidates, err := findCandidateTerms(word)
+		if err != nil {
+			return nil, "", err
+		}
+		matches[i] = make(map[string]float64)
+		for _, term := range candidates {
+			if relevance := matchRelevance(word, term); relevance > 0 {
+				matches[i][term] = relevance
+				terms = append(terms, term)
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return nil, "", nil
+	}
+
+	var entries []model.SearchTerm
+	if err := db.DB.Where("term IN ?", terms).Find(&entries).Error; err != nil {
+		return nil, "", err
+	}
+	var propertyCount int64
+	if err := db.DB.Model(new(model.Property)).Count(&propertyCount).Error; err != nil {
+		return nil, "", err
+	}
+	rarity := termRarity(entries, propertyCount)
+
+	// best score of every word and matching terms by property
+	type candidate struct {
+		id          uint
+		wordScores  []float64
+		highlighted map[model.SearchField]map[string]bool
+	}
+	candidates := make(map[uint]*candidate)
+	for _, entry := range entries {
+		c, ok := candidates[entry.PropertyId]
+		if !ok {
+			c = &candidate{id: entry.PropertyId, wordScores: make([]float64, len(words)), highlighted: make(map[model.SearchField]map[string]bool)}
+			candidates[entry.PropertyId] = c
+		}
+		for i := range words {
+			relevance, ok := matches[i][entry.Term]
+			if !ok {
+				continue
+			}
+			score := fieldWeights[entry.Field] * relevance * rarity[entry.Term]
+			c.wordScores[i] = math.Max(c.wordScores[i], score)
+			if c.highlighted[entry.Field] == nil {
+				c.highlighted[entry.Field] = make(map[string]bool)
+			}
+			c.highlighted[entry.Field][entry.Term] = true
+		}
+	}
+
+	ranked := make([]*candidate, 0, len(candidates))
+	scores := make(map[uint]float64, len(candidates))
+	for id, c := range candidates {
+		for _, score := range c.wordScores {
+			scores[id] += score
+		}
+		ranked = append(ranked, c)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i].id] != scores[ranked[j].id] {
+			return scores[ranked[i].id] > scores[ranked[j].id]
+		}
+		return ranked[i].id < ranked[j].id
+	})
+
+	fingerprint, err := fingerprintQuery(words, "relevance")
+	if err != nil {
+		return nil, "", err
+	}
+	start, end, next, err := slicePage(len(ranked), page, fingerprint)
+	if err != nil {
+		return nil, "", err
+	}
+	ranked = ranked[start:end]
+	if len(ranked) == 0 {
+		return nil, "", nil
+	}
+
+	ids := make([]uint, len(ranked))
+	for i, c := range ranked {
+		ids[i] = c.id
+	}
+	var properties []model.Property
+	if err := preloadDetails(db.DB).Find(&properties, ids).Error; err != nil {
+		return nil, "", err
+	}
+	propertiesById := make(map[uint]model.Property, len(properties))
+	for _, property := range properties {
+		propertiesById[property.ID] = property
+	}
+
+	results := make([]model.SearchResult, 0, len(ranked))
+	for _, c := range ranked {
+		property, ok := propertiesById[c.id]
+		if !ok {
+			continue
+		}
+		result := model.SearchResult{Property: property, Score: scores[c.id]}
+		for _, field := range model.SearchFields {
+			if highlighted := c.highlighted[field]; highlighted != nil {
+				result.Snippets = append(result.Snippets, model.Snippet{Field: field, Text: highlight(property.SearchText(field), highlighted)})
+			}
+		}
+		results = append(results, result)
+	}
+	log.Tracef("Retrieved: %v", results)
+	return results, next, nil
+}
+
+// RebuildSearchIndex replaces the full-text index with the terms of all existing properties
+// and returns the number of indexed properties
+func RebuildSearchIndex() (int, error) {
+	count := 0
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(new(model.SearchTerm)).Error; err != nil {
+			return err
+		}
+		var properties []model.Property
+		return tx.FindInBatches(&properties, 100, func(batch *gorm.DB, _ int) error {
+			for i := range properties {
+				if err := indexProperty(tx, &properties[i]); err != nil {
+					return err
+				}
+			}
+			count += len(properties)
+			return nil
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Successfully rebuilt search index of %d properties.", count)
+	return count, nil
+}
+
+// indexProperty adds the terms of the given property to the full-text index
+func indexProperty(tx *gorm.DB, property *model.Property) error {
+	var entries []model.SearchTerm
+	for _, field := range model.SearchFields {
+		occurrences := make(map[string]uint32)
+		var terms []string
+		for _, term := range model.Tokenize(property.SearchText(field)) {
+			if occurrences[term] == 0 {
+				terms = append(terms, term)
+			}
+			occurrences[term]++
+		}
+		for _, term := range terms {
+			entries = append(entries, model.SearchTerm{PropertyId: property.ID, Field: field, Term: term, Occurrences: occurrences[term]})
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.Create(&entries).Error
+}
+
+// unindexProperty removes the terms of the property matching the given id from the full-text index
+func unindexProperty(tx *gorm.DB, propertyId uint) error {
+	return tx.Where("property_id = ?", propertyId).Delete(new(model.SearchTerm)).Error
+}
+
+// findCandidateTerms retrieves the distinct terms of the index which may match the given word,
+// those starting with the word and, if typos are allowed, those of similar length starting with
+// the first or second letter of the word
+// NOTE: Restricting the typos to these prefixes lets the index on the terms narrow down the candidates, so a typo
+// in the first letter is only corrected if the first two letters are swapped or the word starts with an extra letter.
+func findCandidateTerms(word string) ([]string, error) {
+	runes := []rune(word)
+	typos := allowedTypos(len(runes))
+	escape := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace
+
+	query := db.DB.Model(new(model.SearchTerm)).Distinct("term")
+	if typos > 0 {
+		query = query.Where("term LIKE ? OR ((term LIKE ? OR term LIKE ?) AND CHAR_LENGTH(term) BETWEEN ? AND ?)",
+			escape(word)+"%", escape(string(runes[0]))+"%", escape(string(runes[1]))+"%", len(runes)-typos, len(runes)+typos)
+	} else {
+		query = query.Where("term LIKE ?", escape(word)+"%")
+	}
+
+	var terms []string
+	if err := query.Pluck("term", &terms).Error; err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+// matchRelevance returns how well the given term matches the given word of a query, 0 if it does not match
+func matchRelevance(word string, term string) float64 {
+	if word == term {
+		return 1
+	}
+	wordRunes, termRunes := []rune(word), []rune(term)
+	if len(wordRunes) >= 3 && strings.HasPrefix(term, word) {
+		return 0.75
+	}
+	typos := allowedTypos(len(wordRunes))
+	if typos == 0 {
+		return 0
+	}
+	if distance := editDistance(wordRunes, termRunes); distance <= typos {
+		return 0.5 / float64(distance)
+	}
+	return 0
+}
+
+func allowedTypos(length int) int {
+	switch {
+	case length <= 3:
+		return 0
+	case length <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance counts the insertions, deletions, substitutions and transpositions of adjacent letters
+// needed to turn a into b (optimal string alignment distance)
+func editDistance(a []rune, b []rune) int {
+	previous2 := make([]int, len(b)+1)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				current[j] = minInt(current[j], previous2[j-2]+1)
+			}
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// termRarity weights the terms of the given entries by inverse document frequency,
+// so that terms shared by few properties count more than common ones
+func termRarity(entries []model.SearchTerm, propertyCount int64) map[string]float64 {
+	properties := make(map[string]map[uint]bool)
+	for _, entry := range entries {
+		if properties[entry.Term] == nil {
+			properties[entry.Term] = make(map[uint]bool)
+		}
+		properties[entry.Term][entry.PropertyId] = true
+	}
+	rarity := make(map[string]float64, len(properties))
+	for term, ids := range properties {
+		rarity[term] = math.Log(1 + float64(propertyCount)/float64(len(ids)))
+	}
+	return rarity
+}
+
+// highlight escapes the given text for HTML and wraps the words matching the given terms in <em> tags
+func highlight(text string, terms map[string]bool) string {
+	var builder strings.Builder
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		end := start
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+			end++
+		}
+		if end == start {
+			builder.WriteString(html.EscapeString(string(runes[start])))
+			start++
+			continue
+		}
+		word := string(runes[start:end])
+		if terms[strings.ToLower(word)] {
+			builder.WriteString("<em>" + html.EscapeString(word) + "</em>")
+		} else {
+			builder.WriteString(html.EscapeString(word))
+		}
+		start = end
+	}
+	return builder.String()
+}
+
+func uniqueWords(words []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			unique = append(unique, word)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/proto/client/user"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+const (
+	// ownerRole is required to own properties
+	ownerRole = "OWNER"
+	// customerRole is granted to the accounts of migrated reviews
+	customerRole = "CUSTOMER"
+)
+
+// getOwner retrieves the account matching the given id from the user service
+// and checks that it is allowed to own properties
+func getOwner(id uint) (*proto.Account, error) {
+	if id == 0 {
+		return nil, &model.PropertyError{Message: "A property requires the id of its owner"}
+	}
+
+	var account *proto.Account
+	err := callUserService(func(ctx context.Context, userClient proto.UserInternalClient) error {
+		var err error
+		account, err = userClient.GetAccount(ctx, &proto.AccountReq{Id: uint32(id)})
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, &model.PropertyError{Message: fmt.Sprintf("User %d does not exist", id)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range account.Roles {
+		if role == ownerRole {
+			return account, nil
+		}
+	}
+	return nil, &model.PermissionError{Message: fmt.Sprintf("User %s (ID: %d) is no owner", account.Name, id)}
+}
+
+// MigrateUsers links the properties and reviews of earlier versions, which only store the name of their owner
+// or customer, to the accounts of these names and returns the number of linked rows
+// NOTE: The user service creates the missing accounts, names differing only in case share one account
+// and are replaced by its name. Rows without a name or with a name the user service does not accept,
+// e.g. one that is longer than 60 characters, stay unlinked and are logged.
+func MigrateUsers() (int64, error) {
+	owners, err := linkAccounts(new(model.Property), "owner", ownerRole)
+	if err != nil {
+		return owners, err
+	}
+	customers, err := linkAccounts(new(model.Review), "customer", customerRole)
+	return owners + customers, err
+}
+
+// linkAccounts sets the <prefix>_id of the rows of the given model that only store a <prefix>_name
+// to the account of that name with the given role
+func linkAccounts(value interface{}, prefix string, role string) (int64, error) {
+	idColumn, nameColumn := prefix+"_id", prefix+"_name"
+	var names []string
+	result := db.DB.Unscoped().Model(value).Distinct(nameColumn).
+		Where(idColumn+" = 0 AND "+nameColumn+" <> ''").
+		Pluck(nameColumn, &names)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	names = validUserNames(names, prefix)
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	var accounts *proto.AccountList
+	err := callUserService(func(ctx context.Context, userClient proto.UserInternalClient) error {
+		var err error
+		accounts, err = userClient.EnsureAccounts(ctx, &proto.EnsureAccountsReq{Names: names, Role: role})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var linked int64
+	for i, account := range accounts.Accounts {
+		result := db.DB.Unscoped().Model(value).
+			Where(idColumn+" = 0 AND "+nameColumn+" = ?", names[i]).
+			UpdateColumns(map[string]interface{}{idColumn: account.Id, nameColumn: account.Name})
+		if result.Error != nil {
+			return linked, result.Error
+		}
+		linked += result.RowsAffected
+		log.WithField("ID", account.Id).Infof("Linked %d rows of %s %s to user.", result.RowsAffected, prefix, names[i])
+	}
+	return linked, nil
+}
+
+// maxUserNameLength is the maximum length of the name of a user, see the user service
+const maxUserNameLength = 60
+
+// isValidUserName checks whether the user service accepts the given name for an account
+func isValidUserName(name string) bool {
+	name = strings.Join(strings.Fields(name), " ")
+	return name != "" && len([]rune(name)) <= maxUserNameLength
+}
+
+// validUserNames returns the given names the user service accepts and logs the others
+func validUserNames(names []string, prefix string) []string {
+	var valid []string
+	for _, name := range names {
+		if !isValidUserName(name) {
+			log.Warnf("Skipping %s %q, it must contain 1 to %d characters to be linked to a user.", prefix, name, maxUserNameLength)
+			continue
+		}
+		valid = append(valid, name)
+	}
+	return valid
+}
+
+// callUserService connects to the user service via gRPC and passes a client for it to the given call
+func callUserService(call func(context.Context, proto.UserInternalClient) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	conn, err := client.GetUserConnection(ctx)
+	if err != nil {
+		log.Errorf("Error connecting to user service: %v", err)
+		return err
+	}
+	defer func(conn *grpc.ClientConn) {
+		err := conn.Close()
+		if err != nil {
+			log.Errorf("Error closing connection: %s", err)
+		}
+	}(conn)
+
+	err = call(ctx, proto.NewUserInternalClient(conn))
+	if err != nil {
+		log.Errorf("Error calling user service: %v", err)
+		return err
+	}
+	return nil
+}
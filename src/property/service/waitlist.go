@@ -0,0 +1,194 @@
+package service
+
+import (
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/property/model"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// JoinWaitlist queues the given customer for the stay from checkIn to checkOut at the given property
+// NOTE: Joining is only possible while the stay conflicts with a reservation or hold,
+// joining twice for the same stay returns the existing entry
+func JoinWaitlist(existingProperty *model.Property, customerName string, checkIn time.Time, checkOut time.Time) (*model.WaitlistEntry, error) {
+	checkIn, checkOut = model.TruncateToDay(checkIn), model.TruncateToDay(checkOut)
+	if customerName == "" {
+		return nil, &model.PropertyError{Message: "Customer name is required"}
+	}
+	if !checkOut.After(checkIn) {
+		return nil, &model.PropertyError{Message: "Check-out must be at least one day after check-in"}
+	}
+
+	existingEntry := new(model.WaitlistEntry)
+	result := db.DB.Where("property_id = ? AND customer_name = ? AND check_in = ? AND check_out = ?",
+		existingProperty.ID, customerName, checkIn, checkOut).Limit(1).Find(existingEntry)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.WithField("ID", existingProperty.ID).Infof("Customer %s is already on the waitlist.", customerName)
+		return existingEntry, nil
+	}
+
+	conflicts, err := countConflicts(db.DB, existingProperty.ID, checkIn, checkOut, "")
+	if err != nil {
+		return nil, err
+	}
+	if conflicts == 0 {
+		message := fmt.Sprintf("Property %s (ID: %d) is available between %s and %s, please book it directly",
+			existingProperty.Name, existingProperty.ID, checkIn.Format(time.DateOnly), checkOut.Format(time.DateOnly))
+		return nil, &model.PropertyError{Message: message}
+	}
+
+	waitlistEntry := model.WaitlistEntry{
+		PropertyId:     existingProperty.ID,
+		CustomerName:   customerName,
+		CheckIn:        checkIn,
+		CheckOut:       checkOut,
+		WaitlistStatus: model.WAITING,
+	}
+	result = db.DB.Create(&waitlistEntry)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	entry := log.WithField("ID", existingProperty.ID)
+	entry.Infof("Successfully added customer %s to the waitlist.", customerName)
+	entry.Tracef("Waitlisted: %v", waitlistEntry)
+	return &waitlistEntry, nil
+}
+
+// LeaveWaitlist removes the waitlist entry matching the given id from the waitlist of the given property
+// NOTE: Only the customer of the entry can remove it. A pending offer is released and passed on to the next customer.
+func LeaveWaitlist(existingProperty *model.Property, id uint, customerName string) error {
+	waitlistEntry := new(model.WaitlistEntry)
+	result := db.DB.Where("id = ? AND property_id = ?", id, existingProperty.ID).Limit(1).Find(waitlistEntry)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		message := fmt.Sprintf("Whoops! It seems as if the property %s (ID: %d) has no waitlist entry %d.",
+			existingProperty.Name, existingProperty.ID, id)
+		return &model.PropertyError{Message: message}
+	}
+	if waitlistEntry.CustomerName != customerName {
+		message := fmt.Sprintf("Only customer %s can leave waitlist entry %d", waitlistEntry.CustomerName, id)
+		return &model.PermissionError{Message: message}
+	}
+
+	result = db.DB.Delete(waitlistEntry)
+	if result.Error != nil {
+		return result.Error
+	}
+	if waitlistEntry.IsOffered() {
+		result = db.DB.Where("token = ?", waitlistEntry.HoldToken).Delete(new(model.Hold))
+		if result.Error != nil {
+			return result.Error
+		}
+		offerToWaitlist(existingProperty.ID)
+	}
+
+	entry := log.WithField("ID", existingProperty.ID)
+	entry.Infof("Successfully removed customer %s from the waitlist.", customerName)
+	return nil
+}
+
+// GetWaitlist retrieves the waitlist entries in the order customers joined
+// NOTE: A propertyId of 0 or an empty customerName do not restrict the entries
+func GetWaitlist(propertyId uint, customerName string) ([]model.WaitlistEntry, error) {
+	query := db.DB.Order("id")
+	if propertyId != 0 {
+		query = query.Where("property_id = ?", propertyId)
+	}
+	if customerName != "" {
+		query = query.Where("customer_name = ?", customerName)
+	}
+
+	var waitlist []model.WaitlistEntry
+	result := query.Find(&waitlist)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	log.Tracef("Retrieved: %v", waitlist)
+	return waitlist, nil
+}
+
+// ExpireWaitlistOffers removes the waitlist entries whose offer expired and passes the offer on to the next customers
+func ExpireWaitlistOffers() (int64, error) {
+	var expired []model.WaitlistEntry
+	result := db.DB.Where("waitlist_status = ? AND offer_expires_at <= ?", model.OFFERED, clock.Now()).Find(&expired)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	result = db.DB.Delete(&expired)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	log.Infof("Removed %d waitlist entries with expired offers.", result.RowsAffected)
+
+	propertyIds := make(map[uint]bool)
+	for _, waitlistEntry := range expired {
+		if !propertyIds[waitlistEntry.PropertyId] {
+			propertyIds[waitlistEntry.PropertyId] = true
+			offerToWaitlist(waitlistEntry.PropertyId)
+		}
+	}
+	return result.RowsAffected, nil
+}
+
+// offerToWaitlist offers a hold to the waiting customers of the property matching the given id in the order they joined
+// NOTE: Customers whose stay still conflicts are skipped, so a freed range is offered to the first customer it fits.
+// Failures are only logged, because the property has been freed already.
+func offerToWaitlist(propertyId uint) {
+	entry := log.WithField("ID", propertyId)
+
+	existingProperty, err := GetProperty(propertyId)
+	if existingProperty == nil || err != nil {
+		entry.Errorf("Error loading property to offer it to the waitlist: %v", err)
+		return
+	}
+
+	var waiting []model.WaitlistEntry
+	result := db.DB.Where("property_id = ? AND waitlist_status = ?", propertyId, model.WAITING).Order("id").Find(&waiting)
+	if result.Error != nil {
+		entry.Errorf("Error loading waitlist: %v", result.Error)
+		return
+	}
+
+	for _, waitlistEntry := range waiting {
+		conflicts, err := countConflicts(db.DB, propertyId, waitlistEntry.CheckIn, waitlistEntry.CheckOut, "")
+		if err != nil {
+			entry.Errorf("Error checking waitlist entry %d: %v", waitlistEntry.ID, err)
+			return
+		}
+		if conflicts > 0 {
+			continue
+		}
+
+		hold, err := HoldProperty(existingProperty, waitlistEntry.CheckIn, waitlistEntry.CheckOut, 0)
+		if err != nil {
+			entry.Errorf("Error holding property for waitlist entry %d: %v", waitlistEntry.ID, err)
+			return
+		}
+		result := db.DB.Model(&waitlistEntry).Updates(model.WaitlistEntry{
+			WaitlistStatus: model.OFFERED,
+			HoldToken:      hold.Token,
+			OfferExpiresAt: &hold.ExpiresAt,
+		})
+		if result.Error != nil {
+			entry.Errorf("Error offering hold to waitlist entry %d: %v", waitlistEntry.ID, result.Error)
+			return
+		}
+		entry.Infof("Offered property to customer %s from the waitlist until %s.", waitlistEntry.CustomerName, hold.ExpiresAt)
+	}
+}
+
+// removeAcceptedOffer removes the waitlist entry whose offered hold was consumed by a booking
+func removeAcceptedOffer(holdToken string) error {
+	return db.DB.Where("hold_token = ?", holdToken).Delete(new(model.WaitlistEntry)).Error
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"errors"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNotFound is returned by a BlobStore for keys without a blob
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores binary objects like photos under keys of slash separated segments,
+// e.g. properties/1/photos/3f2a.jpg
+// NOTE: Implementations have to be safe for concurrent use, Delete of a missing key is no error.
+type BlobStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// Photos stores the photos of properties and their thumbnails
+var Photos BlobStore
+
+// Init stores photos in the directory given by PHOTO_STORE_DIR, /data/photos by default
+func Init() {
+	dir := os.Getenv("PHOTO_STORE_DIR")
+	if dir == "" {
+		dir = "/data/photos"
+	}
+	store, err := NewFileStore(dir)
+	if err != nil {
+		panic(err)
+	}
+	log.Info("Using photo store directory: ", dir)
+	Photos = store
+}
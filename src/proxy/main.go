@@ -8,25 +8,92 @@ import (
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"net/http"
+	"net/textproto"
 	"os"
+	"strconv"
 )
 
 var port = os.Getenv("PORT")
 
 var propertyTarget = os.Getenv("PROPERTY_CONNECT")
 var bookingTarget = os.Getenv("BOOKING_CONNECT")
+var userTarget = os.Getenv("USER_CONNECT")
+
+// headerMatcher forwards the Idempotency-Key and If-Match headers as gRPC metadata in addition to the default headers
+func headerMatcher(key string) (string, bool) {
+	switch textproto.CanonicalMIMEHeaderKey(key) {
+	case "Idempotency-Key":
+		return "idempotency-key", true
+	case "If-Match":
+		return "if-match", true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// setETag sets the ETag header for responses of a single property or booking
+func setETag(_ context.Context, w http.ResponseWriter, resp protobuf.Message) error {
+	if versioned, ok := resp.(interface{ GetEtag() string }); ok && versioned.GetEtag() != "" {
+		w.Header().Set("ETag", strconv.Quote(versioned.GetEtag()))
+	}
+	return nil
+}
+
+// errorHandler responds to updates rejected because of a stale If-Match with 412 Precondition Failed
+// instead of the default 409 Conflict for Aborted
+// NOTE: Requests without If-Match keep 409, e.g. an update that lost against a concurrent one.
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if status.Code(err) == codes.Aborted && r.Header.Get("If-Match") != "" {
+		w = &statusWriter{ResponseWriter: w, status: http.StatusPreconditionFailed}
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
+
+// statusWriter replaces the status code written by the default error handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(int) {
+	w.ResponseWriter.WriteHeader(w.status)
+}
 
 // main creates a gRPC gateway which acts as a proxy between external HTTP clients
-// and the internal gRPC property and booking services
+// and the internal gRPC property, booking and user services
 func main() {
-	// Register gRPC handlers for property and booking services
-	mux := runtime.NewServeMux()
-	err := proto.RegisterPropertyExternalHandlerFromEndpoint(context.Background(), mux, propertyTarget, []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
+	// Register gRPC handlers for property, booking and user services
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+		runtime.WithForwardResponseOption(setETag),
+		runtime.WithErrorHandler(errorHandler),
+	)
+	propertyConn, err := grpc.Dial(propertyTarget,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(maxMessageSize), grpc.MaxCallRecvMsgSize(maxMessageSize)))
+	if err != nil {
+		log.Fatalf("Failed to connect to gRPC clients: %v", err)
+	}
+	if err := proto.RegisterPropertyExternalHandler(context.Background(), mux, propertyConn); err != nil {
+		log.Fatalf("Failed to connect to gRPC clients: %v", err)
+	}
 	err = proto.RegisterBookingExternalHandlerFromEndpoint(context.Background(), mux, bookingTarget, []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
 	if err != nil {
 		log.Fatalf("Failed to connect to gRPC clients: %v", err)
 	}
+	err = proto.RegisterUserExternalHandlerFromEndpoint(context.Background(), mux, userTarget, []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
+	if err != nil {
+		log.Fatalf("Failed to connect to gRPC clients: %v", err)
+	}
+	// registered last, so that they take precedence over the routes of the gRPC gateway
+	photos := &photoHandler{mux: mux, client: proto.NewPropertyExternalClient(propertyConn)}
+	if err := photos.register(); err != nil {
+		log.Fatalf("Failed to register photo routes: %v", err)
+	}
 
 	// Create an HTTP server
 	server := gin.New()
@@ -41,6 +108,9 @@ func main() {
 	server.Group("bookings").Any("", handlerFunc)
 	server.Group("bookings/*{grpc_gateway}").Any("", handlerFunc)
 
+	server.Group("users").Any("", handlerFunc)
+	server.Group("users/*{grpc_gateway}").Any("", handlerFunc)
+
 	log.Info("Starting goBooking proxy server")
 	err = server.Run(fmt.Sprintf(":%s", port))
 	if err != nil {
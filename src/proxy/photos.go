@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/proxy/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// maxPhotoSize is checked by the property service, the proxy only stops reading much larger uploads early
+	maxPhotoSize = 5 << 20
+	// maxUploadSize leaves room for the other parts and boundaries of the multipart body
+	maxUploadSize = maxPhotoSize + 1<<20
+	// maxMessageSize allows gRPC messages to carry a photo
+	maxMessageSize = maxPhotoSize + 1<<20
+)
+
+// photoHandler serves the photos of properties as multipart uploads and raw downloads,
+// which the gRPC gateway cannot map to messages
+type photoHandler struct {
+	mux    *runtime.ServeMux
+	client proto.PropertyExternalClient
+}
+
+// register adds the upload and download routes to the mux of the gRPC gateway
+func (h *photoHandler) register() error {
+	if err := h.mux.HandlePath(http.MethodPost, "/properties/{id}/photos", h.upload); err != nil {
+		return err
+	}
+	return h.mux.HandlePath(http.MethodGet, "/properties/{id}/photos/{photo_id}", h.download)
+}
+
+// upload forwards the image in the form field photo of a multipart request to the property service
+func (h *photoHandler) upload(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	_, outbound := runtime.MarshalerForRequest(h.mux, r)
+	ctx, err := runtime.AnnotateContext(r.Context(), h.mux, r, "/gen.PropertyExternal/UploadPhoto",
+		runtime.WithHTTPPathPattern("/properties/{id}/photos"))
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, err)
+		return
+	}
+	propertyId, err := parseId(pathParams, "id")
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = status.Errorf(codes.InvalidArgument, "The photo must not be larger than %d MiB", maxPhotoSize>>20)
+		} else {
+			err = status.Errorf(codes.InvalidArgument, "Expected a multipart form with the image in the field photo: %v", err)
+		}
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, err)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, status.Errorf(codes.InvalidArgument, "Failed to read the photo: %v", err))
+		return
+	}
+
+	resp, err := h.client.UploadPhoto(ctx, &proto.UploadPhotoReq{PropertyId: propertyId, Data: data})
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, err)
+		return
+	}
+	runtime.ForwardResponseMessage(ctx, h.mux, outbound, w, r, resp)
+}
+
+// download responds with the original photo or with its thumbnail for ?size=thumbnail
+func (h *photoHandler) download(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	_, outbound := runtime.MarshalerForRequest(h.mux, r)
+	ctx, err := runtime.AnnotateContext(r.Context(), h.mux, r, "/gen.PropertyExternal/GetPhotoContent",
+		runtime.WithHTTPPathPattern("/properties/{id}/photos/{photo_id}"))
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, err)
+		return
+	}
+	req := new(proto.PhotoContentReq)
+	if req.PropertyId, err = parseId(pathParams, "id"); err == nil {
+		req.PhotoId, err = parseId(pathParams, "photo_id")
+	}
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, err)
+		return
+	}
+	switch size := r.URL.Query().Get("size"); size {
+	case "", "original":
+	case "thumbnail":
+		req.Thumbnail = true
+	default:
+		err := status.Errorf(codes.InvalidArgument, "Unknown size %s, expected original or thumbnail", size)
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, err)
+		return
+	}
+
+	resp, err := h.client.GetPhotoContent(ctx, req)
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, outbound, w, r, err)
+		return
+	}
+	// photos are never modified, only deleted
+	w.Header().Set("Content-Type", resp.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, "", resp.CreatedAt.AsTime(), bytes.NewReader(resp.Data))
+}
+
+func parseId(pathParams map[string]string, name string) (uint32, error) {
+	id, err := strconv.ParseUint(pathParams[name], 10, 32)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "Invalid %s %q", name, pathParams[name])
+	}
+	return uint32(id), nil
+}
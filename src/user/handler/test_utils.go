@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/gorm"
+	"net"
+)
+
+// creates and starts a UserExternalServer and UserInternalServer
+// and returns clients that are connected to them and can be used for tests
+func startUserServer(ctx context.Context) (proto.UserExternalClient, proto.UserInternalClient, func()) {
+	buffer := 1024 * 1024
+	lis := bufconn.Listen(buffer)
+
+	baseServer := grpc.NewServer()
+	userHandler := new(UserHandler)
+	proto.RegisterUserExternalServer(baseServer, userHandler)
+	proto.RegisterUserInternalServer(baseServer, userHandler)
+	go func() {
+		if err := baseServer.Serve(lis); err != nil {
+			log.Printf("Error serving userServer: %v", err)
+		}
+	}()
+
+	conn, err := grpc.DialContext(ctx, "",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Printf("Error connecting to userServer: %v", err)
+	}
+
+	closer := func() {
+		baseServer.Stop()
+	}
+
+	return proto.NewUserExternalClient(conn), proto.NewUserInternalClient(conn), closer
+}
+
+func createUserInDB() {
+	user := model.User{
+		Model:    gorm.Model{ID: 1},
+		Name:     "Mickey Mouse",
+		Handle:   "mickey mouse",
+		Customer: true,
+	}
+	db.DB.Create(&user)
+}
+
+func deleteUserInDB() {
+	db.DB.Unscoped().Delete(new(model.User), 1)
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/proto"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/service"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type UserHandler struct {
+	proto.UserExternalServer
+	proto.UserInternalServer
+}
+
+func (h *UserHandler) CreateUser(_ context.Context, req *proto.CreateUserReq) (*proto.UserResp, error) {
+	user, err := model.NewUser(req.Name, req.Roles)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	if err := service.CreateUser(user); err != nil {
+		log.Errorf("Error calling service CreateUser: %v", err)
+		return nil, mapUserError(err)
+	}
+	return mapToProtoUserResp(user), nil
+}
+
+func (h *UserHandler) GetUser(_ context.Context, req *proto.UserIdReq) (*proto.UserResp, error) {
+	user, err := service.GetUser(uint(req.Id))
+	if err != nil {
+		log.Errorf("Error calling service GetUser with ID %v: %v", req.Id, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "User not found")
+	}
+	return mapToProtoUserResp(user), nil
+}
+
+func (h *UserHandler) GetUserByName(_ context.Context, req *proto.UserNameReq) (*proto.UserResp, error) {
+	user, err := service.GetUserByName(req.Name)
+	if err != nil {
+		log.Errorf("Error calling service GetUserByName: %v", err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "User not found")
+	}
+	return mapToProtoUserResp(user), nil
+}
+
+func (h *UserHandler) GrantRole(_ context.Context, req *proto.GrantRoleReq) (*proto.UserResp, error) {
+	role, err := model.ParseRole(req.Role)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	user, err := service.GrantRole(uint(req.Id), role)
+	if err != nil {
+		log.Errorf("Error calling service GrantRole with ID %v: %v", req.Id, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "User not found")
+	}
+	return mapToProtoUserResp(user), nil
+}
+
+func (h *UserHandler) GetAccount(_ context.Context, req *proto.AccountReq) (*proto.Account, error) {
+	user, err := service.GetUser(uint(req.Id))
+	if err != nil {
+		log.Errorf("Error calling service GetUser with ID %v: %v", req.Id, err)
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "User %d not found", req.Id)
+	}
+	return mapToProtoAccount(user), nil
+}
+
+func (h *UserHandler) EnsureAccounts(_ context.Context, req *proto.EnsureAccountsReq) (*proto.AccountList, error) {
+	role, err := model.ParseRole(req.Role)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	users, err := service.EnsureUsers(req.Names, role)
+	if err != nil {
+		log.Errorf("Error calling service EnsureUsers: %v", err)
+		return nil, mapUserError(err)
+	}
+
+	accounts := make([]*proto.Account, len(users))
+	for i := range users {
+		accounts[i] = mapToProtoAccount(&users[i])
+	}
+	return &proto.AccountList{Accounts: accounts}, nil
+}
+
+// mapUserError rejects invalid names with InvalidArgument and names of other accounts with AlreadyExists
+func mapUserError(err error) error {
+	var userError *model.UserError
+	if errors.As(err, &userError) {
+		return status.Errorf(codes.InvalidArgument, userError.Error())
+	}
+	var nameTakenError *model.NameTakenError
+	if errors.As(err, &nameTakenError) {
+		return status.Errorf(codes.AlreadyExists, nameTakenError.Error())
+	}
+	return status.Errorf(codes.Internal, err.Error())
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/proto"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type UserTestSuite struct {
+	suite.Suite
+	ctx             context.Context
+	client          proto.UserExternalClient
+	internalClient  proto.UserInternalClient
+	closeUserServer func()
+	cleanUpDB       func()
+}
+
+// beforeAll
+func (suite *UserTestSuite) SetupSuite() {
+	log.Info(">>> From SetupSuite")
+	suite.ctx = context.Background()
+	suite.client, suite.internalClient, suite.closeUserServer = startUserServer(suite.ctx)
+}
+
+// beforeEach
+func (suite *UserTestSuite) SetupTest() {
+	log.Info("--- From SetupTest: Setting up fresh DB")
+	suite.cleanUpDB = db.SetupTestDB(suite.T())
+}
+
+// afterAll
+func (suite *UserTestSuite) TearDownSuite() {
+	log.Info(">>> From TearDownSuite")
+	suite.closeUserServer()
+}
+
+// afterEach
+func (suite *UserTestSuite) TearDownTest() {
+	log.Info("--- From TearDownTest: Cleaning up DB")
+	suite.cleanUpDB()
+}
+
+func (suite *UserTestSuite) TestUserHandler_CreateUser() {
+	type expectation struct {
+		out *proto.UserResp
+		err error
+	}
+
+	tests := map[string]struct {
+		in           *proto.CreateUserReq
+		setupFunc    func()
+		tearDownFunc func()
+		expected     expectation
+	}{
+		"GivenNoRole_WhenCreateUser_ThenReturnInvalidArgument": {
+			in:           &proto.CreateUserReq{Name: "Mickey Mouse"},
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = A user requires the role CUSTOMER and/or OWNER"),
+			},
+		},
+		"GivenUnknownRole_WhenCreateUser_ThenReturnInvalidArgument": {
+			in:           &proto.CreateUserReq{Name: "Mickey Mouse", Roles: []string{"ADMIN"}},
+			setupFunc:    nil,
+			tearDownFunc: nil,
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = InvalidArgument desc = Unknown role ADMIN, expected CUSTOMER or OWNER"),
+			},
+		},
+		"GivenUserWithSameNameInOtherCase_WhenCreateUser_ThenReturnAlreadyExists": {
+			in: &proto.CreateUserReq{Name: " mickey  mouse", Roles: []string{"OWNER"}},
+			setupFunc: func() {
+				createUserInDB()
+			},
+			tearDownFunc: func() {
+				deleteUserInDB()
+			},
+			expected: expectation{
+				out: nil,
+				err: errors.New("rpc error: code = AlreadyExists desc = The name mickey mouse is already taken"),
+			},
+		},
+		"GivenNoUser_WhenCreateUser_ThenReturnUser": {
+			in:           &proto.CreateUserReq{Name: " Mickey   Mouse ", Roles: []string{"CUSTOMER", "OWNER"}},
+			setupFunc:    nil,
+			tearDownFunc: deleteUserInDB,
+			expected: expectation{
+				out: &proto.UserResp{Id: 1, Name: "Mickey Mouse", Roles: []string{"CUSTOMER", "OWNER"}},
+				err: nil,
+			},
+		},
+	}
+
+	for scenario, testData := range tests {
+		log.Infof("Scenario: %s", scenario)
+
+		if testData.setupFunc != nil {
+			testData.setupFunc()
+		}
+
+		out, err := suite.client.CreateUser(suite.ctx, testData.in)
+		if err != nil {
+			if testData.expected.err == nil || testData.expected.err.Error() != err.Error() {
+				suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", testData.expected.err, err)
+			}
+		} else if testData.expected.out == nil || out.Name != testData.expected.out.Name ||
+			len(out.Roles) != len(testData.expected.out.Roles) {
+			suite.T().Errorf("Out:\n Expected: %v\n Actual: %v", testData.expected.out, out)
+		}
+
+		if testData.tearDownFunc != nil {
+			testData.tearDownFunc()
+		}
+	}
+}
+
+func (suite *UserTestSuite) TestUserHandler_GetUserByName() {
+	// given
+	createUserInDB()
+
+	// when
+	out, err := suite.client.GetUserByName(suite.ctx, &proto.UserNameReq{Name: "MICKEY mouse"})
+
+	// then
+	suite.Require().NoError(err)
+	suite.Equal(uint32(1), out.Id)
+	suite.Equal("Mickey Mouse", out.Name)
+	suite.Equal([]string{"CUSTOMER"}, out.Roles)
+
+	// when
+	_, err = suite.client.GetUserByName(suite.ctx, &proto.UserNameReq{Name: "Minnie Mouse"})
+
+	// then
+	expected := "rpc error: code = NotFound desc = User not found"
+	if err == nil || err.Error() != expected {
+		suite.T().Errorf("Err:\n Expected: %v\n Actual: %v", expected, err)
+	}
+}
+
+func (suite *UserTestSuite) TestUserHandler_GrantRole() {
+	// given
+	createUserInDB()
+
+	// when
+	out, err := suite.client.GrantRole(suite.ctx, &proto.GrantRoleReq{Id: 1, Role: "OWNER"})
+
+	// then
+	suite.Require().NoError(err)
+	suite.Equal([]string{"CUSTOMER", "OWNER"}, out.Roles)
+	account, err := suite.internalClient.GetAccount(suite.ctx, &proto.AccountReq{Id: 1})
+	suite.Require().NoError(err)
+	suite.Equal([]string{"CUSTOMER", "OWNER"}, account.Roles)
+}
+
+func (suite *UserTestSuite) TestUserHandler_EnsureAccounts() {
+	// given
+	createUserInDB()
+
+	// when migrating the owner names of properties
+	out, err := suite.internalClient.EnsureAccounts(suite.ctx, &proto.EnsureAccountsReq{
+		Names: []string{"mickey mouse", "Donald Duck", "donald  duck"},
+		Role:  "OWNER",
+	})
+
+	// then names differing in case share one account, existing accounts are granted the role
+	suite.Require().NoError(err)
+	suite.Require().Len(out.Accounts, 3)
+	suite.Equal(uint32(1), out.Accounts[0].Id)
+	suite.Equal("Mickey Mouse", out.Accounts[0].Name)
+	suite.Equal([]string{"CUSTOMER", "OWNER"}, out.Accounts[0].Roles)
+	suite.Equal("Donald Duck", out.Accounts[1].Name)
+	suite.Equal([]string{"OWNER"}, out.Accounts[1].Roles)
+	suite.Equal(out.Accounts[1].Id, out.Accounts[2].Id)
+
+	// when migrating again
+	again, err := suite.internalClient.EnsureAccounts(suite.ctx, &proto.EnsureAccountsReq{Names: []string{"Donald Duck"}, Role: "OWNER"})
+
+	// then no account is created
+	suite.Require().NoError(err)
+	suite.Equal(out.Accounts[1].Id, again.Accounts[0].Id)
+}
+
+func TestUserTestSuite(t *testing.T) {
+	suite.Run(t, new(UserTestSuite))
+}
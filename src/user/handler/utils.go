@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"github.com/HaCaK/pse-bee-gobooking/src/user/model"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func mapToProtoUserResp(user *model.User) *proto.UserResp {
+	return &proto.UserResp{
+		Id:        uint32(user.ID),
+		Name:      user.Name,
+		Roles:     mapToRoleNames(user.Roles()),
+		CreatedAt: timestamppb.New(user.CreatedAt),
+	}
+}
+
+func mapToProtoAccount(user *model.User) *proto.Account {
+	return &proto.Account{
+		Id:    uint32(user.ID),
+		Name:  user.Name,
+		Roles: mapToRoleNames(user.Roles()),
+	}
+}
+
+func mapToRoleNames(roles []model.Role) []string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = string(role)
+	}
+	return names
+}
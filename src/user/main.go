@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/handler"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/proto"
+	"google.golang.org/grpc"
+	"net"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	// ensure that logger is initialized before connecting to DB
+	defer db.Init()
+	// init logger
+	log.SetFormatter(&log.TextFormatter{})
+	log.SetReportCaller(true)
+	level, err := log.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Info("Log level not specified, using default log level: INFO")
+		log.SetLevel(log.InfoLevel)
+		return
+	}
+	log.SetLevel(level)
+}
+
+var port = os.Getenv("PORT")
+
+// main creates a gRPC server for the accounts of customers and owners
+func main() {
+	log.Info("Starting goBooking user gRPC server")
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Fatalf("Failed to listen on gRPC port %s: %v", port, err)
+	}
+
+	grpcServer := grpc.NewServer()
+	userHandler := new(handler.UserHandler)
+	proto.RegisterUserExternalServer(grpcServer, userHandler)
+	proto.RegisterUserInternalServer(grpcServer, userHandler)
+	if err := grpcServer.Serve(lis); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package model
+
+import "fmt"
+
+type UserError struct {
+	Message string
+}
+
+func (e *UserError) Error() string {
+	return fmt.Sprintf("%s", e.Message)
+}
+
+// NameTakenError signals that another account already uses the name regardless of case
+type NameTakenError struct {
+	Name string
+}
+
+func (e *NameTakenError) Error() string {
+	return fmt.Sprintf("The name %s is already taken", e.Name)
+}
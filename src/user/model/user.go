@@ -0,0 +1,83 @@
+package model
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+)
+
+type Role string
+
+const (
+	CUSTOMER Role = "CUSTOMER"
+	OWNER    Role = "OWNER"
+)
+
+const maxNameLength = 60
+
+// ParseRole returns the role with the given name
+func ParseRole(name string) (Role, error) {
+	switch role := Role(name); role {
+	case CUSTOMER, OWNER:
+		return role, nil
+	}
+	return "", &UserError{Message: fmt.Sprintf("Unknown role %s, expected CUSTOMER or OWNER", name)}
+}
+
+// User is the account of a customer booking properties and/or of an owner offering them
+type User struct {
+	gorm.Model
+	Name string `gorm:"notNull;size:60"`
+	// the name in lower case with single spaces, unique so that "Mickey Mouse" and "mickey  mouse" are one account
+	Handle   string `gorm:"notNull;size:60;uniqueIndex"`
+	Customer bool   `gorm:"notNull;default:false"`
+	Owner    bool   `gorm:"notNull;default:false"`
+}
+
+// NewUser returns a validated account with the given name and roles
+func NewUser(name string, roles []string) (*User, error) {
+	user := &User{Name: strings.Join(strings.Fields(name), " ")}
+	if user.Name == "" || len([]rune(user.Name)) > maxNameLength {
+		return nil, &UserError{Message: fmt.Sprintf("Name must contain 1 to %d characters", maxNameLength)}
+	}
+	user.Handle = NormalizeName(user.Name)
+	if len(roles) == 0 {
+		return nil, &UserError{Message: "A user requires the role CUSTOMER and/or OWNER"}
+	}
+	for _, name := range roles {
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, err
+		}
+		user.Grant(role)
+	}
+	return user, nil
+}
+
+// NormalizeName returns the handle identifying the account of the given name
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func (user *User) Grant(role Role) {
+	switch role {
+	case CUSTOMER:
+		user.Customer = true
+	case OWNER:
+		user.Owner = true
+	}
+}
+
+func (user *User) HasRole(role Role) bool {
+	return (role == CUSTOMER && user.Customer) || (role == OWNER && user.Owner)
+}
+
+func (user *User) Roles() []Role {
+	var roles []Role
+	for _, role := range []Role{CUSTOMER, OWNER} {
+		if user.HasRole(role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/db"
+	"github.com/HaCaK/pse-bee-gobooking/src/user/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateUser stores the given account unless another account already uses its name regardless of case
+func CreateUser(user *model.User) error {
+	// the unique handle rejects concurrent accounts with the same name as well
+	result := db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(user)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &model.NameTakenError{Name: user.Name}
+	}
+
+	entry := log.WithField("ID", user.ID)
+	entry.Info("Successfully stored new user.")
+	entry.Tracef("Stored: %v", user)
+	return nil
+}
+
+// GetUser retrieves the account matching the given id, nil if there is no such account
+func GetUser(id uint) (*model.User, error) {
+	user := new(model.User)
+	result := db.DB.First(user, id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	log.Tracef("Retrieved: %v", user)
+	return user, nil
+}
+
+// GetUserByName retrieves the account of the given name regardless of case and repeated spaces,
+// nil if there is no such account
+func GetUserByName(name string) (*model.User, error) {
+	user := new(model.User)
+	result := db.DB.Where("handle = ?", model.NormalizeName(name)).Limit(1).Find(user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	log.Tracef("Retrieved: %v", user)
+	return user, nil
+}
+
+// GrantRole adds the given role to the account matching the given id, nil if there is no such account
+func GrantRole(id uint, role model.Role) (*model.User, error) {
+	user, err := GetUser(id)
+	if user == nil || err != nil {
+		return nil, err
+	}
+	if user.HasRole(role) {
+		return user, nil
+	}
+	user.Grant(role)
+	if err := db.DB.Model(user).Select("customer", "owner").Updates(user).Error; err != nil {
+		return nil, err
+	}
+
+	entry := log.WithField("ID", id)
+	entry.Infof("Successfully granted role %s to user.", role)
+	entry.Tracef("Updated: %v", user)
+	return user, nil
+}
+
+// EnsureUsers returns the account of every given name, creating missing accounts with the given role
+// and granting it to existing ones
+// NOTE: Names differing only in case or spaces share one account, named by the first of them.
+func EnsureUsers(names []string, role model.Role) ([]model.User, error) {
+	users := make([]model.User, 0, len(names))
+	byHandle := make(map[string]model.User)
+	for _, name := range names {
+		candidate, err := model.NewUser(name, []string{string(role)})
+		if err != nil {
+			return nil, err
+		}
+		user, ok := byHandle[candidate.Handle]
+		if !ok {
+			if err := ensureUser(candidate); err != nil {
+				return nil, err
+			}
+			user = *candidate
+			byHandle[user.Handle] = user
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// ensureUser replaces the given candidate with the stored account of its name, which is created if missing
+func ensureUser(candidate *model.User) error {
+	// accounts are created by concurrent migrations of the property and booking services
+	if err := db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(candidate).Error; err != nil {
+		return err
+	}
+	role := candidate.Roles()[0]
+	stored := new(model.User)
+	if err := db.DB.Where("handle = ?", candidate.Handle).First(stored).Error; err != nil {
+		return err
+	}
+	*candidate = *stored
+	if candidate.HasRole(role) {
+		return nil
+	}
+	candidate.Grant(role)
+	return db.DB.Model(candidate).Select("customer", "owner").Updates(candidate).Error
+}